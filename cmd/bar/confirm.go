@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/approval"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+)
+
+// approvalPollInterval is how often a paused command checks for a decision.
+const approvalPollInterval = time.Second
+
+// confirmCommand obtains the confirmation the "confirm" events of res ask for.
+// In a terminal the user is prompted; otherwise an approval request is filed
+// and the command waits up to policy.confirm_timeout for a decision from the
+// Web UI. It returns nil when no rule asks for confirmation.
+func confirmCommand(app *App, taskID string, c policy.Command, res *policy.Result) (*ledger.PolicyDecision, error) {
+	req := approvalRequest(taskID, c, res)
+	if req == nil {
+		return nil, nil
+	}
+	if isInteractive() {
+		return promptApproval(req)
+	}
+	store := approval.NewStore(approval.StoreDir(app.BarDir))
+	timeout := approval.ParseTimeout(app.Config.Policy.ConfirmTimeout)
+	return awaitApproval(store, req, timeout, func(msg string) {
+		app.Logger.Info("%s", msg)
+	})
+}
+
+// approvalRequest describes the confirmation res asks for, or returns nil.
+func approvalRequest(taskID string, c policy.Command, res *policy.Result) *approval.Request {
+	confirms := res.Confirmations()
+	if len(confirms) == 0 {
+		return nil
+	}
+	req := &approval.Request{TaskID: taskID, Command: c.Argv, Cwd: c.Cwd}
+	for _, ev := range confirms {
+		req.Rules = append(req.Rules, ev.Rule)
+		if ev.Reason != "" {
+			req.Reasons = append(req.Reasons, ev.Reason)
+		}
+	}
+	return req
+}
+
+func promptApproval(req *approval.Request) (*ledger.PolicyDecision, error) {
+	g := newGuide()
+	g.Print("")
+	g.Printf("⚠️  Policy rule '%s' requires confirmation: %s\n", strings.Join(req.Rules, "', '"), strings.Join(req.Command, " "))
+	for _, reason := range req.Reasons {
+		g.Printf("   %s\n", reason)
+	}
+	g.Print("")
+	confirmed, err := g.Prompt().Confirm("Run this command?")
+	if err != nil {
+		return nil, err
+	}
+	return &ledger.PolicyDecision{
+		Approved: confirmed,
+		By:       currentUser(),
+		Via:      approval.ViaTerminal,
+		At:       time.Now().UTC(),
+	}, nil
+}
+
+// awaitApproval files req in store and waits for it to be decided, denying it
+// after timeout. notify reports where the decision is expected.
+func awaitApproval(store *approval.Store, req *approval.Request, timeout time.Duration, notify func(string)) (*ledger.PolicyDecision, error) {
+	if err := store.Create(req); err != nil {
+		return nil, err
+	}
+	notify(fmt.Sprintf("Policy rule '%s' requires confirmation of '%s'; waiting up to %s for approval %s in the Web UI ('bar ui')",
+		strings.Join(req.Rules, "', '"), strings.Join(req.Command, " "), timeout, req.ID))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return store.Wait(ctx, req.ID, approvalPollInterval)
+}
+
+// withDecision returns events with d recorded on the "confirm" ones.
+func withDecision(events []ledger.PolicyEvent, d *ledger.PolicyDecision) []ledger.PolicyEvent {
+	if d == nil {
+		return events
+	}
+	for i := range events {
+		if events[i].Action == "confirm" {
+			events[i].Decision = d
+		}
+	}
+	return events
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -2,14 +2,21 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/user/blade-agent-runtime/internal/completion"
+	"github.com/user/blade-agent-runtime/internal/core/apply"
+	"github.com/user/blade-agent-runtime/internal/core/diff"
 	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	"github.com/user/blade-agent-runtime/internal/core/workspace"
 	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
 )
 
@@ -28,11 +35,12 @@ func diffCmd() *cobra.Command {
 			}
 			stepID, _ := cmd.Flags().GetString("step")
 			statOnly, _ := cmd.Flags().GetBool("stat")
+			delta, _ := cmd.Flags().GetBool("delta")
 			output, _ := cmd.Flags().GetString("output")
 			format, _ := cmd.Flags().GetString("format")
+			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
+			ledgerManager := ledger.NewManager(taskDir)
 			if stepID != "" {
-				taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
-				ledgerManager := ledger.NewManager(taskDir)
 				step, err := ledgerManager.GetByID(stepID)
 				if err != nil {
 					return err
@@ -40,32 +48,42 @@ func diffCmd() *cobra.Command {
 				if step == nil {
 					return barerrors.StepNotFound(stepID)
 				}
+				stat := step.DiffStat
+				if delta {
+					stat = step.DeltaStat
+				}
 				if statOnly || format == "stat" {
-					if step.DiffStat != nil {
-						app.Logger.Info("%d files changed, %d insertions(+), %d deletions(-)", step.DiffStat.Files, step.DiffStat.Additions, step.DiffStat.Deletions)
+					if stat != nil {
+						app.Logger.Info("%d files changed, %d insertions(+), %d deletions(-)", stat.Files, stat.Additions, stat.Deletions)
 						return nil
 					}
 					app.Logger.Info("0 files changed")
 					return nil
 				}
 				if format == "json" {
-					return outputDiffJSON(app, step.DiffStat, nil, output)
+					return outputDiffJSON(app, stat, nil, output)
 				}
-				if step.Artifacts != nil && step.Artifacts.Patch != "" {
-					patchPath := filepath.Join(taskDir, step.Artifacts.Patch)
-					data, err := os.ReadFile(patchPath)
-					if err != nil {
-						return err
-					}
-					if output != "" {
-						return os.WriteFile(output, data, 0o644)
-					}
-					app.Logger.Info("%s", string(data))
-					return nil
+				data, err := stepPatch(app, task, ledgerManager, step, delta)
+				if err != nil {
+					return err
+				}
+				if output != "" {
+					return os.WriteFile(output, data, 0o644)
+				}
+				app.Logger.Info("%s", string(data))
+				return nil
+			}
+			from := task.BaseRef
+			if delta {
+				last, err := ledgerManager.LastSnapshot()
+				if err != nil {
+					return err
+				}
+				if last != "" {
+					from = last
 				}
-				return barerrors.PatchNotFound(stepID)
 			}
-			result, err := app.DiffEngine.Generate(task.WorkspacePath, task.BaseRef)
+			result, err := app.DiffEngine.Generate(task.WorkspacePath, from)
 			if err != nil {
 				return err
 			}
@@ -74,13 +92,7 @@ func diffCmd() *cobra.Command {
 				return nil
 			}
 			if format == "json" {
-				stat := &ledger.DiffStat{
-					Files:     result.Files,
-					Additions: result.Additions,
-					Deletions: result.Deletions,
-					FileList:  result.FileList,
-				}
-				return outputDiffJSON(app, stat, result.Patch, output)
+				return outputDiffJSON(app, diffStat(result), result.Patch, output)
 			}
 			if output != "" {
 				return os.WriteFile(output, result.Patch, 0o644)
@@ -91,12 +103,52 @@ func diffCmd() *cobra.Command {
 	}
 	cmd.Flags().String("step", "", "show diff for a specific step")
 	cmd.Flags().Bool("stat", false, "show stat only")
+	cmd.Flags().Bool("delta", false, "show only the changes made by the step instead of the cumulative diff")
 	cmd.Flags().String("output", "", "write diff to file")
 	cmd.Flags().String("format", "patch", "output format: patch, stat, json")
 	_ = cmd.RegisterFlagCompletionFunc("step", stepCompletionFunc)
 	return cmd
 }
 
+// stepPatch returns the stored cumulative or delta patch for a step, falling
+// back to recomputing it from the step snapshots when the artifact is missing.
+func stepPatch(app *App, t *task.Task, ledgerManager *ledger.Manager, step *ledger.Step, delta bool) ([]byte, error) {
+	artifact := ""
+	if step.Artifacts != nil {
+		artifact = step.Artifacts.Patch
+		if delta {
+			artifact = step.Artifacts.DeltaPatch
+		}
+	}
+	if artifact != "" {
+		data, err := os.ReadFile(filepath.Join(ledgerManager.TaskDir, artifact))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if step.Snapshot == "" {
+		return nil, barerrors.PatchNotFound(step.StepID)
+	}
+	from := t.BaseRef
+	if delta {
+		prev, err := ledgerManager.SnapshotBefore(step.StepID)
+		if err != nil {
+			return nil, err
+		}
+		if prev != "" {
+			from = prev
+		}
+	}
+	result, err := app.DiffEngine.Between(app.RepoRoot, from, step.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return result.Patch, nil
+}
+
 func stepCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	app, err := initApp(true)
 	if err != nil {
@@ -106,17 +158,18 @@ func stepCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
-	completions := completion.GetStepCompletions(app.BarDir, task.ID)
+	completions := completion.GetStepCompletions(app.BarDir, task.ID, nil)
 	return completion.ToCobraCompletions(completions), cobra.ShellCompDirectiveNoFileComp
 }
 
 func outputDiffJSON(app *App, stat *ledger.DiffStat, patch []byte, output string) error {
 	type jsonOutput struct {
-		Files     int      `json:"files"`
-		Additions int      `json:"additions"`
-		Deletions int      `json:"deletions"`
-		FileList  []string `json:"file_list,omitempty"`
-		Patch     string   `json:"patch,omitempty"`
+		Files     int                 `json:"files"`
+		Additions int                 `json:"additions"`
+		Deletions int                 `json:"deletions"`
+		FileList  []string            `json:"file_list,omitempty"`
+		Changes   []ledger.FileChange `json:"changes,omitempty"`
+		Patch     string              `json:"patch,omitempty"`
 	}
 	out := jsonOutput{}
 	if stat != nil {
@@ -124,6 +177,7 @@ func outputDiffJSON(app *App, stat *ledger.DiffStat, patch []byte, output string
 		out.Additions = stat.Additions
 		out.Deletions = stat.Deletions
 		out.FileList = stat.FileList
+		out.Changes = stat.Changes
 	}
 	if patch != nil {
 		out.Patch = string(patch)
@@ -154,30 +208,191 @@ func applyCmd() *cobra.Command {
 			}
 			message, _ := cmd.Flags().GetString("message")
 			noClose, _ := cmd.Flags().GetBool("no-close")
-			sha, err := app.ApplyEngine.Commit(task.WorkspacePath, app.RepoRoot, task.BaseRef, message)
-			if err != nil {
+			allowSecrets, _ := cmd.Flags().GetBool("allow-secrets")
+			skipGates, _ := cmd.Flags().GetBool("skip-gates")
+			mode, _ := cmd.Flags().GetString("mode")
+			output, _ := cmd.Flags().GetString("output")
+			prFile, _ := cmd.Flags().GetString("pr-file")
+			check, _ := cmd.Flags().GetBool("check")
+			if err := checkNoSync(app, task); err != nil {
 				return err
 			}
-			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
-			ledgerManager := ledger.NewManager(taskDir)
-			stepID, err := ledgerManager.NextStepID()
+			target := apply.Target{
+				BaseRef: task.BaseRef,
+				Branch:  app.Config.Apply.TargetBranch,
+				Rebase:  app.Config.Apply.Rebase,
+			}
+			if cmd.Flags().Changed("to-branch") {
+				target.Branch, _ = cmd.Flags().GetString("to-branch")
+			}
+			if cmd.Flags().Changed("rebase") {
+				target.Rebase, _ = cmd.Flags().GetBool("rebase")
+			}
+			target.Branch = targetBranchName(target.Branch, task)
+			if mode == "commit" {
+				mode = apply.ModeSquash
+			}
+			if !slices.Contains(apply.Modes, mode) {
+				return fmt.Errorf("unknown apply mode %q (expected %s)", mode, strings.Join(apply.Modes, ", "))
+			}
+			if mode == apply.ModePatch {
+				noClose = true
+			}
+			if target.Branch != "" {
+				if mode == apply.ModeMerge || mode == apply.ModePatch {
+					return fmt.Errorf("--to-branch cannot be used with --mode %s", mode)
+				}
+				if target.Branch == task.BaseRef {
+					return fmt.Errorf("--to-branch %s is the task's base branch; apply without --to-branch instead", target.Branch)
+				}
+			}
+			if mode != apply.ModePatch {
+				pf, err := app.ApplyEngine.Preflight(task.WorkspacePath, app.RepoRoot, target, task.BaseSHA)
+				if err != nil {
+					return err
+				}
+				reportPreflight(app, task, target, pf)
+				if err := pf.Err(task.BaseRef); err != nil {
+					return err
+				}
+			}
+			if check {
+				return nil
+			}
+			ledgerManager := ledger.NewManager(filepath.Join(app.BarDir, "tasks", task.ID))
+			if err := checkApplyHooks(app, ledgerManager); err != nil {
+				return err
+			}
+			if skipGates && len(app.Config.Gates) > 0 {
+				app.Logger.Info("Gates: skipping %d gate(s) (--skip-gates)", len(app.Config.Gates))
+			} else if err := runGates(app, task, ledgerManager); err != nil {
+				return err
+			}
+			var applyEvents []ledger.PolicyEvent
+			if policyEnforced(app) || app.DiffEngine.Scanner != nil {
+				result, err := app.DiffEngine.Generate(task.WorkspacePath, task.BaseRef)
+				if err != nil {
+					return err
+				}
+				if len(result.Secrets) > 0 {
+					if !allowSecrets {
+						locations := []string{}
+						for _, f := range result.Secrets {
+							locations = append(locations, f.Location())
+						}
+						return barerrors.SecretsDetected(locations)
+					}
+					app.Logger.Info("Secrets: applying %d possible secret(s) (--allow-secrets)", len(result.Secrets))
+					applyEvents = append(applyEvents, secretPolicyEvents(result.Secrets, "warn")...)
+				}
+				if policyEnforced(app) {
+					events, proceed, err := checkApplyDiff(app, result)
+					if err != nil {
+						return err
+					}
+					if !proceed {
+						app.Logger.Info("Apply cancelled")
+						return nil
+					}
+					applyEvents = append(applyEvents, events...)
+				}
+			}
+			var steps []apply.Step
+			if mode != apply.ModeSquash {
+				if steps, err = applySteps(task, ledgerManager); err != nil {
+					return err
+				}
+				found, err := snapshotSecrets(app, task, steps)
+				if err != nil {
+					return err
+				}
+				if len(found) > 0 {
+					if !allowSecrets {
+						locations := []string{}
+						for _, ev := range found {
+							locations = append(locations, ev.Matched)
+						}
+						return barerrors.StepSecretsDetected(mode, locations)
+					}
+					app.Logger.Info("Secrets: publishing %d possible secret(s) in step snapshots (--allow-secrets)", len(found))
+					applyEvents = append(applyEvents, found...)
+				}
+			}
+			var sha string
+			var commits []string
+			switch mode {
+			case apply.ModeSquash:
+				sha, err = app.ApplyEngine.Commit(task.WorkspacePath, app.RepoRoot, target, message)
+			case apply.ModeSteps:
+				commits, err = app.ApplyEngine.CommitSteps(task.WorkspacePath, app.RepoRoot, target, steps, message)
+				if err == nil {
+					sha = commits[len(commits)-1]
+				}
+			case apply.ModeMerge:
+				sha, commits, err = app.ApplyEngine.Merge(task.WorkspacePath, app.RepoRoot, task.BaseRef, steps, message)
+			}
 			if err != nil {
 				return err
 			}
+			var branchStat *ledger.DiffStat
+			if target.Branch != "" {
+				// The base may have moved on, so describe only what the
+				// branch adds on top of it.
+				from, err := app.Git.Run(app.RepoRoot, "merge-base", task.BaseRef, sha)
+				if err != nil {
+					return err
+				}
+				result, err := app.DiffEngine.Between(app.RepoRoot, from, sha)
+				if err != nil {
+					return err
+				}
+				branchStat = diffStat(result)
+			}
 			now := time.Now().UTC()
-			step := &ledger.Step{
-				StepID:        stepID,
-				Kind:          ledger.StepKindApply,
-				StartedAt:     now,
-				EndedAt:       now,
-				Mode:          "commit",
-				CommitSHA:     sha,
-				CommitMessage: message,
-				TargetBranch:  task.BaseRef,
-			}
-			if err := ledgerManager.Append(step); err != nil {
+			applyStep, err := ledgerManager.AppendNext(func(stepID string) (*ledger.Step, error) {
+				step := &ledger.Step{
+					StepID:        stepID,
+					Kind:          ledger.StepKindApply,
+					StartedAt:     now,
+					EndedAt:       now,
+					Mode:          mode,
+					CommitSHA:     sha,
+					CommitMessage: message,
+					TargetBranch:  task.BaseRef,
+					GatesSkipped:  skipGates && len(app.Config.Gates) > 0,
+					Commits:       commits,
+					PolicyEvents:  applyEvents,
+				}
+				if mode == apply.ModePatch {
+					step.TargetBranch = ""
+					patches, err := writePatchSeries(app, task, ledgerManager, stepID, steps, message, output)
+					if err != nil {
+						return nil, err
+					}
+					step.Artifacts = &ledger.Artifacts{Patches: patches}
+				}
+				if target.Branch != "" {
+					step.TargetBranch = target.Branch
+					description, err := writePRDescription(app, task, ledgerManager, stepID, target.Branch, message, branchStat, prFile)
+					if err != nil {
+						return nil, err
+					}
+					step.Artifacts = &ledger.Artifacts{Description: description}
+				}
+				return step, nil
+			})
+			if err != nil {
 				return err
 			}
+			if mode == apply.ModePatch {
+				dir := output
+				if dir == "" {
+					dir = filepath.Join(ledgerManager.TaskDir, "artifacts", applyStep.StepID+".patches")
+				}
+				app.Logger.Info("Wrote %d patch(es) to %s", len(applyStep.Artifacts.Patches), dir)
+				app.Logger.Info("Task still active: %s", task.Name)
+				return nil
+			}
 			if !noClose {
 				if err := app.WorkspaceManager.Delete(task.WorkspacePath); err != nil {
 					return err
@@ -185,14 +400,28 @@ func applyCmd() *cobra.Command {
 				if err := app.TaskManager.Close(task); err != nil {
 					return err
 				}
-				if state, err := app.TaskManager.LoadState(); err == nil {
-					if state.ActiveTaskID == task.ID {
-						state.ActiveTaskID = ""
-						_ = app.TaskManager.SaveState(state)
-					}
+				_ = app.TaskManager.ClearActive(task.ID)
+			}
+			if len(commits) > 0 {
+				app.Logger.Info("Committed %d step commit(s)", len(commits))
+			}
+			if target.Branch != "" {
+				app.Logger.Info("Committed: %s", sha)
+				app.Logger.Info("Branch: %s (base %s untouched)", target.Branch, task.BaseRef)
+				if prFile == "" {
+					prFile = filepath.Join(ledgerManager.TaskDir, applyStep.Artifacts.Description)
+				}
+				app.Logger.Info("PR description: %s", prFile)
+				if !noClose {
+					app.Logger.Info("Task closed: %s", task.Name)
 				}
+				return nil
+			}
+			if mode == apply.ModeMerge {
+				app.Logger.Info("Merged: %s", sha)
+			} else {
+				app.Logger.Info("Committed: %s", sha)
 			}
-			app.Logger.Info("Committed: %s", sha)
 			if !noClose {
 				app.Logger.Info("Task closed: %s", task.Name)
 			}
@@ -200,10 +429,261 @@ func applyCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().String("message", "", "commit message")
+	cmd.Flags().String("mode", apply.ModeSquash, "apply mode: squash, steps, merge or patch")
+	cmd.Flags().String("output", "", "also write the patch series to this directory (patch mode)")
+	cmd.Flags().String("to-branch", "", "create or update this branch with the task's commits instead of the base branch")
+	cmd.Flags().Bool("rebase", false, "rebase the task's commits onto the latest base first (with --to-branch)")
+	cmd.Flags().String("pr-file", "", "also write the pull request description to this file (with --to-branch)")
 	cmd.Flags().Bool("no-close", false, "do not close task after apply")
+	cmd.Flags().Bool("allow-secrets", false, "apply even if the changes contain possible secrets")
+	cmd.Flags().Bool("skip-gates", false, "apply without running the configured quality gates")
+	cmd.Flags().Bool("check", false, "only check whether the task applies cleanly, without applying")
 	return cmd
 }
 
+// reportPreflight logs what the apply preflight found: whether the base
+// branch moved on since the task started and, if so, whether the task's
+// changes still merge cleanly, and the state of the base branch's checkout.
+func reportPreflight(app *App, t *task.Task, target apply.Target, pf *apply.Preflight) {
+	if !pf.Moved() {
+		app.Logger.Info("Preflight: %s has not moved since the task started (%s)", t.BaseRef, shortSHA(pf.CurrentSHA))
+	} else {
+		app.Logger.Info("Preflight: %s moved %d commit(s) since the task started (%s -> %s)", t.BaseRef, pf.Behind, shortSHA(pf.StartSHA), shortSHA(pf.CurrentSHA))
+		switch {
+		case target.Branch != "" && !target.Rebase:
+			app.Logger.Info("Preflight: %s will be based on %s as of the task start (use --rebase to rebase)", target.Branch, shortSHA(pf.StartSHA))
+		case len(pf.Conflicts) > 0:
+			app.Logger.Info("Preflight: changes conflict with %s in %d file(s)", t.BaseRef, len(pf.Conflicts))
+		default:
+			app.Logger.Info("Preflight: changes merge cleanly, they will be rebased onto %s", t.BaseRef)
+		}
+	}
+	if pf.Checkout != "" {
+		state := "clean"
+		if len(pf.Dirty) > 0 {
+			state = fmt.Sprintf("%d modified file(s)", len(pf.Dirty))
+		}
+		app.Logger.Info("Preflight: %s is checked out in %s (%s)", t.BaseRef, pf.Checkout, state)
+	}
+}
+
+// shortSHA abbreviates a commit hash for display.
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// unappliedSteps returns the steps recorded since the task was last
+// committed. Patch exports commit nothing, so later applies still include the
+// steps before them.
+func unappliedSteps(ledgerManager *ledger.Manager) ([]*ledger.Step, error) {
+	steps, err := ledgerManager.List()
+	if err != nil {
+		return nil, err
+	}
+	out := []*ledger.Step{}
+	for _, s := range steps {
+		if s.Kind == ledger.StepKindApply && s.Mode != apply.ModePatch {
+			out = out[:0]
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// applySteps returns the unapplied steps that left a workspace snapshot, as
+// the commits of the per-step apply modes; see stepCommits.
+func applySteps(t *task.Task, ledgerManager *ledger.Manager) ([]apply.Step, error) {
+	steps, err := unappliedSteps(ledgerManager)
+	if err != nil {
+		return nil, err
+	}
+	return stepCommits(t, steps), nil
+}
+
+// stepCommits returns the commits of the per-step apply modes for steps, one
+// per workspace snapshot. Snapshots taken before a sync are based on the old
+// base, so a sync replaces them with its own snapshot. A rollback drops the
+// snapshots it discarded: back to its target step, or all of them for a
+// rollback to base. A target from before the last apply or sync is no longer
+// among them, so the rollback is then committed like any other step.
+func stepCommits(t *task.Task, steps []*ledger.Step) []apply.Step {
+	out := []apply.Step{}
+	ids := []string{}
+	// restored maps a rollback that dropped snapshots to the step whose
+	// snapshot it restored, for rollbacks to that rollback.
+	restored := map[string]string{}
+	for _, s := range steps {
+		switch s.Kind {
+		case ledger.StepKindSync:
+			out, ids = out[:0], ids[:0]
+		case ledger.StepKindRollback:
+			if s.TargetStep == "" {
+				out, ids = out[:0], ids[:0]
+				continue
+			}
+			target := s.TargetStep
+			if id, ok := restored[target]; ok {
+				target = id
+			}
+			if i := slices.Index(ids, target); i >= 0 {
+				out, ids = out[:i+1], ids[:i+1]
+				restored[s.StepID] = target
+				continue
+			}
+		}
+		if s.Snapshot != "" {
+			out = append(out, apply.Step{Snapshot: s.Snapshot, Message: stepCommitMessage(t, s), StepID: s.StepID})
+			ids = append(ids, s.StepID)
+		}
+	}
+	return out
+}
+
+// snapshotSecrets scans what each step commit adds to the one before it, the
+// first to the task branch head, and returns a "warn" event for each possible
+// secret, matched as "step <id>: <file>:<line>". Snapshots are commits of the
+// raw workspace: a secret a later step removed, or that was only redacted
+// from the step patches, is still in them.
+func snapshotSecrets(app *App, t *task.Task, steps []apply.Step) ([]ledger.PolicyEvent, error) {
+	if app.DiffEngine.Scanner == nil || len(steps) == 0 {
+		return nil, nil
+	}
+	from, err := app.Git.Run(t.WorkspacePath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	events := []ledger.PolicyEvent{}
+	for _, s := range steps {
+		result, err := app.DiffEngine.Between(t.WorkspacePath, from, s.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range secretPolicyEvents(result.Secrets, "warn") {
+			ev.Matched = "step " + s.StepID + ": " + ev.Matched
+			events = append(events, ev)
+		}
+		from = s.Snapshot
+	}
+	return events, nil
+}
+
+// stepCommitMessage describes a step in its per-step commit: the command it
+// ran as the subject, with trailers naming the task and step.
+func stepCommitMessage(t *task.Task, s *ledger.Step) string {
+	subject := trim(strings.Join(s.Cmd, " "), 72)
+	if s.Kind == ledger.StepKindRollback {
+		subject = "Roll back to base"
+		if s.TargetStep != "" {
+			subject = "Roll back to step " + s.TargetStep
+		}
+	}
+	if s.Kind == ledger.StepKindSync {
+		subject = "Changes before syncing with " + t.BaseRef
+	}
+	return fmt.Sprintf("%s\n\nBar-Task: %s (%s)\nBar-Step: %s", subject, t.Name, t.ID, s.StepID)
+}
+
+// writePatchSeries writes the task as a patch series into the artifacts of
+// the apply step and, when output is set, copies it there. It returns the
+// artifact paths.
+func writePatchSeries(app *App, t *task.Task, ledgerManager *ledger.Manager, stepID string, steps []apply.Step, message string, output string) ([]string, error) {
+	dir := filepath.Join(ledgerManager.TaskDir, "artifacts", stepID+".patches")
+	files, err := app.ApplyEngine.FormatPatch(t.WorkspacePath, steps, message, dir)
+	if err != nil {
+		return nil, err
+	}
+	if output != "" {
+		if err := os.MkdirAll(output, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	patches := []string{}
+	for _, f := range files {
+		if output != "" {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(filepath.Join(output, filepath.Base(f)), data, 0o644); err != nil {
+				return nil, err
+			}
+		}
+		patches = append(patches, filepath.Join("artifacts", stepID+".patches", filepath.Base(f)))
+	}
+	return patches, nil
+}
+
+// writePRDescription writes the pull request description of an apply to a
+// target branch as an artifact of the apply step and, when prFile is set,
+// to prFile too. It returns the artifact path.
+func writePRDescription(app *App, t *task.Task, ledgerManager *ledger.Manager, stepID string, branch string, message string, stat *ledger.DiffStat, prFile string) (string, error) {
+	steps, err := unappliedSteps(ledgerManager)
+	if err != nil {
+		return "", err
+	}
+	content := []byte(renderPRDescription(t, branch, message, stat, app.Config.Gates, steps))
+	artifactsDir := filepath.Join(ledgerManager.TaskDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, stepID+".pr.md"), content, 0o644); err != nil {
+		return "", err
+	}
+	if prFile != "" {
+		if err := os.WriteFile(prFile, content, 0o644); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join("artifacts", stepID+".pr.md"), nil
+}
+
+// checkApplyDiff evaluates the path and limit rules against everything the
+// task changed. A "block" match fails the apply; "confirm" matches ask the user and
+// report whether to proceed, failing when there is no terminal to ask on.
+func checkApplyDiff(app *App, result *diff.Result) ([]ledger.PolicyEvent, bool, error) {
+	res, err := app.PolicyEngine.CheckDiff(result)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, ev := range res.Events {
+		if ev.Action == "block" {
+			return nil, false, barerrors.ApplyBlockedByPolicy(ev.Rule, ev.Reason, ev.Matched, ev.Files)
+		}
+	}
+	for _, ev := range res.Events {
+		if ev.Action == "warn" {
+			app.Logger.Info("Policy warning: rule '%s' matched (%s)", ev.Rule, ev.Matched)
+		}
+	}
+	confirms := res.Confirmations()
+	if len(confirms) > 0 {
+		if !isInteractive() {
+			return nil, false, barerrors.PolicyConfirmationRequired(confirms[0].Rule, confirms[0].Files)
+		}
+		g := newGuide()
+		g.Print("")
+		for _, ev := range confirms {
+			g.Printf("⚠️  Policy rule '%s' requires confirmation: %s\n", ev.Rule, strings.Join(ev.Files, ", "))
+			if ev.Reason != "" {
+				g.Printf("   %s\n", ev.Reason)
+			}
+		}
+		g.Print("")
+		confirmed, err := g.Prompt().Confirm("Apply these changes anyway?")
+		if err != nil {
+			return nil, false, err
+		}
+		if !confirmed {
+			return nil, false, nil
+		}
+	}
+	return policyEvents(res.Events), true, nil
+}
+
 func rollbackCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "rollback",
@@ -217,20 +697,39 @@ func rollbackCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if err := checkNoSync(app, task); err != nil {
+				return err
+			}
 			stepID, _ := cmd.Flags().GetString("step")
 			base, _ := cmd.Flags().GetBool("base")
 			hard, _ := cmd.Flags().GetBool("hard")
 			force, _ := cmd.Flags().GetBool("force")
-			if stepID != "" && !base {
-				return barerrors.RollbackNotSupported()
+			if stepID == "" && !base {
+				return barerrors.RollbackRequiresBase()
 			}
+			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
+			ledgerManager := ledger.NewManager(taskDir)
+			var target *ledger.Step
 			if !base {
-				return barerrors.RollbackRequiresBase()
+				target, err = ledgerManager.GetByID(stepID)
+				if err != nil {
+					return err
+				}
+				if target == nil {
+					return barerrors.StepNotFound(stepID)
+				}
+				if target.Snapshot == "" {
+					return barerrors.SnapshotNotFound(stepID)
+				}
 			}
-			if hard && !force && isInteractive() {
+			if (hard || target != nil) && !force && isInteractive() {
 				g := newGuide()
 				g.Print("")
-				g.Print("⚠️  Warning: --hard will discard ALL uncommitted changes!")
+				if target != nil {
+					g.Printf("⚠️  Warning: changes made after step %s will be discarded!\n", stepID)
+				} else {
+					g.Print("⚠️  Warning: --hard will discard ALL uncommitted changes!")
+				}
 				g.Print("")
 				confirmed, err := g.Prompt().Confirm("Are you sure you want to continue?")
 				if err != nil {
@@ -241,29 +740,52 @@ func rollbackCmd() *cobra.Command {
 					return nil
 				}
 			}
-			if err := app.WorkspaceManager.Reset(task.WorkspacePath, task.BaseRef, hard); err != nil {
-				return err
-			}
-			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
-			ledgerManager := ledger.NewManager(taskDir)
-			nextID, err := ledgerManager.NextStepID()
-			if err != nil {
-				return err
+			if target != nil {
+				if err := app.WorkspaceManager.Restore(task.WorkspacePath, target.Snapshot); err != nil {
+					return err
+				}
+			} else {
+				if err := app.WorkspaceManager.Reset(task.WorkspacePath, task.BaseRef, hard); err != nil {
+					return err
+				}
 			}
 			h := hard
 			now := time.Now().UTC()
-			step := &ledger.Step{
-				StepID:     nextID,
-				Kind:       ledger.StepKindRollback,
-				StartedAt:  now,
-				EndedAt:    now,
-				Target:     "base",
-				TargetStep: stepID,
-				Hard:       &h,
-			}
-			if err := ledgerManager.Append(step); err != nil {
+			_, err = ledgerManager.AppendNext(func(stepID string) (*ledger.Step, error) {
+				step := &ledger.Step{
+					StepID:    stepID,
+					Kind:      ledger.StepKindRollback,
+					StartedAt: now,
+					EndedAt:   now,
+					Target:    "base",
+					Hard:      &h,
+				}
+				step.SnapshotRef = workspace.SnapshotRef(task.ID, stepID)
+				if target != nil {
+					step.Target = "step"
+					step.TargetStep = target.StepID
+					step.Snapshot = target.Snapshot
+					if err := app.WorkspaceManager.KeepSnapshot(step.SnapshotRef, step.Snapshot); err != nil {
+						return nil, err
+					}
+					return step, nil
+				}
+				// Later step deltas are taken against the reset workspace,
+				// which keeps untracked files unless --hard.
+				snapshot, err := app.WorkspaceManager.Snapshot(task.WorkspacePath, step.SnapshotRef, "bar: snapshot step "+stepID)
+				if err != nil {
+					return nil, err
+				}
+				step.Snapshot = snapshot
+				return step, nil
+			})
+			if err != nil {
 				return err
 			}
+			if target != nil {
+				app.Logger.Info("Rolled back to step %s", target.StepID)
+				return nil
+			}
 			app.Logger.Info("Rolled back to base")
 			return nil
 		},
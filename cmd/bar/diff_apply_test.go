@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+)
+
+func runStep(id, snapshot string) *ledger.Step {
+	return &ledger.Step{StepID: id, Kind: ledger.StepKindRun, Cmd: []string{"agent", id}, Snapshot: snapshot}
+}
+
+func rollbackStep(id, target, snapshot string) *ledger.Step {
+	return &ledger.Step{StepID: id, Kind: ledger.StepKindRollback, TargetStep: target, Snapshot: snapshot}
+}
+
+func TestStepCommits(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []*ledger.Step
+		want  []string
+	}{
+		{
+			name:  "runs",
+			steps: []*ledger.Step{runStep("0001", "s1"), runStep("0002", "s2"), {StepID: "0003", Kind: ledger.StepKindGate}},
+			want:  []string{"s1", "s2"},
+		},
+		{
+			name:  "rollback to a step",
+			steps: []*ledger.Step{runStep("0001", "s1"), runStep("0002", "s2"), rollbackStep("0003", "0001", "s1")},
+			want:  []string{"s1"},
+		},
+		{
+			name: "run after a rollback",
+			steps: []*ledger.Step{
+				runStep("0001", "s1"), runStep("0002", "s2"), rollbackStep("0003", "0001", "s1"), runStep("0004", "s4"),
+			},
+			want: []string{"s1", "s4"},
+		},
+		{
+			name:  "rollback to base",
+			steps: []*ledger.Step{runStep("0001", "s1"), runStep("0002", "s2"), rollbackStep("0003", "", ""), runStep("0004", "s4")},
+			want:  []string{"s4"},
+		},
+		{
+			name: "rollback to a rollback",
+			steps: []*ledger.Step{
+				runStep("0001", "s1"), runStep("0002", "s2"), rollbackStep("0003", "0001", "s1"),
+				runStep("0004", "s4"), rollbackStep("0005", "0003", "s1"),
+			},
+			want: []string{"s1"},
+		},
+		{
+			name: "rollback to before a sync",
+			steps: []*ledger.Step{
+				runStep("0001", "s1"), {StepID: "0002", Kind: ledger.StepKindSync, Snapshot: "s2"},
+				runStep("0003", "s3"), rollbackStep("0004", "0001", "s1"),
+			},
+			want: []string{"s2", "s3", "s1"},
+		},
+	}
+	tk := &task.Task{ID: "t1", Name: "demo", BaseRef: "main"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, s := range stepCommits(tk, tt.steps) {
+				got = append(got, s.Snapshot)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stepCommits snapshots = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
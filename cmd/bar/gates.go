@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+// runGates runs the configured quality gates one after another through the
+// shell in the task workspace, recording each as a "gate" step with its output
+// as an artifact. All gates run even when one fails, so a single apply reports
+// every failure; the first failed required gate is returned as a GateFailed
+// error, failed optional gates are only reported.
+func runGates(app *App, t *task.Task, ledgerManager *ledger.Manager) error {
+	var failed *ledger.Step
+	for _, gate := range app.Config.Gates {
+		step, err := runGate(app, t, ledgerManager, gate)
+		if err != nil {
+			return err
+		}
+		switch {
+		case *step.ExitCode == 0:
+			app.Logger.Info("Gate passed: %s (step %s)", gate.Name, step.StepID)
+		case gate.Optional:
+			app.Logger.Info("Gate warning: optional gate '%s' exited with code %d (step %s)", gate.Name, *step.ExitCode, step.StepID)
+		default:
+			app.Logger.Info("Gate failed: %s exited with code %d (step %s)", gate.Name, *step.ExitCode, step.StepID)
+			if failed == nil {
+				failed = step
+			}
+		}
+	}
+	if failed != nil {
+		return barerrors.GateFailed(failed.Gate, failed.StepID, *failed.ExitCode)
+	}
+	return nil
+}
+
+// runGate runs a single gate and appends its step to the ledger.
+func runGate(app *App, t *task.Task, ledgerManager *ledger.Manager, gate config.Gate) (*ledger.Step, error) {
+	var timeout time.Duration
+	if gate.Timeout != "" {
+		d, err := time.ParseDuration(gate.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("gate %s: invalid timeout %q: %w", gate.Name, gate.Timeout, err)
+		}
+		timeout = d
+	}
+	app.Logger.Info("Running gate %s: %s", gate.Name, gate.Cmd)
+	startedAt := time.Now().UTC()
+	opts := execOptions(timeout, t.WorkspacePath, map[string]string{"BAR_GATE": gate.Name})
+	opts.Stdin = nil
+	result, err := app.ExecRunner.Run(context.Background(), []string{"sh", "-c", gate.Cmd}, &opts)
+	if err != nil {
+		return nil, barerrors.CommandFailed(gate.Cmd, err)
+	}
+	return ledgerManager.AppendNext(func(stepID string) (*ledger.Step, error) {
+		artifactsDir := filepath.Join(ledgerManager.TaskDir, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := writeOutput(filepath.Join(artifactsDir, stepID+".output"), result.Stdout, result.Stderr); err != nil {
+			return nil, err
+		}
+		exitCode := result.ExitCode
+		return &ledger.Step{
+			StepID:       stepID,
+			Kind:         ledger.StepKindGate,
+			StartedAt:    startedAt,
+			EndedAt:      startedAt.Add(result.Duration),
+			DurationMs:   result.Duration.Milliseconds(),
+			Cmd:          []string{"sh", "-c", gate.Cmd},
+			Cwd:          t.WorkspacePath,
+			ExitCode:     &exitCode,
+			Gate:         gate.Name,
+			GateOptional: gate.Optional,
+			Artifacts:    &ledger.Artifacts{Output: filepath.Join("artifacts", stepID+".output")},
+		}, nil
+	})
+}
+
+// gateStatus is the latest result of a configured gate.
+type gateStatus struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+	// Status is "passed", "failed", "stale" (the workspace changed after the
+	// gate last ran) or "not run".
+	Status   string `json:"status"`
+	StepID   string `json:"step_id,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// gateStatuses reports the latest result of each configured gate in steps.
+func gateStatuses(gates []config.Gate, steps []*ledger.Step) []gateStatus {
+	out := make([]gateStatus, 0, len(gates))
+	for _, gate := range gates {
+		gs := gateStatus{Name: gate.Name, Optional: gate.Optional, Status: "not run"}
+		stale := false
+		for i := len(steps) - 1; i >= 0; i-- {
+			s := steps[i]
+			if s.Kind != ledger.StepKindGate || s.Gate != gate.Name {
+				stale = stale || s.Snapshot != ""
+				continue
+			}
+			gs.StepID = s.StepID
+			gs.ExitCode = s.ExitCode
+			switch {
+			case stale:
+				gs.Status = "stale"
+			case s.ExitCode != nil && *s.ExitCode == 0:
+				gs.Status = "passed"
+			default:
+				gs.Status = "failed"
+			}
+			break
+		}
+		out = append(out, gs)
+	}
+	return out
+}
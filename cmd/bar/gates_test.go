@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/exec"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+	utillog "github.com/user/blade-agent-runtime/internal/util/log"
+)
+
+func TestRunGates(t *testing.T) {
+	ws := t.TempDir()
+	ledgerManager := ledger.NewManager(t.TempDir())
+	app := &App{
+		Config:     &config.Config{},
+		Logger:     utillog.New(io.Discard, io.Discard, false, false),
+		ExecRunner: exec.NewRunner(),
+	}
+	app.Config.Gates = []config.Gate{
+		{Name: "style", Cmd: "exit 1", Optional: true},
+		{Name: "test", Cmd: "exit 2"},
+		{Name: "lint", Cmd: "exit 3"},
+		{Name: "build", Cmd: `echo "$BAR_GATE" > gate.txt`},
+	}
+	tk := &task.Task{ID: "t1", WorkspacePath: ws}
+
+	// Every gate runs, the first failed required one is reported
+	err := runGates(app, tk, ledgerManager)
+	var barErr *barerrors.BarError
+	if !errors.As(err, &barErr) || barErr.Code != barerrors.ErrGateFailed {
+		t.Fatalf("expected a GateFailed error, got %v", err)
+	}
+	if want := barerrors.GateFailed("test", "0002", 2).Message; barErr.Message != want {
+		t.Errorf("error = %q, want %q", barErr.Message, want)
+	}
+	steps, err := ledgerManager.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 4 {
+		t.Fatalf("expected a gate step per gate, got %d", len(steps))
+	}
+	if s := steps[0]; s.Kind != ledger.StepKindGate || s.Gate != "style" || !s.GateOptional || *s.ExitCode != 1 || s.Cwd != ws {
+		t.Errorf("unexpected gate step %+v", s)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "gate.txt")); string(data) != "build\n" {
+		t.Errorf("expected BAR_GATE in the gate environment, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(ledgerManager.TaskDir, steps[3].Artifacts.Output)); err != nil {
+		t.Errorf("expected the gate output artifact: %v", err)
+	}
+
+	// A failed optional gate alone does not fail
+	app.Config.Gates = []config.Gate{{Name: "style", Cmd: "exit 1", Optional: true}}
+	if err := runGates(app, tk, ledgerManager); err != nil {
+		t.Errorf("expected a failed optional gate to pass, got %v", err)
+	}
+
+	app.Config.Gates = []config.Gate{{Name: "slow", Cmd: "true", Timeout: "soon"}}
+	if err := runGates(app, tk, ledgerManager); err == nil {
+		t.Error("expected an invalid timeout to fail")
+	}
+}
+
+func TestGateStatuses(t *testing.T) {
+	ok, bad := 0, 1
+	gates := []config.Gate{{Name: "test"}, {Name: "lint", Optional: true}}
+	tests := []struct {
+		name  string
+		gates []config.Gate
+		steps []*ledger.Step
+		want  []gateStatus
+	}{
+		{
+			name:  "no gates configured",
+			steps: []*ledger.Step{{StepID: "0001", Kind: ledger.StepKindGate, Gate: "test", ExitCode: &ok}},
+			want:  []gateStatus{},
+		},
+		{
+			name:  "not run",
+			gates: gates,
+			steps: []*ledger.Step{{StepID: "0001", Kind: ledger.StepKindRun, Snapshot: "s1"}},
+			want:  []gateStatus{{Name: "test", Status: "not run"}, {Name: "lint", Optional: true, Status: "not run"}},
+		},
+		{
+			name:  "latest result wins",
+			gates: gates,
+			steps: []*ledger.Step{
+				{StepID: "0001", Kind: ledger.StepKindGate, Gate: "test", ExitCode: &ok},
+				{StepID: "0002", Kind: ledger.StepKindGate, Gate: "lint", ExitCode: &ok},
+				{StepID: "0003", Kind: ledger.StepKindGate, Gate: "test", ExitCode: &bad},
+			},
+			want: []gateStatus{
+				{Name: "test", Status: "failed", StepID: "0003", ExitCode: &bad},
+				{Name: "lint", Optional: true, Status: "passed", StepID: "0002", ExitCode: &ok},
+			},
+		},
+		{
+			name:  "steps without a snapshot keep results fresh",
+			gates: gates[:1],
+			steps: []*ledger.Step{
+				{StepID: "0001", Kind: ledger.StepKindGate, Gate: "test", ExitCode: &ok},
+				{StepID: "0002", Kind: ledger.StepKindRun, ExitCode: &bad},
+				{StepID: "0003", Kind: ledger.StepKindGate, Gate: "other", ExitCode: &bad},
+			},
+			want: []gateStatus{{Name: "test", Status: "passed", StepID: "0001", ExitCode: &ok}},
+		},
+		{
+			name:  "a later snapshot makes results stale",
+			gates: gates[:1],
+			steps: []*ledger.Step{
+				{StepID: "0001", Kind: ledger.StepKindGate, Gate: "test", ExitCode: &bad},
+				{StepID: "0002", Kind: ledger.StepKindRun, Snapshot: "s2"},
+			},
+			want: []gateStatus{{Name: "test", Status: "stale", StepID: "0001", ExitCode: &bad}},
+		},
+		{
+			name:  "no exit code is a failure",
+			gates: gates[:1],
+			steps: []*ledger.Step{{StepID: "0001", Kind: ledger.StepKindGate, Gate: "test"}},
+			want:  []gateStatus{{Name: "test", Status: "failed", StepID: "0001"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gateStatuses(tt.gates, tt.steps)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gateStatuses() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+// hookCommands returns the configured commands of a hook phase.
+func hookCommands(app *App, phase string) []string {
+	if phase == ledger.HookPreRun {
+		return app.Config.Hooks.PreRun
+	}
+	return app.Config.Hooks.PostRun
+}
+
+// runHooks runs the hooks of phase one after another through the shell in
+// dir, with env added to their environment along with BAR_HOOK and
+// BAR_STEP_ID (and BAR_EXIT_CODE after the step's command). Their output goes
+// to the terminal and, when the step is recorded (ledgerManager is not nil),
+// to an artifact of the step; their results are appended to step.Hooks.
+// Pre-run hooks stop at the first failure, which is returned as a HookFailed
+// error after the results are recorded; post-run failures are left to
+// checkPostRunHooks.
+func runHooks(app *App, ledgerManager *ledger.Manager, step *ledger.Step, phase string, dir string, env map[string]string) error {
+	commands := hookCommands(app, phase)
+	if len(commands) == 0 {
+		return nil
+	}
+	hookEnv := map[string]string{"BAR_HOOK": phase, "BAR_STEP_ID": step.StepID}
+	for k, v := range env {
+		hookEnv[k] = v
+	}
+	if phase == ledger.HookPostRun && step.ExitCode != nil {
+		hookEnv["BAR_EXIT_CODE"] = strconv.Itoa(*step.ExitCode)
+	}
+	for i, command := range commands {
+		app.Logger.Info("Running %s hook: %s", phase, command)
+		opts := execOptions(0, dir, hookEnv)
+		opts.Stdin = nil
+		result, err := app.ExecRunner.Run(context.Background(), []string{"sh", "-c", command}, &opts)
+		if err != nil {
+			return barerrors.CommandFailed(command, err)
+		}
+		hook := ledger.HookResult{
+			Phase:      phase,
+			Cmd:        command,
+			ExitCode:   result.ExitCode,
+			DurationMs: result.Duration.Milliseconds(),
+		}
+		if ledgerManager != nil {
+			name := fmt.Sprintf("%s.%s.%d.output", step.StepID, phase, i+1)
+			artifactsDir := filepath.Join(ledgerManager.TaskDir, "artifacts")
+			if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
+				return err
+			}
+			if err := writeOutput(filepath.Join(artifactsDir, name), result.Stdout, result.Stderr); err != nil {
+				return err
+			}
+			hook.Output = filepath.Join("artifacts", name)
+			if step.Artifacts == nil {
+				step.Artifacts = &ledger.Artifacts{}
+			}
+			step.Artifacts.Hooks = append(step.Artifacts.Hooks, hook.Output)
+		}
+		step.Hooks = append(step.Hooks, hook)
+		if hook.Failed() && phase == ledger.HookPreRun {
+			return barerrors.HookFailed(phase, command, hook.ExitCode)
+		}
+	}
+	return nil
+}
+
+// checkPostRunHooks applies hooks.post_run_failure to the failed post-run
+// hooks of step: "fail" gives a successful step the exit code of the first
+// failed hook, "block" only reports that 'bar apply' will refuse the task.
+func checkPostRunHooks(app *App, step *ledger.Step) {
+	for _, h := range step.Hooks {
+		if h.Phase != ledger.HookPostRun || !h.Failed() {
+			continue
+		}
+		switch app.Config.Hooks.PostRunFailure {
+		case config.HookFailureFail:
+			if step.ExitCode != nil && *step.ExitCode == 0 {
+				exit := h.ExitCode
+				step.ExitCode = &exit
+			}
+			app.Logger.Info("Hook failed: post_run hook '%s' exited with code %d; step marked as failed", h.Cmd, h.ExitCode)
+		case config.HookFailureBlock:
+			app.Logger.Info("Hook failed: post_run hook '%s' exited with code %d; 'bar apply' will be blocked", h.Cmd, h.ExitCode)
+		default:
+			app.Logger.Info("Hook warning: post_run hook '%s' exited with code %d", h.Cmd, h.ExitCode)
+		}
+	}
+}
+
+// checkApplyHooks refuses to apply a task whose latest post-run hooks failed
+// when hooks.post_run_failure is "block".
+func checkApplyHooks(app *App, ledgerManager *ledger.Manager) error {
+	if app.Config.Hooks.PostRunFailure != config.HookFailureBlock {
+		return nil
+	}
+	step, err := ledgerManager.LastHooks(ledger.HookPostRun)
+	if err != nil || step == nil {
+		return err
+	}
+	for _, h := range step.Hooks {
+		if h.Phase == ledger.HookPostRun && h.Failed() {
+			return barerrors.ApplyBlockedByHook(step.StepID, h.Cmd, h.ExitCode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/exec"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+	utillog "github.com/user/blade-agent-runtime/internal/util/log"
+)
+
+func hooksApp(failure string) *App {
+	cfg := &config.Config{}
+	cfg.Hooks.PostRunFailure = failure
+	return &App{Config: cfg, Logger: utillog.New(io.Discard, io.Discard, false, false), ExecRunner: exec.NewRunner()}
+}
+
+func TestRunHooks_PreRunStopsAtFirstFailure(t *testing.T) {
+	dir := t.TempDir()
+	ledgerManager := ledger.NewManager(t.TempDir())
+	app := hooksApp(config.HookFailureWarn)
+	app.Config.Hooks.PreRun = []string{`echo "$BAR_HOOK $BAR_STEP_ID $BAR_TASK_ID" > env.txt`, "exit 3", "touch after.txt"}
+	step := &ledger.Step{StepID: "0001", Kind: ledger.StepKindRun}
+
+	err := runHooks(app, ledgerManager, step, ledger.HookPreRun, dir, map[string]string{"BAR_TASK_ID": "t1"})
+	var barErr *barerrors.BarError
+	if !errors.As(err, &barErr) || barErr.Code != barerrors.ErrHookFailed {
+		t.Fatalf("expected a HookFailed error, got %v", err)
+	}
+	if len(step.Hooks) != 2 || step.Hooks[1].ExitCode != 3 {
+		t.Fatalf("expected the results up to the failed hook, got %+v", step.Hooks)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "after.txt")); err == nil {
+		t.Error("expected the hooks after the failure not to run")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "env.txt")); strings.TrimSpace(string(data)) != "pre_run 0001 t1" {
+		t.Errorf("unexpected hook environment %q", data)
+	}
+	if step.Artifacts == nil || len(step.Artifacts.Hooks) != 2 {
+		t.Fatalf("expected an output artifact per hook, got %+v", step.Artifacts)
+	}
+	if _, err := os.Stat(filepath.Join(ledgerManager.TaskDir, step.Artifacts.Hooks[1])); err != nil {
+		t.Errorf("expected the hook output at %s: %v", step.Artifacts.Hooks[1], err)
+	}
+}
+
+func TestRunHooks_PostRunRunsAll(t *testing.T) {
+	dir := t.TempDir()
+	app := hooksApp(config.HookFailureWarn)
+	app.Config.Hooks.PostRun = []string{"exit 2", `echo "$BAR_EXIT_CODE" > exit.txt`}
+	exit := 7
+	step := &ledger.Step{StepID: "0001", Kind: ledger.StepKindRun, ExitCode: &exit}
+
+	// Without a ledger (an unrecorded step) no artifacts are written
+	if err := runHooks(app, nil, step, ledger.HookPostRun, dir, nil); err != nil {
+		t.Fatalf("expected post_run failures to be left to checkPostRunHooks, got %v", err)
+	}
+	if len(step.Hooks) != 2 || !step.Hooks[0].Failed() || step.Hooks[1].Failed() {
+		t.Fatalf("expected both hooks to run, got %+v", step.Hooks)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "exit.txt")); strings.TrimSpace(string(data)) != "7" {
+		t.Errorf("expected BAR_EXIT_CODE=7, got %q", data)
+	}
+	if step.Artifacts != nil {
+		t.Errorf("expected no artifacts without a ledger, got %+v", step.Artifacts)
+	}
+}
+
+func TestCheckPostRunHooks(t *testing.T) {
+	exitCode := func(code int) *int { return &code }
+	tests := []struct {
+		name    string
+		failure string
+		exit    *int
+		hooks   []ledger.HookResult
+		want    *int
+	}{
+		{
+			name:    "warn keeps the exit code",
+			failure: config.HookFailureWarn,
+			exit:    exitCode(0),
+			hooks:   []ledger.HookResult{{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 2}},
+			want:    exitCode(0),
+		},
+		{
+			name:    "block keeps the exit code",
+			failure: config.HookFailureBlock,
+			exit:    exitCode(0),
+			hooks:   []ledger.HookResult{{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 2}},
+			want:    exitCode(0),
+		},
+		{
+			name:    "fail takes the first failed hook's code",
+			failure: config.HookFailureFail,
+			exit:    exitCode(0),
+			hooks: []ledger.HookResult{
+				{Phase: ledger.HookPostRun, Cmd: "fmt", ExitCode: 0},
+				{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 2},
+				{Phase: ledger.HookPostRun, Cmd: "vet", ExitCode: 5},
+			},
+			want: exitCode(2),
+		},
+		{
+			name:    "fail keeps the command's own failure",
+			failure: config.HookFailureFail,
+			exit:    exitCode(1),
+			hooks:   []ledger.HookResult{{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 2}},
+			want:    exitCode(1),
+		},
+		{
+			name:    "fail leaves an interrupted step without exit code",
+			failure: config.HookFailureFail,
+			hooks:   []ledger.HookResult{{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 2}},
+		},
+		{
+			name:    "fail ignores pre_run hooks",
+			failure: config.HookFailureFail,
+			exit:    exitCode(0),
+			hooks:   []ledger.HookResult{{Phase: ledger.HookPreRun, Cmd: "setup", ExitCode: 3}},
+			want:    exitCode(0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &ledger.Step{StepID: "0001", Kind: ledger.StepKindRun, ExitCode: tt.exit, Hooks: tt.hooks}
+			checkPostRunHooks(hooksApp(tt.failure), step)
+			switch {
+			case tt.want == nil && step.ExitCode != nil:
+				t.Errorf("exit code = %d, want none", *step.ExitCode)
+			case tt.want != nil && (step.ExitCode == nil || *step.ExitCode != *tt.want):
+				t.Errorf("exit code = %v, want %d", step.ExitCode, *tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckApplyHooks(t *testing.T) {
+	ledgerManager := ledger.NewManager(t.TempDir())
+	app := hooksApp(config.HookFailureBlock)
+	blocked := func() bool {
+		err := checkApplyHooks(app, ledgerManager)
+		var barErr *barerrors.BarError
+		if err != nil && !(errors.As(err, &barErr) && barErr.Code == barerrors.ErrHookFailed) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return err != nil
+	}
+
+	if blocked() {
+		t.Fatal("expected no block without hooks")
+	}
+	// A failed pre_run hook stops its step, it does not block apply
+	ledgerManager.Append(&ledger.Step{StepID: "0001", Kind: ledger.StepKindRun,
+		Hooks: []ledger.HookResult{{Phase: ledger.HookPreRun, Cmd: "setup", ExitCode: 1}}})
+	if blocked() {
+		t.Error("expected a failed pre_run hook not to block apply")
+	}
+	ledgerManager.Append(&ledger.Step{StepID: "0002", Kind: ledger.StepKindRun,
+		Hooks: []ledger.HookResult{{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 1}}})
+	if !blocked() {
+		t.Fatal("expected the failed post_run hook to block apply")
+	}
+	// Steps that run no hooks, like a rollback, keep the block
+	ledgerManager.Append(&ledger.Step{StepID: "0003", Kind: ledger.StepKindRollback, TargetStep: "0001"})
+	if !blocked() {
+		t.Error("expected a step without hooks to keep the block")
+	}
+
+	app.Config.Hooks.PostRunFailure = config.HookFailureWarn
+	if blocked() {
+		t.Error("expected no block with warn")
+	}
+
+	app.Config.Hooks.PostRunFailure = config.HookFailureBlock
+	ledgerManager.Append(&ledger.Step{StepID: "0004", Kind: ledger.StepKindRun,
+		Hooks: []ledger.HookResult{{Phase: ledger.HookPostRun, Cmd: "lint", ExitCode: 0}}})
+	if blocked() {
+		t.Error("expected the passing hook to clear the block")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/user/blade-agent-runtime/internal/completion"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+	utilpath "github.com/user/blade-agent-runtime/internal/util/path"
+)
+
+func ledgerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ledger",
+		Short: "Verify and sign task ledgers",
+	}
+	cmd.AddCommand(ledgerVerifyCmd())
+	cmd.AddCommand(ledgerSignCmd())
+	return cmd
+}
+
+func ledgerKeyPath() string {
+	return filepath.Join(utilpath.GlobalBarDir(), "ledger.key")
+}
+
+func ledgerVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify [task_id|name]",
+		Short: "Check the ledger hash chain and artifact hashes",
+		Long: `Walk ledger.jsonl and report broken hash links, modified records, and
+missing or modified patch/output artifacts. If the ledger was signed with
+'bar ledger sign', the signature over the chain head is checked as well.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: ledgerTaskCompletion,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := initApp(true)
+			if err != nil {
+				return err
+			}
+			t, err := ledgerTask(app, args)
+			if err != nil {
+				return err
+			}
+			trusted, err := ledger.PublicKeyHex(ledgerKeyPath())
+			if err != nil {
+				return err
+			}
+			ledgerManager := ledger.NewManager(filepath.Join(app.BarDir, "tasks", t.ID))
+			report, err := ledgerManager.Verify(trusted)
+			if err != nil {
+				return err
+			}
+			format, _ := cmd.Flags().GetString("format")
+			if format == "json" {
+				data, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(data))
+			} else {
+				for _, issue := range report.Issues {
+					if issue.Line > 0 {
+						app.Logger.Error("line %d (step %s): %s: %s", issue.Line, issue.StepID, issue.Kind, issue.Detail)
+					} else {
+						app.Logger.Error("%s: %s", issue.Kind, issue.Detail)
+					}
+				}
+				app.Logger.Info("Records: %d (legacy, unhashed: %d)", report.Records, report.Legacy)
+				if report.Head != "" {
+					app.Logger.Info("Head:    %s", report.Head)
+				}
+				if report.Signed && report.SignedRecords > 0 {
+					app.Logger.Info("Signed:  first %d record(s)", report.SignedRecords)
+				}
+			}
+			if !report.OK() {
+				return barerrors.LedgerTampered(len(report.Issues))
+			}
+			if format != "json" {
+				app.Logger.Info("Ledger OK")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("format", "text", "output format (text/json)")
+	return cmd
+}
+
+func ledgerSignCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sign [task_id|name]",
+		Short: "Sign the ledger chain head with the local key",
+		Long: `Sign the current ledger chain head with the ed25519 key in ~/.bar/ledger.key
+(created on first use) and store the signature in the task's ledger.sig.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: ledgerTaskCompletion,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := initApp(true)
+			if err != nil {
+				return err
+			}
+			t, err := ledgerTask(app, args)
+			if err != nil {
+				return err
+			}
+			key, err := ledger.LoadOrCreateKey(ledgerKeyPath())
+			if err != nil {
+				return err
+			}
+			ledgerManager := ledger.NewManager(filepath.Join(app.BarDir, "tasks", t.ID))
+			sig, err := ledgerManager.Sign(key)
+			if err != nil {
+				return err
+			}
+			app.Logger.Info("Signed %d record(s), head %s", sig.Records, sig.Head)
+			app.Logger.Info("Public key: %s", sig.PublicKey)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func ledgerTask(app *App, args []string) (*task.Task, error) {
+	if len(args) == 0 {
+		return requireActiveTask(app)
+	}
+	t, err := app.TaskManager.Get(args[0])
+	if err != nil {
+		return app.TaskManager.ResolveByName(args[0])
+	}
+	return t, nil
+}
+
+func ledgerTaskCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	app, err := initApp(true)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	completions := completion.GetTaskCompletions(app.BarDir, true)
+	return completion.ToCobraCompletions(completions), cobra.ShellCompDirectiveNoFileComp
+}
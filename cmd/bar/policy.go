@@ -0,0 +1,540 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+func policyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Validate, test and inspect the policy",
+	}
+	cmd.PersistentFlags().String("file", "", "check this policy file alone instead of the merged policy layers")
+	cmd.AddCommand(policyValidateCmd())
+	cmd.AddCommand(policyTestCmd())
+	cmd.AddCommand(policyExplainCmd())
+	cmd.AddCommand(policyShowCmd())
+	return cmd
+}
+
+func policyValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the policy file for schema and pattern errors",
+		Long: `Parse each policy layer strictly and report unknown fields, unknown actions,
+patterns and globs that do not compile, duplicate rule names and rules that
+can never match, each with its file and line number.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := newApp(true, false)
+			if err != nil {
+				return err
+			}
+			format, _ := cmd.Flags().GetString("format")
+			type layerReport struct {
+				policy.Layer
+				Issues []policy.Issue `json:"issues"`
+			}
+			reports := []layerReport{}
+			errs, warnings, rules := 0, 0, 0
+			for _, layer := range policyLayersFor(cmd, app) {
+				data, err := os.ReadFile(layer.Path)
+				if err != nil {
+					if layer.Optional && os.IsNotExist(err) {
+						continue
+					}
+					return err
+				}
+				p, issues := policy.Validate(data)
+				reports = append(reports, layerReport{Layer: layer, Issues: issues})
+				n := policy.ErrorCount(issues)
+				errs += n
+				warnings += len(issues) - n
+				if p != nil {
+					rules += len(p.Rules)
+				}
+				if format != "json" {
+					for _, issue := range issues {
+						fmt.Println(policyIssueLine(layer.Path, issue))
+					}
+				}
+			}
+			if format == "json" {
+				data, _ := json.MarshalIndent(map[string]any{"layers": reports}, "", "  ")
+				fmt.Println(string(data))
+			}
+			if errs > 0 {
+				for _, r := range reports {
+					if policy.ErrorCount(r.Issues) > 0 {
+						return barerrors.PolicyInvalid(r.Path, errs)
+					}
+				}
+			}
+			if format != "json" {
+				app.Logger.Info("Policy OK: %d file(s), %d rule(s), %d warning(s)", len(reports), rules, warnings)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("format", "text", "output format (text|json)")
+	return cmd
+}
+
+func policyTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test -- <command> [args...]",
+		Short: "Show which rules a command would trigger and why",
+		Long: `Evaluate a command against the policy without running it. Every command
+rule is listed in evaluation order (by priority, then file order) with whether
+it matched and which command it matched, including commands run through
+wrappers like sudo or a 'sh -c' script.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, engine, err := policyEngineFor(cmd)
+			if err != nil {
+				return err
+			}
+			cwd, _ := cmd.Flags().GetString("cwd")
+			if cwd == "" {
+				cwd, _ = os.Getwd()
+			}
+			envFlags, _ := cmd.Flags().GetStringArray("env")
+			env := map[string]string{}
+			for _, kv := range envFlags {
+				if k, v, ok := strings.Cut(kv, "="); ok {
+					env[k] = v
+				}
+			}
+			res, traces, err := engine.Explain(policyCommand(args, cwd, env))
+			if err != nil {
+				return err
+			}
+			format, _ := cmd.Flags().GetString("format")
+			if format == "json" {
+				data, _ := json.MarshalIndent(map[string]any{"allowed": res.Allowed, "events": res.Events, "rules": traces}, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			lines := []string{"Command: " + strings.Join(args, " "), "", "Rules (evaluation order):"}
+			if len(traces) == 0 {
+				lines = append(lines, "  (no command rules)")
+			}
+			for _, tr := range traces {
+				lines = append(lines, renderTrace(tr, true))
+			}
+			lines = append(lines, "", "Result:  "+renderVerdict(res))
+			if !app.Config.Policy.Enabled {
+				lines = append(lines, "", "Note: policy.enabled is false, so only the global layer is enforced.")
+			}
+			fmt.Println(strings.Join(lines, "\n"))
+			return nil
+		},
+	}
+	cmd.Flags().String("cwd", "", "working directory to evaluate cwd matches against (default: current directory)")
+	cmd.Flags().StringArray("env", []string{}, "environment variables (KEY=VALUE) to evaluate env matches against")
+	cmd.Flags().String("format", "text", "output format (text|json)")
+	return cmd
+}
+
+// policyExplanation is the result of re-evaluating a ledger step.
+type policyExplanation struct {
+	StepID   string               `json:"step_id"`
+	Commands []commandExplanation `json:"commands"`
+	Diff     []policy.Event       `json:"diff_events"`
+	Recorded []ledger.PolicyEvent `json:"recorded"`
+	Current  []ledger.PolicyEvent `json:"current"`
+	// Added fire under the current policy but were not recorded; Removed
+	// were recorded but no longer fire.
+	Added   []ledger.PolicyEvent `json:"added"`
+	Removed []ledger.PolicyEvent `json:"removed"`
+}
+
+type commandExplanation struct {
+	Cmd     []string       `json:"cmd"`
+	SubStep bool           `json:"sub_step,omitempty"`
+	Allowed bool           `json:"allowed"`
+	Rules   []policy.Trace `json:"rules"`
+}
+
+func policyExplainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain <step_id>",
+		Short: "Re-evaluate a recorded step against the current policy",
+		Long: `Evaluate the command of a step of the active task, the commands it spawned
+during 'bar wrap', the files it changed and the secrets in its artifacts
+against the current policy, and compare the result with the policy events
+recorded when the step ran.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, engine, err := policyEngineFor(cmd)
+			if err != nil {
+				return err
+			}
+			t, err := requireActiveTask(app)
+			if err != nil {
+				return err
+			}
+			ledgerManager := ledger.NewManager(filepath.Join(app.BarDir, "tasks", t.ID))
+			step, err := ledgerManager.GetByID(args[0])
+			if err != nil {
+				return err
+			}
+			if step == nil {
+				return barerrors.StepNotFound(args[0])
+			}
+			ex, err := explainStep(app, engine, ledgerManager, step)
+			if err != nil {
+				return err
+			}
+			format, _ := cmd.Flags().GetString("format")
+			if format == "json" {
+				data, _ := json.MarshalIndent(ex, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			fmt.Println(renderExplanation(step, ex))
+			return nil
+		},
+	}
+	cmd.Flags().String("format", "text", "output format (text|json)")
+	return cmd
+}
+
+func policyShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective policy",
+		Long: `Print the policy bar enforces: the policy layers merged in order of
+precedence, with defaults filled in and rules listed in evaluation order, each
+annotated with the layer it comes from.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, engine, err := policyEngineFor(cmd)
+			if err != nil {
+				return err
+			}
+			enforced := "yes"
+			if !app.Config.Policy.Enabled {
+				enforced = "global layer only (policy.enabled is false)"
+			}
+			lines := []string{"# layers (lowest precedence first):"}
+			loaded := map[string]bool{}
+			for _, l := range engine.Layers {
+				loaded[l.Name] = true
+			}
+			for _, l := range policyLayersFor(cmd, app) {
+				state := ""
+				if !loaded[l.Name] {
+					state = "  (not found)"
+				}
+				lines = append(lines, fmt.Sprintf("#   %-8s %s%s", l.Name, l.Path, state))
+			}
+			lines = append(lines, "# enforced: "+enforced, "# confirm_timeout: "+app.Config.Policy.ConfirmTimeout)
+			if engine.Policy == nil {
+				fmt.Println(strings.Join(append(lines, "# no policy file found"), "\n"))
+				return nil
+			}
+			data, err := marshalEffectivePolicy(effectivePolicy(engine.Policy))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n%s", strings.Join(lines, "\n"), data)
+			return nil
+		},
+	}
+	return cmd
+}
+
+// policyLayersFor returns the policy layers the policy subcommands work on:
+// the file given with --file alone, or the layers of the active task.
+func policyLayersFor(cmd *cobra.Command, app *App) []policy.Layer {
+	if path, _ := cmd.Flags().GetString("file"); path != "" {
+		return []policy.Layer{{Name: "file", Path: path}}
+	}
+	active, _ := app.TaskManager.GetActive()
+	return policyLayers(app.RepoRoot, app.Config, active)
+}
+
+// policyEngineFor loads the policy layers of cmd into an engine, whether or
+// not the policy is enabled. An invalid layer is an error.
+func policyEngineFor(cmd *cobra.Command) (*App, *policy.Engine, error) {
+	app, err := newApp(true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	layers := policyLayersFor(cmd, app)
+	for _, layer := range layers {
+		data, err := os.ReadFile(layer.Path)
+		if err != nil {
+			if layer.Optional && os.IsNotExist(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		_, issues := policy.Validate(data)
+		if n := policy.ErrorCount(issues); n > 0 {
+			return nil, nil, barerrors.PolicyInvalid(layer.Path, n)
+		}
+	}
+	engine := policy.NewEngine()
+	if err := engine.Load(layers...); err != nil {
+		return nil, nil, err
+	}
+	return app, engine, nil
+}
+
+// policyIssueLine formats issue as "path:line: severity: ...".
+func policyIssueLine(path string, issue policy.Issue) string {
+	return path + ":" + strings.TrimPrefix(issue.String(), "line ")
+}
+
+// effectivePolicy returns a copy of p with the default mode filled in and the
+// rules in evaluation order.
+func effectivePolicy(p *policy.Policy) *policy.Policy {
+	out := *p
+	if out.Mode == "" {
+		out.Mode = policy.ModeDenylist
+	}
+	out.Rules = policy.SortRules(p.Rules)
+	return &out
+}
+
+// marshalEffectivePolicy renders p as YAML with a comment naming the layer
+// each rule, and the mode, comes from.
+func marshalEffectivePolicy(p *policy.Policy) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(p); err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		switch key.Value {
+		case "mode":
+			if p.ModeSource != "" {
+				value.LineComment = "from " + p.ModeSource
+			}
+		case "rules":
+			for j, rule := range value.Content {
+				if j < len(p.Rules) && p.Rules[j].Source != "" {
+					rule.HeadComment = "from " + p.Rules[j].Source
+				}
+			}
+		}
+	}
+	return yaml.Marshal(&doc)
+}
+
+func explainStep(app *App, engine *policy.Engine, ledgerManager *ledger.Manager, step *ledger.Step) (*policyExplanation, error) {
+	ex := &policyExplanation{
+		StepID:   step.StepID,
+		Commands: []commandExplanation{},
+		Recorded: step.PolicyEvents,
+		Current:  []ledger.PolicyEvent{},
+	}
+	if ex.Recorded == nil {
+		ex.Recorded = []ledger.PolicyEvent{}
+	}
+	evaluate := func(c policy.Command, subStep bool) error {
+		res, traces, err := engine.Explain(c)
+		if err != nil {
+			return err
+		}
+		ex.Commands = append(ex.Commands, commandExplanation{Cmd: c.Argv, SubStep: subStep, Allowed: res.Allowed, Rules: traces})
+		for _, ev := range policyEvents(res.Events) {
+			if subStep {
+				ev.Command = c.Argv
+			}
+			ex.Current = append(ex.Current, ev)
+		}
+		return nil
+	}
+	if len(step.Cmd) > 0 {
+		if err := evaluate(policy.Command{Argv: step.Cmd, Env: step.Env, Cwd: step.Cwd}, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, sub := range step.SubSteps {
+		if err := evaluate(policy.Command{Argv: sub.Cmd, Cwd: sub.Cwd}, true); err != nil {
+			return nil, err
+		}
+	}
+
+	stat := step.DeltaStat
+	if stat == nil {
+		stat = step.DiffStat
+	}
+	if stat != nil {
+		res, err := engine.CheckDiff(diffResultOf(stat))
+		if err != nil {
+			return nil, err
+		}
+		ex.Diff = res.Events
+		ex.Current = append(ex.Current, policyEvents(res.Events)...)
+	}
+
+	if app.Config.Diff.ScanSecrets && step.Artifacts != nil {
+		scanner, err := engine.SecretScanner()
+		if err != nil {
+			return nil, err
+		}
+		patch := step.Artifacts.DeltaPatch
+		if patch == "" {
+			patch = step.Artifacts.Patch
+		}
+		if data, err := os.ReadFile(filepath.Join(ledgerManager.TaskDir, patch)); patch != "" && err == nil {
+			ex.Current = append(ex.Current, secretPolicyEvents(scanner.ScanPatch(data), "block")...)
+		}
+		if step.Artifacts.Output != "" {
+			if data, err := os.ReadFile(filepath.Join(ledgerManager.TaskDir, step.Artifacts.Output)); err == nil {
+				for _, f := range scanner.ScanText(data) {
+					ex.Current = append(ex.Current, ledger.PolicyEvent{Rule: "secret:" + f.Rule, Action: "warn", Matched: "output " + f.Location()})
+				}
+			}
+		}
+	}
+
+	ex.Added = missingEvents(ex.Current, ex.Recorded)
+	ex.Removed = missingEvents(ex.Recorded, ex.Current)
+	return ex, nil
+}
+
+// diffResultOf rebuilds the parts of a diff.Result the path and limit rules
+// look at from a recorded diff stat.
+func diffResultOf(stat *ledger.DiffStat) *diff.Result {
+	result := &diff.Result{
+		Files:     stat.Files,
+		Additions: stat.Additions,
+		Deletions: stat.Deletions,
+		FileList:  stat.FileList,
+	}
+	for _, c := range stat.Changes {
+		result.Changes = append(result.Changes, diff.FileChange{
+			Path:      c.Path,
+			OldPath:   c.OldPath,
+			Status:    c.Status,
+			Additions: c.Additions,
+			Deletions: c.Deletions,
+			Binary:    c.Binary,
+			OldMode:   c.OldMode,
+			NewMode:   c.NewMode,
+		})
+	}
+	return result
+}
+
+// missingEvents returns the events of a that have no counterpart in b, ignoring
+// confirmation decisions.
+func missingEvents(a, b []ledger.PolicyEvent) []ledger.PolicyEvent {
+	key := func(ev ledger.PolicyEvent) string {
+		return strings.Join([]string{ev.Rule, ev.Action, ev.Matched, strings.Join(ev.Command, " ")}, "\x00")
+	}
+	have := map[string]int{}
+	for _, ev := range b {
+		have[key(ev)]++
+	}
+	out := []ledger.PolicyEvent{}
+	for _, ev := range a {
+		k := key(ev)
+		if have[k] > 0 {
+			have[k]--
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+func renderTrace(tr policy.Trace, showMisses bool) string {
+	if !tr.Matched {
+		if !showMisses {
+			return ""
+		}
+		return fmt.Sprintf("  %-6s %-8s %s", "-", tr.Action, ruleLabel(tr.Rule, tr.Source))
+	}
+	line := fmt.Sprintf("  %-6s %-8s %s", "MATCH", tr.Action, ruleLabel(tr.Rule, tr.Source))
+	if len(tr.Command) > 0 {
+		line += "  <- " + strings.Join(tr.Command, " ")
+	}
+	if tr.Overridden {
+		line += "  (overridden by an allow rule)"
+	}
+	return line
+}
+
+// ruleLabel names a rule together with the policy layer it comes from.
+func ruleLabel(rule, source string) string {
+	if source == "" {
+		return rule
+	}
+	return rule + " (" + source + ")"
+}
+
+func renderVerdict(res *policy.Result) string {
+	for _, ev := range res.Events {
+		if ev.Action == "block" {
+			verdict := fmt.Sprintf("blocked by rule '%s'", ev.Rule)
+			if ev.Reason != "" {
+				verdict += ": " + ev.Reason
+			}
+			return verdict
+		}
+	}
+	if confirms := res.Confirmations(); len(confirms) > 0 {
+		return fmt.Sprintf("allowed after confirmation (rule '%s')", confirms[0].Rule)
+	}
+	return "allowed"
+}
+
+func renderExplanation(step *ledger.Step, ex *policyExplanation) string {
+	lines := []string{fmt.Sprintf("Step %s (%s)", step.StepID, step.Kind)}
+	for _, c := range ex.Commands {
+		label := "Command:"
+		if c.SubStep {
+			label = "Spawned:"
+		}
+		lines = append(lines, "", fmt.Sprintf("%s %s", label, trim(strings.Join(c.Cmd, " "), 70)))
+		matched := 0
+		for _, tr := range c.Rules {
+			if line := renderTrace(tr, false); line != "" {
+				lines = append(lines, line)
+				matched++
+			}
+		}
+		if matched == 0 {
+			lines = append(lines, "  (no rule matched)")
+		}
+	}
+	if len(ex.Diff) > 0 {
+		lines = append(lines, "", "Changed files:")
+		for _, ev := range ex.Diff {
+			detail := ev.Matched
+			if len(ev.Files) > 0 {
+				detail = strings.Join(ev.Files, ", ")
+			}
+			lines = append(lines, fmt.Sprintf("  %-6s %-8s %s  [%s]", "MATCH", ev.Action, ruleLabel(ev.Rule, ev.Source), trim(detail, 50)))
+		}
+	}
+	lines = append(lines, "", fmt.Sprintf("Recorded: %d event(s); current policy: %d event(s)", len(ex.Recorded), len(ex.Current)))
+	for _, ev := range ex.Added {
+		lines = append(lines, fmt.Sprintf("  + %-8s %s %s", ev.Action, ruleLabel(ev.Rule, ev.Source), ev.Matched))
+	}
+	for _, ev := range ex.Removed {
+		lines = append(lines, fmt.Sprintf("  - %-8s %s %s", ev.Action, ruleLabel(ev.Rule, ev.Source), ev.Matched))
+	}
+	if len(ex.Added) == 0 && len(ex.Removed) == 0 {
+		lines = append(lines, "  (unchanged)")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+)
+
+// targetBranchName expands the "{task}" placeholder of an apply target
+// branch with the task name.
+func targetBranchName(name string, t *task.Task) string {
+	return strings.ReplaceAll(name, "{task}", t.Name)
+}
+
+// renderPRDescription builds a Markdown pull request description for the
+// changes applied to branch from the steps recorded since the last apply: the
+// commands run, the resulting diffstat, gate results and policy events.
+func renderPRDescription(t *task.Task, branch string, message string, stat *ledger.DiffStat, gates []config.Gate, steps []*ledger.Step) string {
+	title := message
+	if title == "" {
+		title = t.Name
+	}
+	lines := []string{
+		"# " + strings.SplitN(title, "\n", 2)[0],
+		"",
+		fmt.Sprintf("Task `%s` (%s), applied to `%s` from base `%s` by bar.", t.Name, t.ID, branch, t.BaseRef),
+	}
+
+	lines = append(lines, "", "## Changes", "")
+	if stat == nil || stat.Files == 0 {
+		lines = append(lines, "No file changes.")
+	} else {
+		lines = append(lines, fmt.Sprintf("%d files changed, %d insertions(+), %d deletions(-)", stat.Files, stat.Additions, stat.Deletions), "")
+		for _, c := range stat.Changes {
+			lines = append(lines, "- "+renderFileChange(c))
+		}
+	}
+
+	commands := []string{}
+	events := []string{}
+	for _, s := range steps {
+		if s.Kind == ledger.StepKindRun || s.Kind == ledger.StepKindRollback {
+			cmd := strings.Join(s.Cmd, " ")
+			if s.Kind == ledger.StepKindRollback {
+				cmd = "bar rollback"
+			}
+			exit, files := "", ""
+			if s.ExitCode != nil {
+				exit = fmt.Sprintf("%d", *s.ExitCode)
+			}
+			if s.DeltaStat != nil {
+				files = fmt.Sprintf("%d (+%d, -%d)", s.DeltaStat.Files, s.DeltaStat.Additions, s.DeltaStat.Deletions)
+			}
+			commands = append(commands, fmt.Sprintf("| %s | `%s` | %s | %s |", s.StepID, strings.ReplaceAll(trim(cmd, 80), "|", `\|`), exit, files))
+		}
+		for _, ev := range s.PolicyEvents {
+			line := fmt.Sprintf("- step %s: %s `%s`", s.StepID, ev.Action, ruleLabel(ev.Rule, ev.Source))
+			if ev.Matched != "" {
+				line += " matched `" + trim(ev.Matched, 60) + "`"
+			}
+			if d := ev.Decision; d != nil {
+				verdict := "denied"
+				if d.Approved {
+					verdict = "approved"
+				}
+				line += fmt.Sprintf(", %s by %s via %s", verdict, d.By, d.Via)
+			}
+			events = append(events, line)
+		}
+	}
+	if len(commands) > 0 {
+		lines = append(lines, "", "## Commands", "", "| Step | Command | Exit | Files |", "|------|---------|------|-------|")
+		lines = append(lines, commands...)
+	}
+	if statuses := gateStatuses(gates, steps); len(statuses) > 0 {
+		lines = append(lines, "", "## Quality gates", "")
+		for _, g := range statuses {
+			line := fmt.Sprintf("- %s: %s", g.Name, g.Status)
+			if g.Optional {
+				line += " (optional)"
+			}
+			if g.StepID != "" {
+				line += fmt.Sprintf(" (step %s)", g.StepID)
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(events) > 0 {
+		lines = append(lines, "", "## Policy events", "")
+		lines = append(lines, events...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+)
+
+func TestRenderPRDescription(t *testing.T) {
+	tk := &task.Task{ID: "t1", Name: "fix-login", BaseRef: "main"}
+	ok, bad := 0, 1
+	steps := []*ledger.Step{
+		{
+			StepID: "0001", Kind: ledger.StepKindRun, Cmd: []string{"sh", "-c", "grep a | sort"}, ExitCode: &ok,
+			DeltaStat: &ledger.DiffStat{Files: 1, Additions: 2, Deletions: 1},
+			PolicyEvents: []ledger.PolicyEvent{
+				{Rule: "no-push", Source: "repo", Action: "confirm", Matched: "git push origin main",
+					Decision: &ledger.PolicyDecision{Approved: false, By: "bar", Via: "timeout"}},
+				{Rule: "warn-deps", Action: "warn"},
+			},
+		},
+		{StepID: "0002", Kind: ledger.StepKindRun, Cmd: []string{"echo", strings.Repeat("x", 100)}, ExitCode: &bad},
+		{StepID: "0003", Kind: ledger.StepKindRollback, TargetStep: "0001"},
+		{StepID: "0004", Kind: ledger.StepKindGate, Gate: "test", Cmd: []string{"sh", "-c", "go test"}, ExitCode: &ok},
+	}
+	stat := &ledger.DiffStat{Files: 2, Additions: 2, Deletions: 1, Changes: []ledger.FileChange{
+		{Path: "login.go", Status: "M", Additions: 2, Deletions: 1},
+		{Path: "new.go", OldPath: "old.go", Status: "R"},
+	}}
+	gates := []config.Gate{{Name: "test"}, {Name: "lint", Optional: true}}
+
+	got := renderPRDescription(tk, "bar/fix-login", "Fix login redirect\n\nLonger body", stat, gates, steps)
+	for _, want := range []string{
+		// Only the first line of the message is the title
+		"# Fix login redirect\n\nTask `fix-login` (t1), applied to `bar/fix-login` from base `main` by bar.\n",
+		"## Changes\n\n2 files changed, 2 insertions(+), 1 deletions(-)\n\n- M  login.go (+2, -1)\n- R  old.go -> new.go (+0, -0)\n",
+		// Pipes would end the table cell, long commands are cut
+		"| 0001 | `sh -c grep a \\| sort` | 0 | 1 (+2, -1) |\n",
+		"| 0002 | `echo " + strings.Repeat("x", 75) + "` | 1 |  |\n",
+		"| 0003 | `bar rollback` |  |  |\n",
+		"## Quality gates\n\n- test: passed (step 0004)\n- lint: not run (optional)\n",
+		"## Policy events\n\n- step 0001: confirm `no-push (repo)` matched `git push origin main`, denied by bar via timeout\n- step 0001: warn `warn-deps`\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the description to contain %q, got:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"Longer body", "| 0004 |"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("expected the description not to contain %q, got:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestRenderPRDescription_Empty(t *testing.T) {
+	tk := &task.Task{ID: "t1", Name: "fix-login", BaseRef: "main"}
+	got := renderPRDescription(tk, "bar/fix-login", "", &ledger.DiffStat{}, nil, nil)
+	want := "# fix-login\n\nTask `fix-login` (t1), applied to `bar/fix-login` from base `main` by bar.\n\n## Changes\n\nNo file changes.\n"
+	if got != want {
+		t.Errorf("renderPRDescription() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+func resumeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resume",
+		Short: "Recover an interrupted run or wrap session",
+		Long: `Recover a 'bar run' or 'bar wrap' session whose BAR process was killed
+before it could finish its step (terminal closed, SIGKILL, crash).
+
+Steps that only have a "started" record in the ledger are finished with the
+changes left in the workspace and marked as recovered. With
+--restart the interrupted command is started again in the same workspace.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := initApp(true)
+			if err != nil {
+				return err
+			}
+			task, err := requireActiveTask(app)
+			if err != nil {
+				return err
+			}
+			if err := checkNoSync(app, task); err != nil {
+				return err
+			}
+			restart, _ := cmd.Flags().GetBool("restart")
+			force, _ := cmd.Flags().GetBool("force")
+			noUI, _ := cmd.Flags().GetBool("no-ui")
+			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
+			ledgerManager := ledger.NewManager(taskDir)
+			unfinished, err := ledgerManager.Unfinished()
+			if err != nil {
+				return err
+			}
+			if len(unfinished) == 0 {
+				app.Logger.Info("No interrupted steps found for task %s", task.Name)
+				return nil
+			}
+			if !force {
+				for _, step := range unfinished {
+					if processAlive(step.PID) {
+						return barerrors.SessionStillRunning(step.PID)
+					}
+				}
+			}
+			for _, step := range unfinished {
+				now := time.Now().UTC()
+				step.EndedAt = now
+				step.DurationMs = now.Sub(step.StartedAt).Milliseconds()
+				step.Recovered = true
+				diffResult, err := finishStep(app, task, ledgerManager, step)
+				if err != nil {
+					return err
+				}
+				app.Logger.Info("Recovered interrupted %s step %s", step.Launcher, step.StepID)
+				app.Logger.Info("Files changed: %d (+%d, -%d)", diffResult.Files, diffResult.Additions, diffResult.Deletions)
+			}
+			if !restart {
+				return nil
+			}
+			return restartStep(app, task.WorkspacePath, unfinished[len(unfinished)-1], noUI)
+		},
+	}
+	cmd.Flags().Bool("restart", false, "restart the interrupted command in the same workspace")
+	cmd.Flags().Bool("no-ui", false, "disable Web UI when restarting a wrap session")
+	cmd.Flags().BoolP("force", "f", false, "recover even if the step's BAR process still appears to be running")
+	return cmd
+}
+
+// restartStep re-launches the command of an interrupted step through a fresh
+// BAR process so it is recorded exactly like the original run or wrap.
+func restartStep(app *App, workspacePath string, step *ledger.Step, noUI bool) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	launcher := step.Launcher
+	if launcher == "" {
+		launcher = "run"
+	}
+	barArgs := []string{launcher}
+	switch launcher {
+	case "wrap":
+		if noUI {
+			barArgs = append(barArgs, "--no-ui")
+		}
+	case "run":
+		if rel, err := filepath.Rel(workspacePath, step.Cwd); err == nil && rel != "." {
+			barArgs = append(barArgs, "--cwd", rel)
+		}
+	}
+	barArgs = append(barArgs, "--")
+	barArgs = append(barArgs, step.Cmd...)
+	app.Logger.Info("Restarting: bar %s", strings.Join(barArgs, " "))
+	child := exec.Command(self, barArgs...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	return child.Run()
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
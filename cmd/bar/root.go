@@ -56,18 +56,29 @@ func Execute() error {
 	rootCmd.AddCommand(taskCmd())
 	rootCmd.AddCommand(runCmd())
 	rootCmd.AddCommand(wrapCmd())
+	rootCmd.AddCommand(resumeCmd())
 	rootCmd.AddCommand(diffCmd())
 	rootCmd.AddCommand(applyCmd())
+	rootCmd.AddCommand(syncCmd())
 	rootCmd.AddCommand(rollbackCmd())
 	rootCmd.AddCommand(statusCmd())
 	rootCmd.AddCommand(logCmd())
+	rootCmd.AddCommand(ledgerCmd())
+	rootCmd.AddCommand(policyCmd())
 	rootCmd.AddCommand(updateCmd())
 	rootCmd.AddCommand(versionCmd())
 	rootCmd.AddCommand(uiCmd())
+	rootCmd.AddCommand(shimCmd())
 	return rootCmd.Execute()
 }
 
 func initApp(requireBar bool) (*App, error) {
+	return newApp(requireBar, true)
+}
+
+// newApp builds the App for the current repository. Without loadPolicy the
+// policy file is not read, so that 'bar policy' can report on a broken one.
+func newApp(requireBar bool, loadPolicy bool) (*App, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -98,13 +109,27 @@ func initApp(requireBar bool) (*App, error) {
 	tm := task.NewManager(repoRoot, barDir)
 	wm := workspace.NewManager(repoRoot, filepath.Join(barDir, "workspaces"), gitRunner)
 	diffEngine := diff.NewEngine(gitRunner)
+	diffEngine.IncludeUntracked = cfg.Diff.IncludeUntracked
 	applyEngine := apply.NewEngine(gitRunner)
 	policyEngine := policy.NewEngine()
-	if cfg.Policy.Enabled {
-		if err := policyEngine.Load(cfg.Policy.Path); err != nil {
+	if loadPolicy {
+		active, _ := tm.GetActive()
+		layers := policyLayers(repoRoot, cfg, active)
+		if !cfg.Policy.Enabled {
+			// The global baseline applies to every project.
+			layers = layers[:1]
+		}
+		if err := policyEngine.Load(layers...); err != nil {
 			return nil, err
 		}
 	}
+	if cfg.Diff.ScanSecrets {
+		scanner, err := policyEngine.SecretScanner()
+		if err != nil {
+			return nil, err
+		}
+		diffEngine.Scanner = scanner
+	}
 	return &App{
 		RepoRoot:         repoRoot,
 		BarDir:           barDir,
@@ -121,6 +146,33 @@ func initApp(requireBar bool) (*App, error) {
 	}, nil
 }
 
+// policyLayers returns the policy files merged for task t (nil for none),
+// lowest precedence first: the global baseline, the project policy, the
+// policy committed in the repository and the task's own policy. Only the
+// project policy must exist.
+func policyLayers(repoRoot string, cfg *config.Config, t *task.Task) []policy.Layer {
+	projectPath := cfg.Policy.Path
+	if !filepath.IsAbs(projectPath) {
+		projectPath = filepath.Join(repoRoot, projectPath)
+	}
+	layers := []policy.Layer{
+		{Name: policy.LayerGlobal, Path: filepath.Join(utilpath.GlobalBarDir(), "policy.yaml"), Optional: true},
+		{Name: policy.LayerProject, Path: projectPath},
+		{Name: policy.LayerRepo, Path: filepath.Join(repoRoot, policy.RepoPolicyFile), Optional: true},
+	}
+	if t != nil && t.Policy != "" {
+		layers = append(layers, policy.Layer{Name: policy.LayerTask, Path: t.Policy})
+	}
+	return layers
+}
+
+// policyEnforced reports whether commands and diffs are checked against a
+// policy: the merged layers when policy.enabled is set, otherwise the global
+// baseline if there is one.
+func policyEnforced(app *App) bool {
+	return app.PolicyEngine.Policy != nil
+}
+
 func requireActiveTask(app *App) (*task.Task, error) {
 	t, err := app.TaskManager.GetActive()
 	if err != nil {
@@ -9,9 +9,13 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/user/blade-agent-runtime/internal/core/diff"
 	"github.com/user/blade-agent-runtime/internal/core/exec"
 	"github.com/user/blade-agent-runtime/internal/core/ledger"
 	"github.com/user/blade-agent-runtime/internal/core/policy"
+	"github.com/user/blade-agent-runtime/internal/core/secrets"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	"github.com/user/blade-agent-runtime/internal/core/workspace"
 	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
 )
 
@@ -29,6 +33,9 @@ func runCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if err := checkNoSync(app, task); err != nil {
+				return err
+			}
 			timeout, _ := cmd.Flags().GetDuration("timeout")
 			noRecord, _ := cmd.Flags().GetBool("no-record")
 			envFlags, _ := cmd.Flags().GetStringArray("env")
@@ -46,93 +53,100 @@ func runCmd() *cobra.Command {
 			env["BAR_WORKSPACE"] = task.WorkspacePath
 			env["BAR_BASE_REF"] = task.BaseRef
 			env["BAR_REPO_ROOT"] = task.RepoRoot
-			if app.Config.Policy.Enabled {
-				res, err := app.PolicyEngine.Check(args)
+			cwd := task.WorkspacePath
+			if cwdFlag != "" {
+				cwd = filepath.Join(cwd, cwdFlag)
+			}
+			var events []ledger.PolicyEvent
+			if policyEnforced(app) {
+				events, err = checkPolicy(app, task.ID, policyCommand(args, cwd, env))
 				if err != nil {
 					return err
 				}
-				if !res.Allowed {
-				rule := ""
-				reason := ""
-				if len(res.Events) > 0 {
-					rule = res.Events[0].Rule
-					reason = res.Events[0].Reason
+			}
+			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
+			ledgerManager := ledger.NewManager(taskDir)
+			step := &ledger.Step{
+				Kind:      ledger.StepKindRun,
+				StartedAt: time.Now().UTC(),
+				Cmd:       args,
+				Cwd:       cwd,
+				Env:       recordedEnv(env),
+				PID:       os.Getpid(),
+				Launcher:  "run",
+			}
+			if !noRecord {
+				if err := ledgerManager.Begin(step); err != nil {
+					return err
 				}
-				return barerrors.PolicyViolation(rule, reason)
 			}
-				for _, ev := range res.Events {
-					if ev.Action == "warn" {
-						app.Logger.Info("Policy warning: %s", ev.Reason)
-					}
+			// fail finishes the started step before returning err, so a
+			// failed run is not left for 'bar resume'
+			fail := func(err error) error {
+				if !noRecord {
+					step.EndedAt = time.Now().UTC()
+					_ = ledgerManager.Finish(step)
 				}
+				return err
 			}
-			cwd := task.WorkspacePath
-			if cwdFlag != "" {
-				cwd = filepath.Join(cwd, cwdFlag)
+			hookLedger := ledgerManager
+			if noRecord {
+				hookLedger = nil
+			}
+			if err := runHooks(app, hookLedger, step, ledger.HookPreRun, task.WorkspacePath, env); err != nil {
+				return fail(err)
+			}
+			stopWatcher := make(chan struct{})
+			if policyEnforced(app) && app.PolicyEngine.HasDiffRules() {
+				go watchDiff(app, task, stopWatcher, liveDiffPolicy(app, task, nil))
 			}
 			ctx := context.Background()
 			opts := execOptions(timeout, cwd, env)
 			result, err := app.ExecRunner.Run(ctx, args, &opts)
+			close(stopWatcher)
 			if err != nil {
-				return err
+				return fail(err)
 			}
 			if noRecord {
 				app.Logger.Info("Exit code: %d", result.ExitCode)
+				exit := result.ExitCode
+				step.ExitCode = &exit
+				if err := runHooks(app, nil, step, ledger.HookPostRun, task.WorkspacePath, env); err != nil {
+					return err
+				}
+				checkPostRunHooks(app, step)
 				return nil
 			}
-			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
-			ledgerManager := ledger.NewManager(taskDir)
-			stepID, err := ledgerManager.NextStepID()
-			if err != nil {
-				return err
-			}
-			diffResult, err := app.DiffEngine.Generate(task.WorkspacePath, task.BaseRef)
-			if err != nil {
-				return err
-			}
 			artifactsDir := filepath.Join(taskDir, "artifacts")
 			if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
-				return err
-			}
-			patchPath := filepath.Join(artifactsDir, stepID+".patch")
-			if err := os.WriteFile(patchPath, diffResult.Patch, 0o644); err != nil {
-				return err
+				return fail(err)
 			}
-			outputPath := filepath.Join(artifactsDir, stepID+".output")
+			outputPath := filepath.Join(artifactsDir, step.StepID+".output")
 			if err := writeOutput(outputPath, result.Stdout, result.Stderr); err != nil {
-				return err
+				return fail(err)
 			}
 			exit := result.ExitCode
-			step := &ledger.Step{
-				StepID:     stepID,
-				Kind:       ledger.StepKindRun,
-				StartedAt:  time.Now().Add(-result.Duration).UTC(),
-				EndedAt:    time.Now().UTC(),
-				DurationMs: result.Duration.Milliseconds(),
-				Cmd:        args,
-				Cwd:        cwd,
-				ExitCode:   &exit,
-				DiffStat: &ledger.DiffStat{
-					Files:     diffResult.Files,
-					Additions: diffResult.Additions,
-					Deletions: diffResult.Deletions,
-				},
-				Artifacts: &ledger.Artifacts{
-					Patch:  filepath.Join("artifacts", stepID+".patch"),
-					Output: filepath.Join("artifacts", stepID+".output"),
-				},
-			}
-			if app.Config.Policy.Enabled {
-				res, _ := app.PolicyEngine.Check(args)
-				if res != nil && len(res.Events) > 0 {
-					step.PolicyEvents = policyEvents(res.Events)
-				}
+			step.EndedAt = time.Now().UTC()
+			step.DurationMs = result.Duration.Milliseconds()
+			step.ExitCode = &exit
+			if step.Artifacts == nil {
+				step.Artifacts = &ledger.Artifacts{}
 			}
-			if err := ledgerManager.Append(step); err != nil {
-				return err
+			step.Artifacts.Output = filepath.Join("artifacts", step.StepID+".output")
+			if len(events) > 0 {
+				step.PolicyEvents = events
+			}
+			if err := runHooks(app, ledgerManager, step, ledger.HookPostRun, task.WorkspacePath, env); err != nil {
+				return fail(err)
+			}
+			checkPostRunHooks(app, step)
+			diffResult, err := finishStep(app, task, ledgerManager, step)
+			if err != nil {
+				return fail(err)
 			}
-			app.Logger.Info("Step %s completed (exit code: %d)", stepID, result.ExitCode)
+			app.Logger.Info("Step %s completed (exit code: %d)", step.StepID, *step.ExitCode)
 			app.Logger.Info("Files changed: %d (+%d, -%d)", diffResult.Files, diffResult.Additions, diffResult.Deletions)
+			app.Logger.Info("This step: %d (+%d, -%d)", step.DeltaStat.Files, step.DeltaStat.Additions, step.DeltaStat.Deletions)
 			return nil
 		},
 	}
@@ -143,6 +157,169 @@ func runCmd() *cobra.Command {
 	return cmd
 }
 
+// recordedEnv returns env as it is written to the ledger: the BAR_* variables
+// bar sets are kept, the values passed with --env are masked since they often
+// hold credentials.
+func recordedEnv(env map[string]string) map[string]string {
+	out := make(map[string]string, len(env))
+	for k, v := range env {
+		if !strings.HasPrefix(k, "BAR_") {
+			v = "***"
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// policyCommand describes a command about to run in cwd for policy checks.
+// env is layered over the environment bar itself runs with.
+func policyCommand(args []string, cwd string, env map[string]string) policy.Command {
+	merged := policy.EnvMap(os.Environ())
+	for k, v := range env {
+		merged[k] = v
+	}
+	return policy.Command{Argv: args, Env: merged, Cwd: cwd}
+}
+
+// checkPolicy evaluates a command against the loaded policy, logging warnings
+// and obtaining the confirmations "confirm" rules ask for. It returns the
+// events to record on the step, or a PolicyViolation error if the command is
+// blocked or not confirmed.
+func checkPolicy(app *App, taskID string, c policy.Command) ([]ledger.PolicyEvent, error) {
+	res, err := app.PolicyEngine.CheckCommand(c)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Allowed {
+		rule := ""
+		reason := ""
+		for _, ev := range res.Events {
+			if ev.Action == "block" {
+				rule = ev.Rule
+				reason = ev.Reason
+				break
+			}
+		}
+		return nil, barerrors.PolicyViolation(rule, reason)
+	}
+	for _, ev := range res.Events {
+		if ev.Action == "warn" {
+			app.Logger.Info("Policy warning: %s", ev.Reason)
+		}
+	}
+	decision, err := confirmCommand(app, taskID, c, res)
+	if err != nil {
+		return nil, err
+	}
+	if decision != nil && !decision.Approved {
+		return nil, barerrors.PolicyConfirmationDenied(res.Confirmations()[0].Rule, decision.By, decision.Via)
+	}
+	return withDecision(policyEvents(res.Events), decision), nil
+}
+
+// checkStepDiff evaluates the path and limit rules against the changes a step
+// made. The step has already run, so matches are only reported; a "block"
+// match stops the task from being applied until the changes are reverted.
+func checkStepDiff(app *App, delta *diff.Result) []ledger.PolicyEvent {
+	res, err := app.PolicyEngine.CheckDiff(delta)
+	if err != nil {
+		app.Logger.Error("Policy diff check failed: %v", err)
+		return nil
+	}
+	for _, ev := range res.Events {
+		detail := ev.Matched
+		if len(ev.Files) > 0 {
+			detail = strings.Join(ev.Files, ", ")
+		}
+		switch ev.Action {
+		case "block":
+			app.Logger.Info("Policy: step matched rule '%s' (%s); 'bar apply' will be blocked", ev.Rule, detail)
+		case "warn", "confirm":
+			app.Logger.Info("Policy warning: step matched rule '%s' (%s)", ev.Rule, detail)
+		}
+	}
+	return policyEvents(res.Events)
+}
+
+// checkStepSecrets reports the secrets a step added to the workspace (which
+// block 'bar apply') and wrote to its output as policy events. With
+// diff.redact_secrets it also redacts them from the step's artifacts, which
+// must happen before the step is sealed into the ledger.
+func checkStepSecrets(app *App, ledgerManager *ledger.Manager, step *ledger.Step, delta *diff.Result) ([]ledger.PolicyEvent, error) {
+	scanner := app.DiffEngine.Scanner
+	if scanner == nil {
+		return nil, nil
+	}
+	events := secretPolicyEvents(delta.Secrets, "block")
+	if len(delta.Secrets) > 0 {
+		app.Logger.Info("Secrets: step %s added %d possible secret(s); 'bar apply' will be blocked", step.StepID, len(delta.Secrets))
+		for _, f := range delta.Secrets {
+			app.Logger.Info("  %s at %s", f.Rule, f.Location())
+		}
+	}
+	if step.Artifacts.Output != "" {
+		data, err := os.ReadFile(filepath.Join(ledgerManager.TaskDir, step.Artifacts.Output))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		found := scanner.ScanText(data)
+		for _, f := range found {
+			events = append(events, ledger.PolicyEvent{
+				Rule:    "secret:" + f.Rule,
+				Action:  "warn",
+				Matched: "output " + f.Location(),
+			})
+		}
+		if len(found) > 0 {
+			app.Logger.Info("Secrets: %d possible secret(s) in the output of step %s", len(found), step.StepID)
+		}
+	}
+	if len(events) == 0 || !app.Config.Diff.RedactSecrets {
+		return events, nil
+	}
+	redacted := 0
+	for _, rel := range step.Artifacts.Paths() {
+		path := filepath.Join(ledgerManager.TaskDir, rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		out, n := scanner.Redact(data)
+		if n == 0 {
+			continue
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return nil, err
+		}
+		redacted += n
+	}
+	if redacted > 0 {
+		app.Logger.Info("Secrets: redacted %d occurrence(s) in the step artifacts", redacted)
+	}
+	return events, nil
+}
+
+// secretPolicyEvents converts secret findings into policy events with the
+// given action.
+func secretPolicyEvents(findings []secrets.Finding, action string) []ledger.PolicyEvent {
+	out := []ledger.PolicyEvent{}
+	for _, f := range findings {
+		ev := ledger.PolicyEvent{
+			Rule:    "secret:" + f.Rule,
+			Action:  action,
+			Matched: f.Location(),
+		}
+		if f.File != "" {
+			ev.Files = []string{f.File}
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
 func execOptions(timeout time.Duration, cwd string, env map[string]string) exec.Options {
 	return exec.Options{
 		Cwd:     cwd,
@@ -154,6 +331,96 @@ func execOptions(timeout time.Duration, cwd string, env map[string]string) exec.
 	}
 }
 
+// finishStep records the workspace state left by a started step (cumulative
+// patch, delta patch and snapshot) and writes its finished ledger record.
+// It returns the cumulative diff.
+func finishStep(app *App, t *task.Task, ledgerManager *ledger.Manager, step *ledger.Step) (*diff.Result, error) {
+	diffResult, err := app.DiffEngine.Generate(t.WorkspacePath, t.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	artifactsDir := filepath.Join(ledgerManager.TaskDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, step.StepID+".patch"), diffResult.Patch, 0o644); err != nil {
+		return nil, err
+	}
+	snapshotRef := workspace.SnapshotRef(t.ID, step.StepID)
+	snapshot, err := app.WorkspaceManager.Snapshot(t.WorkspacePath, snapshotRef, "bar: snapshot step "+step.StepID)
+	if err != nil {
+		return nil, err
+	}
+	deltaResult, err := recordDelta(app, t, ledgerManager, artifactsDir, step.StepID, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if step.Artifacts == nil {
+		step.Artifacts = &ledger.Artifacts{}
+	}
+	step.Artifacts.Patch = filepath.Join("artifacts", step.StepID+".patch")
+	step.Artifacts.DeltaPatch = filepath.Join("artifacts", step.StepID+".delta.patch")
+	step.DiffStat = diffStat(diffResult)
+	step.DeltaStat = diffStat(deltaResult)
+	step.Snapshot = snapshot
+	step.SnapshotRef = snapshotRef
+	if policyEnforced(app) {
+		step.PolicyEvents = append(step.PolicyEvents, checkStepDiff(app, deltaResult)...)
+	}
+	secretEvents, err := checkStepSecrets(app, ledgerManager, step, deltaResult)
+	if err != nil {
+		return nil, err
+	}
+	step.PolicyEvents = append(step.PolicyEvents, secretEvents...)
+	if err := ledgerManager.Finish(step); err != nil {
+		return nil, err
+	}
+	return diffResult, nil
+}
+
+// recordDelta diffs snapshot against the previous step snapshot (or the task
+// base for the first step) and writes it as the step's delta patch. It must be
+// called before the step is appended to the ledger.
+func recordDelta(app *App, t *task.Task, ledgerManager *ledger.Manager, artifactsDir string, stepID string, snapshot string) (*diff.Result, error) {
+	from, err := ledgerManager.LastSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if from == "" {
+		from = t.BaseRef
+	}
+	result, err := app.DiffEngine.Between(t.WorkspacePath, from, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, stepID+".delta.patch"), result.Patch, 0o644); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func diffStat(result *diff.Result) *ledger.DiffStat {
+	stat := &ledger.DiffStat{
+		Files:     result.Files,
+		Additions: result.Additions,
+		Deletions: result.Deletions,
+		FileList:  result.FileList,
+	}
+	for _, c := range result.Changes {
+		stat.Changes = append(stat.Changes, ledger.FileChange{
+			Path:      c.Path,
+			OldPath:   c.OldPath,
+			Status:    c.Status,
+			Additions: c.Additions,
+			Deletions: c.Deletions,
+			Binary:    c.Binary,
+			OldMode:   c.OldMode,
+			NewMode:   c.NewMode,
+		})
+	}
+	return stat
+}
+
 func writeOutput(path string, stdout []byte, stderr []byte) error {
 	content := []byte("=== STDOUT ===\n")
 	content = append(content, stdout...)
@@ -168,8 +435,10 @@ func policyEvents(events []policy.Event) []ledger.PolicyEvent {
 	for _, e := range events {
 		out = append(out, ledger.PolicyEvent{
 			Rule:    e.Rule,
+			Source:  e.Source,
 			Action:  e.Action,
 			Matched: e.Matched,
+			Files:   e.Files,
 		})
 	}
 	return out
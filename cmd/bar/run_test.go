@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordedEnv(t *testing.T) {
+	env := map[string]string{
+		"API_KEY":     "sk-live-123",
+		"DEBUG":       "",
+		"BAR_TASK_ID": "t1",
+		"BAR_ACTIVE":  "true",
+	}
+	want := map[string]string{
+		"API_KEY":     "***",
+		"DEBUG":       "***",
+		"BAR_TASK_ID": "t1",
+		"BAR_ACTIVE":  "true",
+	}
+	if got := recordedEnv(env); !reflect.DeepEqual(got, want) {
+		t.Errorf("recordedEnv() = %v, want %v", got, want)
+	}
+	if env["API_KEY"] != "sk-live-123" {
+		t.Error("expected the command's own environment to be left unmasked")
+	}
+}
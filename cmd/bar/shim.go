@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/user/blade-agent-runtime/internal/core/approval"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+	"github.com/user/blade-agent-runtime/internal/core/shim"
+)
+
+// shimCmd is the entry point of the PATH shims installed by 'bar wrap'. It
+// runs inside the wrapped agent's process tree, so it is configured through
+// the shim directory its script names and the BAR_SHIM_* environment rather
+// than the repository.
+func shimCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                "shim <command> [args...]",
+		Short:              "Audit a command spawned during 'bar wrap' and check it against policy",
+		Hidden:             true,
+		DisableFlagParsing: true,
+		Args:               cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, _ := os.Getwd()
+			rec := &shim.Record{
+				Time: time.Now().UTC(),
+				Cmd:  args,
+				Cwd:  cwd,
+			}
+			var real string
+			if args[0] == shim.ShellName {
+				real = shim.RealShell()
+				rec.Shell = true
+				rec.Cmd = append([]string{filepath.Base(real)}, args[1:]...)
+			} else {
+				path, err := shim.LookPath(args[0])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "bar shim: %s: command not found\n", args[0])
+					os.Exit(shimFinish(rec, 127))
+				}
+				real = path
+			}
+			layers, err := shim.PolicyLayers(os.Getenv(shim.EnvDir))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "bar shim: failed to read policy: %v\n", err)
+				rec.Blocked = true
+				os.Exit(shimFinish(rec, 126))
+			}
+			if layers != "" {
+				rec.Events, rec.Decision, rec.Blocked = shimCheck(policy.ParseLayers(layers), rec.Cmd)
+				if rec.Blocked {
+					os.Exit(shimFinish(rec, 126))
+				}
+			}
+			os.Exit(shimFinish(rec, shimRun(real, rec.Cmd)))
+			return nil
+		},
+	}
+	return cmd
+}
+
+// shimCheck evaluates args against the policy and reports warnings and blocks
+// on stderr. A command matched by a "confirm" rule waits for approval from the
+// Web UI, since the terminal belongs to the wrapped agent. It returns the
+// events raised, the confirmation decision and whether the command is
+// blocked. A policy that cannot be loaded or evaluated blocks the command.
+func shimCheck(layers []policy.Layer, args []string) ([]policy.Event, *ledger.PolicyDecision, bool) {
+	engine := policy.NewEngine()
+	if err := engine.Load(layers...); err != nil {
+		fmt.Fprintf(os.Stderr, "bar shim: failed to load policy: %v\n", err)
+		return nil, nil, true
+	}
+	cwd, _ := os.Getwd()
+	c := policy.Command{
+		Argv: args,
+		Env:  policy.EnvMap(os.Environ()),
+		Cwd:  cwd,
+	}
+	res, err := engine.CheckCommand(c)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bar shim: policy check failed: %v\n", err)
+		return nil, nil, true
+	}
+	for _, ev := range res.Events {
+		switch ev.Action {
+		case "block":
+			fmt.Fprintf(os.Stderr, "bar: blocked by policy rule '%s': %s\n", ev.Rule, ev.Reason)
+		case "warn":
+			fmt.Fprintf(os.Stderr, "bar: policy warning: %s\n", ev.Reason)
+		}
+	}
+	if !res.Allowed {
+		return res.Events, nil, true
+	}
+	req := approvalRequest(os.Getenv("BAR_TASK_ID"), c, res)
+	dir := os.Getenv(approval.EnvDir)
+	if req == nil || dir == "" {
+		return res.Events, nil, false
+	}
+	timeout := approval.ParseTimeout(os.Getenv(approval.EnvTimeout))
+	decision, err := awaitApproval(approval.NewStore(dir), req, timeout, func(msg string) {
+		fmt.Fprintf(os.Stderr, "bar: %s\n", msg)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bar shim: approval failed: %v\n", err)
+		return res.Events, nil, true
+	}
+	if !decision.Approved {
+		fmt.Fprintf(os.Stderr, "bar: not confirmed (%s by %s): %s\n", decision.Via, decision.By, strings.Join(args, " "))
+	}
+	return res.Events, decision, !decision.Approved
+}
+
+// shimRun runs the real binary with the shim's stdio and returns its exit
+// code. Like a shell waiting on a foreground job, it leaves SIGINT and
+// SIGQUIT to reach the child through the terminal and forwards the signals
+// that are sent to the shim alone.
+func shimRun(path string, argv []string) int {
+	child := &exec.Cmd{
+		Path:   path,
+		Args:   argv,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	if err := child.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "bar shim: %v\n", err)
+		return 126
+	}
+	go func() {
+		for sig := range sigChan {
+			if sig == syscall.SIGTERM || sig == syscall.SIGHUP {
+				child.Process.Signal(sig)
+			}
+		}
+	}()
+	err := child.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// shimFinish completes rec with the exit code and duration, appends it to the
+// records file of the wrap step and returns code.
+func shimFinish(rec *shim.Record, code int) int {
+	rec.ExitCode = &code
+	rec.DurationMs = time.Since(rec.Time).Milliseconds()
+	recordsPath := os.Getenv(shim.EnvRecords)
+	if recordsPath == "" {
+		return code
+	}
+	if err := shim.Append(recordsPath, rec); err != nil {
+		fmt.Fprintf(os.Stderr, "bar shim: failed to record %s: %v\n", strings.Join(rec.Cmd, " "), err)
+	}
+	return code
+}
+
+// setupShims installs the shims for a wrap step and returns the environment
+// that activates them and the path intercepted commands are recorded to.
+// Spawned commands are checked against policy only when it is enforced.
+func setupShims(app *App, taskDir string, stepID string) ([]string, string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, "", err
+	}
+	policyLayers := ""
+	if policyEnforced(app) {
+		policyLayers = policy.FormatLayers(app.PolicyEngine.Layers)
+	}
+	shimDir := filepath.Join(taskDir, "shims")
+	if err := shim.Install(shimDir, self, app.Config.Wrap.ShimCommands, policyLayers); err != nil {
+		return nil, "", err
+	}
+	artifactsDir := filepath.Join(taskDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
+		return nil, "", err
+	}
+	recordsPath := filepath.Join(artifactsDir, stepID+".commands.jsonl")
+	env := shim.Env(shimDir, recordsPath)
+	if policyLayers != "" {
+		env = append(env,
+			approval.EnvDir+"="+approval.StoreDir(app.BarDir),
+			approval.EnvTimeout+"="+app.Config.Policy.ConfirmTimeout,
+		)
+	}
+	return env, recordsPath, nil
+}
+
+// shimSubSteps converts the records of intercepted commands into sub-steps
+// and policy events of the wrap step and reports how many were blocked.
+func shimSubSteps(recordsPath string) ([]ledger.SubStep, []ledger.PolicyEvent, int, error) {
+	records, err := shim.ReadRecords(recordsPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// Records are appended when commands finish; order them by start
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	subSteps := []ledger.SubStep{}
+	events := []ledger.PolicyEvent{}
+	blocked := 0
+	for _, rec := range records {
+		if rec.Blocked {
+			blocked++
+		}
+		subSteps = append(subSteps, ledger.SubStep{
+			Cmd:        rec.Cmd,
+			Cwd:        rec.Cwd,
+			Shell:      rec.Shell,
+			StartedAt:  rec.Time,
+			DurationMs: rec.DurationMs,
+			ExitCode:   rec.ExitCode,
+			Blocked:    rec.Blocked,
+		})
+		for _, ev := range withDecision(policyEvents(rec.Events), rec.Decision) {
+			ev.Command = rec.Cmd
+			events = append(events, ev)
+		}
+	}
+	return subSteps, events, blocked, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+)
+
+func TestShimCheck_FailsClosed(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.yaml")
+	if err := os.WriteFile(broken, []byte("rules: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	layers := []policy.Layer{
+		{Name: "repo", Path: broken},
+		{Name: "task", Path: filepath.Join(dir, "missing.yaml")},
+	}
+	for _, l := range layers {
+		if _, _, blocked := shimCheck([]policy.Layer{l}, []string{"ls"}); !blocked {
+			t.Errorf("expected a policy that cannot be loaded (%s) to block", l.Name)
+		}
+	}
+
+	// A skipped optional layer leaves nothing to enforce
+	optional := []policy.Layer{{Name: "task", Path: filepath.Join(dir, "missing.yaml"), Optional: true}}
+	if _, _, blocked := shimCheck(optional, []string{"ls"}); blocked {
+		t.Error("expected a missing optional layer not to block")
+	}
+}
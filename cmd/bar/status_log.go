@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,6 +45,7 @@ func statusCmd() *cobra.Command {
 			if len(steps) > 0 {
 				last = steps[len(steps)-1]
 			}
+			gates := gateStatuses(app.Config.Gates, steps)
 			format, _ := cmd.Flags().GetString("format")
 			if format == "json" {
 				out := map[string]any{
@@ -55,6 +58,7 @@ func statusCmd() *cobra.Command {
 					"status":       statusString(clean),
 					"steps":        len(steps),
 					"last_step_id": "",
+					"gates":        gates,
 				}
 				if last != nil {
 					out["last_step_id"] = last.StepID
@@ -74,6 +78,9 @@ func statusCmd() *cobra.Command {
 			if last != nil {
 				box.AddRow("Last Step", fmt.Sprintf("%s (%s)", last.StepID, last.Kind))
 			}
+			if len(gates) > 0 {
+				box.AddRow("Gates", renderGates(gates))
+			}
 			fmt.Fprintln(os.Stdout, box.Render())
 			return nil
 		},
@@ -96,27 +103,30 @@ func logCmd() *cobra.Command {
 			}
 			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
 			ledgerManager := ledger.NewManager(taskDir)
-			steps, err := ledgerManager.List()
-			if err != nil {
-				return err
-			}
 			format, _ := cmd.Flags().GetString("format")
-			limit, _ := cmd.Flags().GetInt("limit")
 			stepID, _ := cmd.Flags().GetString("step")
 			output, _ := cmd.Flags().GetString("output")
 			if stepID != "" {
-				step, err := ledgerManager.GetByID(stepID)
+				steps, skipped, err := ledgerManager.ListReadable()
 				if err != nil {
 					return err
 				}
-				if step == nil {
+				warnSkippedLines(app, skipped)
+				i := slices.IndexFunc(steps, func(s *ledger.Step) bool { return s.StepID == stepID })
+				if i < 0 {
 					return barerrors.StepNotFound(stepID)
 				}
-				return writeLogOutput(format, output, renderStepDetail(step))
+				return writeLogOutput(format, output, renderStepDetail(steps[i]))
 			}
-			if limit > 0 && len(steps) > limit {
-				steps = steps[len(steps)-limit:]
+			query, err := logQuery(cmd)
+			if err != nil {
+				return err
+			}
+			steps, skipped, err := ledgerManager.Query(query)
+			if err != nil {
+				return err
 			}
+			warnSkippedLines(app, skipped)
 			if format == "json" {
 				data, _ := json.MarshalIndent(steps, "", "  ")
 				return writeLogOutput(format, output, string(data))
@@ -128,7 +138,14 @@ func logCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().String("step", "", "show a specific step")
-	cmd.Flags().Int("limit", 10, "limit number of steps")
+	cmd.Flags().Int("limit", 10, "limit number of steps (0 for all)")
+	cmd.Flags().StringSlice("kind", nil, "only show steps of these kinds (run/apply/rollback/gate/sync)")
+	cmd.Flags().Bool("failed", false, "only show steps that exited with a non-zero code")
+	cmd.Flags().String("since", "", "only show steps started after this time (RFC 3339, YYYY-MM-DD or duration like 2h)")
+	cmd.Flags().String("until", "", "only show steps started before this time")
+	cmd.Flags().String("cmd", "", "only show steps whose command contains this text")
+	cmd.Flags().String("file", "", "only show steps that touched this file, directory or glob")
+	cmd.Flags().String("policy", "", "only show steps with a policy event of this action (warn/block)")
 	cmd.Flags().String("format", "table", "output format (table/json/markdown)")
 	cmd.Flags().String("output", "", "write output to file")
 	_ = cmd.RegisterFlagCompletionFunc("step", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -140,11 +157,96 @@ func logCmd() *cobra.Command {
 		if err != nil {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		}
-		completions := completion.GetStepCompletions(app.BarDir, task.ID)
+		// Complete every step the other filters match, not just the last
+		// --limit of them.
+		query, err := logQuery(cmd)
+		if err != nil {
+			query = nil
+		} else {
+			query.Limit = 0
+		}
+		completions := completion.GetStepCompletions(app.BarDir, task.ID, query)
+		return completion.ToCobraCompletions(completions), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = cmd.RegisterFlagCompletionFunc("kind", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completion.ToCobraCompletions(completion.GetKindCompletions()), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = cmd.RegisterFlagCompletionFunc("file", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		app, err := initApp(true)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		task, err := requireActiveTask(app)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		completions := completion.GetFileCompletions(app.BarDir, task.ID)
 		return completion.ToCobraCompletions(completions), cobra.ShellCompDirectiveNoFileComp
 	})
 	return cmd
 }
+
+// warnSkippedLines reports the ledger lines a listing left out because they
+// cannot be parsed, on stderr so --format json output stays valid.
+func warnSkippedLines(app *App, skipped []int) {
+	if len(skipped) == 0 {
+		return
+	}
+	lines := make([]string, len(skipped))
+	for i, line := range skipped {
+		lines[i] = strconv.Itoa(line)
+	}
+	app.Logger.Error("Warning: skipped %d unreadable ledger line(s) (line %s); run 'bar ledger verify' for details", len(skipped), strings.Join(lines, ", "))
+}
+
+// logQuery builds a ledger query from the bar log filter flags.
+func logQuery(cmd *cobra.Command) (*ledger.Query, error) {
+	kinds, _ := cmd.Flags().GetStringSlice("kind")
+	failed, _ := cmd.Flags().GetBool("failed")
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+	command, _ := cmd.Flags().GetString("cmd")
+	file, _ := cmd.Flags().GetString("file")
+	policyAction, _ := cmd.Flags().GetString("policy")
+	limit, _ := cmd.Flags().GetInt("limit")
+	query := &ledger.Query{
+		Failed:       failed,
+		Command:      command,
+		File:         file,
+		PolicyAction: policyAction,
+		Limit:        limit,
+	}
+	for _, k := range kinds {
+		query.Kinds = append(query.Kinds, ledger.StepKind(k))
+	}
+	now := time.Now()
+	var err error
+	if since != "" {
+		if query.Since, err = ledger.ParseTime(since, now); err != nil {
+			return nil, err
+		}
+	}
+	if until != "" {
+		if query.Until, err = ledger.ParseTime(until, now); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// renderGates summarizes gate results on one line, e.g. "test ✓, lint ✗".
+func renderGates(gates []gateStatus) string {
+	parts := make([]string, len(gates))
+	for i, g := range gates {
+		mark := map[string]string{"passed": "✓", "failed": "✗", "stale": "stale", "not run": "not run"}[g.Status]
+		parts[i] = g.Name + " " + mark
+		if g.Optional {
+			parts[i] += " (optional)"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 func statusString(clean bool) string {
 	if clean {
 		return "clean"
@@ -167,6 +269,9 @@ func renderTable(steps []*ledger.Step) string {
 		if s.DiffStat != nil {
 			files = fmt.Sprintf("%d (+%d, -%d)", s.DiffStat.Files, s.DiffStat.Additions, s.DiffStat.Deletions)
 		}
+		if s.Unfinished() {
+			files = "unfinished"
+		}
 		lines = append(lines, fmt.Sprintf("%-6s %-9s %-30s %-8s %-4s %s", s.StepID, s.Kind, trim(cmd, 30), formatDuration(s.DurationMs), exit, files))
 	}
 	return strings.Join(lines, "\n")
@@ -183,6 +288,9 @@ func renderMarkdown(steps []*ledger.Step) string {
 		if s.DiffStat != nil {
 			files = fmt.Sprintf("%d (+%d, -%d)", s.DiffStat.Files, s.DiffStat.Additions, s.DiffStat.Deletions)
 		}
+		if s.Unfinished() {
+			files = "unfinished"
+		}
 		lines = append(lines, fmt.Sprintf("| %s | %s | %s | %s | %s | %s |", s.StepID, s.Kind, trim(cmd, 40), formatDuration(s.DurationMs), exit, files))
 	}
 	return strings.Join(lines, "\n")
@@ -193,19 +301,128 @@ func renderStepDetail(s *ledger.Step) string {
 		"──────────────────────────────",
 		fmt.Sprintf("Kind:     %s", s.Kind),
 	}
+	if s.Gate != "" {
+		gate := s.Gate
+		if s.GateOptional {
+			gate += " (optional)"
+		}
+		lines = append(lines, fmt.Sprintf("Gate:     %s", gate))
+	}
 	if len(s.Cmd) > 0 {
 		lines = append(lines, fmt.Sprintf("Command:  %s", strings.Join(s.Cmd, " ")))
 	}
+	if s.Mode != "" {
+		lines = append(lines, fmt.Sprintf("Mode:     %s", s.Mode))
+	}
+	if s.CommitSHA != "" {
+		lines = append(lines, fmt.Sprintf("Commit:   %s", s.CommitSHA))
+	}
+	if s.Kind == ledger.StepKindSync {
+		lines = append(lines, fmt.Sprintf("Base:     %s -> %s", s.OldBase, s.NewBase))
+		if len(s.Conflicts) > 0 {
+			lines = append(lines, fmt.Sprintf("Resolved: %s", strings.Join(s.Conflicts, ", ")))
+		}
+	}
+	if s.Kind == ledger.StepKindApply && s.TargetBranch != "" {
+		lines = append(lines, fmt.Sprintf("Branch:   %s", s.TargetBranch))
+	}
+	if s.Artifacts != nil && s.Artifacts.Description != "" {
+		lines = append(lines, fmt.Sprintf("PR:       %s", s.Artifacts.Description))
+	}
+	if s.GatesSkipped {
+		lines = append(lines, "Gates:    skipped (--skip-gates)")
+	}
 	lines = append(lines, fmt.Sprintf("Started:  %s", s.StartedAt.Format(time.RFC3339)))
-	lines = append(lines, fmt.Sprintf("Ended:    %s", s.EndedAt.Format(time.RFC3339)))
+	if s.Unfinished() {
+		lines = append(lines, fmt.Sprintf("Status:   unfinished (pid %d, run 'bar resume' if it was interrupted)", s.PID))
+	} else {
+		lines = append(lines, fmt.Sprintf("Ended:    %s", s.EndedAt.Format(time.RFC3339)))
+	}
 	if s.ExitCode != nil {
 		lines = append(lines, fmt.Sprintf("Exit:     %d", *s.ExitCode))
 	}
+	if s.Recovered {
+		lines = append(lines, "Recovered: interrupted step finished by 'bar resume'")
+	}
 	if s.DiffStat != nil {
 		lines = append(lines, fmt.Sprintf("Files:    %d (+%d, -%d)", s.DiffStat.Files, s.DiffStat.Additions, s.DiffStat.Deletions))
+		if len(s.DiffStat.Changes) > 0 {
+			lines = append(lines, "", "Files Changed:")
+			for _, c := range s.DiffStat.Changes {
+				lines = append(lines, "  "+renderFileChange(c))
+			}
+		}
+	}
+	if len(s.SubSteps) > 0 {
+		lines = append(lines, "", fmt.Sprintf("Commands: %d spawned", len(s.SubSteps)))
+		for _, sub := range s.SubSteps {
+			exit := "-"
+			if sub.Blocked {
+				exit = "blocked"
+			} else if sub.ExitCode != nil {
+				exit = fmt.Sprintf("%d", *sub.ExitCode)
+			}
+			lines = append(lines, fmt.Sprintf("  %-7s %-8s %s", exit, formatDuration(sub.DurationMs), trim(strings.Join(sub.Cmd, " "), 60)))
+		}
+	}
+	if len(s.Commits) > 0 {
+		lines = append(lines, "", fmt.Sprintf("Commits: %d", len(s.Commits)))
+		for _, c := range s.Commits {
+			lines = append(lines, "  "+c)
+		}
+	}
+	if s.Artifacts != nil && len(s.Artifacts.Patches) > 0 {
+		lines = append(lines, "", fmt.Sprintf("Patches: %d", len(s.Artifacts.Patches)))
+		for _, p := range s.Artifacts.Patches {
+			lines = append(lines, "  "+p)
+		}
+	}
+	if len(s.Hooks) > 0 {
+		lines = append(lines, "", "Hooks:")
+		for _, h := range s.Hooks {
+			line := fmt.Sprintf("  %-8s %-4d %-8s %s", h.Phase, h.ExitCode, formatDuration(h.DurationMs), trim(h.Cmd, 50))
+			if h.Output != "" {
+				line += "  (" + h.Output + ")"
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(s.PolicyEvents) > 0 {
+		lines = append(lines, "", "Policy Events:")
+		for _, ev := range s.PolicyEvents {
+			line := fmt.Sprintf("  %-6s %s", ev.Action, ruleLabel(ev.Rule, ev.Source))
+			if len(ev.Command) > 0 {
+				line += fmt.Sprintf(" (%s)", trim(strings.Join(ev.Command, " "), 50))
+			}
+			if len(ev.Files) > 0 {
+				line += fmt.Sprintf(" [%s]", trim(strings.Join(ev.Files, ", "), 50))
+			}
+			if d := ev.Decision; d != nil {
+				verdict := "denied"
+				if d.Approved {
+					verdict = "approved"
+				}
+				line += fmt.Sprintf(" %s by %s via %s", verdict, d.By, d.Via)
+			}
+			lines = append(lines, line)
+		}
 	}
 	return strings.Join(lines, "\n")
 }
+func renderFileChange(c ledger.FileChange) string {
+	path := c.Path
+	if c.OldPath != "" {
+		path = fmt.Sprintf("%s -> %s", c.OldPath, c.Path)
+	}
+	detail := fmt.Sprintf("(+%d, -%d)", c.Additions, c.Deletions)
+	if c.Binary {
+		detail = "(binary)"
+	}
+	if c.OldMode != "" {
+		detail += fmt.Sprintf(" mode %s -> %s", c.OldMode, c.NewMode)
+	}
+	return fmt.Sprintf("%s  %s %s", c.Status, path, detail)
+}
 func writeLogOutput(format string, output string, content string) error {
 	if output == "" {
 		fmt.Fprintln(os.Stdout, content)
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/user/blade-agent-runtime/internal/core/apply"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	"github.com/user/blade-agent-runtime/internal/core/workspace"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+	utiljson "github.com/user/blade-agent-runtime/internal/util/json"
+)
+
+func syncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Rebase the task onto the latest base branch",
+		Long: `Bring the task branch up to date with the current tip of its base branch.
+
+Uncommitted changes in the workspace are carried over. The task branch is
+rebased onto the base branch, or with --merge the base branch is merged into
+it. On conflicts the sync stops with the conflicts in the workspace: resolve
+them and run 'bar sync --continue', or run 'bar sync --abort' to return to the
+state before the sync.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := initApp(true)
+			if err != nil {
+				return err
+			}
+			t, err := requireActiveTask(app)
+			if err != nil {
+				return err
+			}
+			merge, _ := cmd.Flags().GetBool("merge")
+			cont, _ := cmd.Flags().GetBool("continue")
+			abort, _ := cmd.Flags().GetBool("abort")
+			return syncTask(app, t, merge, cont, abort)
+		},
+	}
+	cmd.Flags().Bool("merge", false, "merge the base branch into the task branch instead of rebasing")
+	cmd.Flags().Bool("continue", false, "continue a sync stopped by conflicts once they are resolved")
+	cmd.Flags().Bool("abort", false, "abort a sync stopped by conflicts and restore the workspace")
+	return cmd
+}
+
+// syncTask starts a sync of task t onto its base branch (merging instead of
+// rebasing with merge), or continues or aborts the one stopped by conflicts.
+func syncTask(app *App, t *task.Task, merge bool, cont bool, abort bool) error {
+	if cont && abort {
+		return fmt.Errorf("--continue and --abort cannot be used together")
+	}
+	pending, err := loadSyncState(app, t)
+	if err != nil {
+		return err
+	}
+	if (cont || abort) && pending == nil {
+		return fmt.Errorf("no sync in progress for task %s", t.Name)
+	}
+	if !cont && !abort && pending != nil {
+		return barerrors.SyncInProgress(t.Name)
+	}
+
+	var s *apply.SyncState
+	switch {
+	case abort:
+		if err := app.ApplyEngine.AbortSync(t.WorkspacePath, pending); err != nil {
+			return err
+		}
+		if err := clearSyncState(app, t); err != nil {
+			return err
+		}
+		app.Logger.Info("Sync aborted: workspace restored to %s", shortSHA(pending.Head))
+		return nil
+	case cont:
+		s = pending
+		err = app.ApplyEngine.ContinueSync(t.WorkspacePath, t.BaseRef, s)
+	default:
+		mode := apply.SyncRebase
+		if merge {
+			mode = apply.SyncMerge
+		}
+		s, err = app.ApplyEngine.Sync(t.WorkspacePath, app.RepoRoot, t.BaseRef, mode)
+	}
+	var barErr *barerrors.BarError
+	if errors.As(err, &barErr) && barErr.Code == barerrors.ErrSyncConflict {
+		if err := saveSyncState(app, t, s); err != nil {
+			return err
+		}
+		app.Logger.Info("Syncing with %s: %s -> %s (%s)", t.BaseRef, shortSHA(s.OldBase), shortSHA(s.NewBase), s.Mode)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if s.UpToDate() {
+		app.Logger.Info("Already up to date with %s (%s)", t.BaseRef, shortSHA(s.NewBase))
+		return nil
+	}
+	step, err := recordSync(app, t, s)
+	if err != nil {
+		return err
+	}
+	if err := clearSyncState(app, t); err != nil {
+		return err
+	}
+	if _, err := app.TaskManager.UpdateTask(t.ID, func(t *task.Task) error {
+		t.BaseSHA = s.NewBase
+		return nil
+	}); err != nil {
+		return err
+	}
+	app.Logger.Info("Synced with %s: %s -> %s (%s, step %s)", t.BaseRef, shortSHA(s.OldBase), shortSHA(s.NewBase), s.Mode, step.StepID)
+	if len(s.Conflicts) > 0 {
+		app.Logger.Info("Resolved conflicts: %d file(s)", len(s.Conflicts))
+	}
+	return nil
+}
+
+// recordSync appends the "sync" step of a finished sync, with a snapshot of
+// the synced workspace so later step diffs are taken against it.
+func recordSync(app *App, t *task.Task, s *apply.SyncState) (*ledger.Step, error) {
+	ledgerManager := ledger.NewManager(filepath.Join(app.BarDir, "tasks", t.ID))
+	result, err := app.DiffEngine.Generate(t.WorkspacePath, t.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return ledgerManager.AppendNext(func(stepID string) (*ledger.Step, error) {
+		snapshotRef := workspace.SnapshotRef(t.ID, stepID)
+		snapshot, err := app.WorkspaceManager.Snapshot(t.WorkspacePath, snapshotRef, "bar: snapshot step "+stepID)
+		if err != nil {
+			return nil, err
+		}
+		return &ledger.Step{
+			StepID:      stepID,
+			Kind:        ledger.StepKindSync,
+			StartedAt:   now,
+			EndedAt:     now,
+			Mode:        s.Mode,
+			OldBase:     s.OldBase,
+			NewBase:     s.NewBase,
+			Conflicts:   s.Conflicts,
+			DiffStat:    diffStat(result),
+			Snapshot:    snapshot,
+			SnapshotRef: snapshotRef,
+		}, nil
+	})
+}
+
+// syncStatePath is where a sync stopped by conflicts is kept until it is
+// continued or aborted.
+func syncStatePath(app *App, t *task.Task) string {
+	return filepath.Join(app.BarDir, "tasks", t.ID, "sync.json")
+}
+
+// loadSyncState returns the sync in progress for the task, or nil.
+func loadSyncState(app *App, t *task.Task) (*apply.SyncState, error) {
+	var s apply.SyncState
+	if err := utiljson.ReadFile(syncStatePath(app, t), &s); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func saveSyncState(app *App, t *task.Task, s *apply.SyncState) error {
+	return utiljson.WriteFile(syncStatePath(app, t), s)
+}
+
+// checkNoSync refuses to touch the workspace of a task whose sync stopped on
+// conflicts: snapshotting or resetting it would lose the rebase or merge in
+// progress that 'bar sync --continue' picks up.
+func checkNoSync(app *App, t *task.Task) error {
+	pending, err := loadSyncState(app, t)
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		return barerrors.SyncInProgress(t.Name)
+	}
+	return nil
+}
+
+func clearSyncState(app *App, t *task.Task) error {
+	if err := os.Remove(syncStatePath(app, t)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	"github.com/user/blade-agent-runtime/internal/core/apply"
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	"github.com/user/blade-agent-runtime/internal/core/workspace"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+	utillog "github.com/user/blade-agent-runtime/internal/util/log"
+)
+
+// syncTaskApp sets up a repository whose main branch moved on after a task was
+// started from it, both changing a.txt, so syncing the task conflicts.
+func syncTaskApp(t *testing.T) (*App, *task.Task) {
+	t.Helper()
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	repo := t.TempDir()
+	barDir := t.TempDir()
+	git := gitadapter.NewRunner()
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := git.Run(repo, args...); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	run("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("a\n"), 0o644)
+	run("add", "-A")
+	run("commit", "-q", "-m", "init")
+
+	app := &App{
+		RepoRoot:         repo,
+		BarDir:           barDir,
+		Config:           config.DefaultConfig(),
+		Logger:           utillog.New(io.Discard, io.Discard, false, false),
+		Git:              git,
+		TaskManager:      task.NewManager(repo, barDir),
+		WorkspaceManager: workspace.NewManager(repo, filepath.Join(barDir, "workspaces"), git),
+		DiffEngine:       diff.NewEngine(git),
+		ApplyEngine:      apply.NewEngine(git),
+	}
+	ws, err := app.WorkspaceManager.Create("t1", "bar/demo", "main")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	tk, err := app.TaskManager.Create("t1", "demo", "main", "bar/demo", ws)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(ws, "a.txt"), []byte("task\n"), 0o644)
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("upstream\n"), 0o644)
+	run("commit", "-q", "-am", "upstream")
+	return app, tk
+}
+
+func syncErrorCode(err error) barerrors.ErrorCode {
+	var barErr *barerrors.BarError
+	if errors.As(err, &barErr) {
+		return barErr.Code
+	}
+	return ""
+}
+
+func TestSyncTask_Continue(t *testing.T) {
+	app, tk := syncTaskApp(t)
+	if err := syncTask(app, tk, false, true, false); err == nil {
+		t.Fatal("expected --continue without a sync in progress to fail")
+	}
+
+	err := syncTask(app, tk, false, false, false)
+	if code := syncErrorCode(err); code != barerrors.ErrSyncConflict {
+		t.Fatalf("expected a sync conflict, got %v", err)
+	}
+	pending, _ := loadSyncState(app, tk)
+	if pending == nil || pending.Mode != apply.SyncRebase || !reflect.DeepEqual(pending.Conflicts, []string{"a.txt"}) {
+		t.Fatalf("expected the stopped rebase to be kept, got %+v", pending)
+	}
+	// Nothing else may touch the workspace until the sync is finished
+	if code := syncErrorCode(checkNoSync(app, tk)); code != barerrors.ErrSyncInProgress {
+		t.Errorf("expected the sync in progress to be reported, got %q", code)
+	}
+	if code := syncErrorCode(syncTask(app, tk, false, false, false)); code != barerrors.ErrSyncInProgress {
+		t.Errorf("expected a second sync to be refused, got %q", code)
+	}
+
+	// Conflict markers left in the file keep the sync stopped
+	if code := syncErrorCode(syncTask(app, tk, false, true, false)); code != barerrors.ErrSyncConflict {
+		t.Fatalf("expected unresolved conflicts to stop --continue, got %q", code)
+	}
+	if pending, _ := loadSyncState(app, tk); pending == nil {
+		t.Fatal("expected the sync to stay in progress")
+	}
+
+	os.WriteFile(filepath.Join(tk.WorkspacePath, "a.txt"), []byte("resolved\n"), 0o644)
+	if err := syncTask(app, tk, false, true, false); err != nil {
+		t.Fatalf("--continue failed: %v", err)
+	}
+	if pending, _ := loadSyncState(app, tk); pending != nil {
+		t.Errorf("expected the sync state to be cleared, got %+v", pending)
+	}
+	if err := checkNoSync(app, tk); err != nil {
+		t.Errorf("expected the workspace to be free again, got %v", err)
+	}
+	upstream, _ := app.Git.Run(app.RepoRoot, "rev-parse", "main")
+	if head, _ := app.Git.Run(tk.WorkspacePath, "rev-parse", "HEAD"); head != upstream {
+		t.Errorf("expected the task branch at %s, got %s", upstream, head)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tk.WorkspacePath, "a.txt")); string(data) != "resolved\n" {
+		t.Errorf("expected the resolution in the workspace, got %q", data)
+	}
+	steps, _ := ledger.NewManager(filepath.Join(app.BarDir, "tasks", tk.ID)).List()
+	if len(steps) != 1 || steps[0].Kind != ledger.StepKindSync || steps[0].NewBase != upstream ||
+		!reflect.DeepEqual(steps[0].Conflicts, []string{"a.txt"}) || steps[0].Snapshot == "" {
+		t.Errorf("expected a sync step with the resolved conflicts, got %+v", steps)
+	}
+	if got, _ := app.TaskManager.Get(tk.ID); got.BaseSHA != upstream {
+		t.Errorf("expected the task's base at %s, got %q", upstream, got.BaseSHA)
+	}
+}
+
+func TestSyncTask_Abort(t *testing.T) {
+	app, tk := syncTaskApp(t)
+	head, _ := app.Git.Run(tk.WorkspacePath, "rev-parse", "HEAD")
+
+	err := syncTask(app, tk, true, false, false)
+	if code := syncErrorCode(err); code != barerrors.ErrSyncConflict {
+		t.Fatalf("expected a sync conflict, got %v", err)
+	}
+	if pending, _ := loadSyncState(app, tk); pending == nil || pending.Mode != apply.SyncMerge {
+		t.Fatalf("expected the stopped merge to be kept, got %+v", pending)
+	}
+	if err := syncTask(app, tk, false, true, true); err == nil {
+		t.Error("expected --continue and --abort together to fail")
+	}
+
+	if err := syncTask(app, tk, false, false, true); err != nil {
+		t.Fatalf("--abort failed: %v", err)
+	}
+	if pending, _ := loadSyncState(app, tk); pending != nil {
+		t.Errorf("expected the sync state to be cleared, got %+v", pending)
+	}
+	if got, _ := app.Git.Run(tk.WorkspacePath, "rev-parse", "HEAD"); got != head {
+		t.Errorf("expected the task branch back at %s, got %s", head, got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tk.WorkspacePath, "a.txt")); string(data) != "task\n" {
+		t.Errorf("expected the uncommitted change back, got %q", data)
+	}
+	if steps, _ := ledger.NewManager(filepath.Join(app.BarDir, "tasks", tk.ID)).List(); len(steps) != 0 {
+		t.Errorf("expected no sync step after an abort, got %+v", steps)
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	app := &App{BarDir: t.TempDir()}
+	tk := &task.Task{ID: "t1", Name: "demo", BaseRef: "main"}
+	taskDir := filepath.Join(app.BarDir, "tasks", tk.ID)
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := loadSyncState(app, tk); err != nil || s != nil {
+		t.Fatalf("expected no sync in progress, got %+v, %v", s, err)
+	}
+
+	want := &apply.SyncState{
+		Mode: apply.SyncRebase, OldBase: "aaa", NewBase: "bbb", Head: "ccc", Snapshot: "ddd",
+		Conflicts: []string{"a.txt"},
+	}
+	if err := saveSyncState(app, tk, want); err != nil {
+		t.Fatalf("saveSyncState failed: %v", err)
+	}
+	got, err := loadSyncState(app, tk)
+	if err != nil {
+		t.Fatalf("loadSyncState failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadSyncState() = %+v, want %+v", got, want)
+	}
+	// A later stop replaces the state, conflicts of earlier attempts included
+	want.Conflicts = append(want.Conflicts, "b.txt")
+	if err := saveSyncState(app, tk, want); err != nil {
+		t.Fatalf("saveSyncState failed: %v", err)
+	}
+	if got, _ := loadSyncState(app, tk); !reflect.DeepEqual(got, want) {
+		t.Errorf("loadSyncState() = %+v, want %+v", got, want)
+	}
+	entries, _ := os.ReadDir(taskDir)
+	if len(entries) != 1 || entries[0].Name() != "sync.json" {
+		t.Errorf("expected only sync.json in the task dir, got %v", entries)
+	}
+
+	if err := clearSyncState(app, tk); err != nil {
+		t.Fatalf("clearSyncState failed: %v", err)
+	}
+	if s, err := loadSyncState(app, tk); err != nil || s != nil {
+		t.Errorf("expected the sync to be cleared, got %+v, %v", s, err)
+	}
+	if err := clearSyncState(app, tk); err != nil {
+		t.Errorf("expected clearing twice to succeed, got %v", err)
+	}
+
+	if err := os.WriteFile(syncStatePath(app, tk), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSyncState(app, tk); err == nil {
+		t.Error("expected a corrupt sync state to fail to load")
+	}
+}
@@ -151,6 +151,9 @@ func taskCloseCmd() *cobra.Command {
 				}
 			}
 			if del {
+				if err := app.WorkspaceManager.DeleteSnapshots(t.ID); err != nil {
+					return err
+				}
 				if err := app.TaskManager.Delete(t.ID); err != nil {
 					return err
 				}
@@ -159,12 +162,7 @@ func taskCloseCmd() *cobra.Command {
 					return err
 				}
 			}
-			if state, err := app.TaskManager.LoadState(); err == nil {
-				if state.ActiveTaskID == t.ID {
-					state.ActiveTaskID = ""
-					_ = app.TaskManager.SaveState(state)
-				}
-			}
+			_ = app.TaskManager.ClearActive(t.ID)
 			if del {
 				app.Logger.Info("Deleted task: %s (%s)", t.Name, t.ID)
 			} else {
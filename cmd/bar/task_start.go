@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -9,6 +10,9 @@ import (
 	"github.com/spf13/cobra"
 
 	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
 )
 
 func taskStartCmd() *cobra.Command {
@@ -27,15 +31,32 @@ func taskStartCmd() *cobra.Command {
 			name := args[0]
 			base, _ := cmd.Flags().GetString("base")
 			noSwitch, _ := cmd.Flags().GetBool("no-switch")
-			return createTask(app, name, base, noSwitch)
+			policyPath, _ := cmd.Flags().GetString("policy")
+			return createTask(app, name, base, noSwitch, policyPath)
 		},
 	}
 	cmd.Flags().String("base", "", "base branch or commit")
 	cmd.Flags().Bool("no-switch", false, "do not switch to the new task")
+	cmd.Flags().String("policy", "", "policy file for this task, merged over the project and repository policies")
 	return cmd
 }
 
-func createTask(app *App, name, base string, noSwitch bool) error {
+func createTask(app *App, name, base string, noSwitch bool, policyPath string) error {
+	var taskPolicy []byte
+	if policyPath != "" {
+		data, err := os.ReadFile(policyPath)
+		if err != nil {
+			return err
+		}
+		_, issues := policy.Validate(data)
+		if n := policy.ErrorCount(issues); n > 0 {
+			for _, issue := range issues {
+				app.Logger.Error("%s", policyIssueLine(policyPath, issue))
+			}
+			return barerrors.PolicyInvalid(policyPath, n)
+		}
+		taskPolicy = data
+	}
 	if !noSwitch && isInteractive() {
 		activeTask, _ := app.TaskManager.GetActive()
 		if activeTask != nil {
@@ -53,48 +74,77 @@ func createTask(app *App, name, base string, noSwitch bool) error {
 		}
 	}
 
+	t, err := newTask(app, name, base, taskPolicy)
+	if err != nil {
+		return err
+	}
+	if !noSwitch {
+		if err := app.TaskManager.SetActive(t.ID); err != nil {
+			return err
+		}
+	}
+	app.Logger.Info("Created task: %s (id: %s)", t.Name, t.ID)
+	app.Logger.Info("Workspace: %s", t.WorkspacePath)
+	app.Logger.Info("Branch: %s", t.Branch)
+	if t.Policy != "" {
+		app.Logger.Info("Policy: %s (from %s)", t.Policy, policyPath)
+	}
+	if !noSwitch {
+		app.Logger.Info("Switched to task: %s", t.Name)
+	}
+	return nil
+}
+
+// newTask creates a task and its workspace from base, the current branch (or
+// detached HEAD) when empty, records the commit the workspace starts from and
+// stores taskPolicy, if any, as the task's policy layer.
+func newTask(app *App, name, base string, taskPolicy []byte) (*task.Task, error) {
 	if base == "" {
 		_, branch, err := gitadapter.CurrentHEAD(app.RepoRoot)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if branch != "" {
 			base = branch
 		} else {
 			head, _, err := gitadapter.CurrentHEAD(app.RepoRoot)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			base = head
 		}
 	}
 	gen, err := nanoid.Standard(8)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	id := gen()
 	branchName := app.Config.Git.BranchPrefix + sanitizeName(name) + "-" + id
 	workspacePath := filepath.Join(app.BarDir, "workspaces", id)
 	if _, err := app.WorkspaceManager.Create(id, branchName, base); err != nil {
-		return err
+		return nil, err
 	}
-	task, err := app.TaskManager.Create(id, name, base, branchName, workspacePath)
+	t, err := app.TaskManager.Create(id, name, base, branchName, workspacePath)
 	if err != nil {
 		_ = app.WorkspaceManager.Delete(workspacePath)
-		return err
+		return nil, err
 	}
-	if !noSwitch {
-		if err := app.TaskManager.SetActive(task.ID); err != nil {
-			return err
-		}
+	baseSHA, err := app.Git.Run(workspacePath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
 	}
-	app.Logger.Info("Created task: %s (id: %s)", task.Name, task.ID)
-	app.Logger.Info("Workspace: %s", task.WorkspacePath)
-	app.Logger.Info("Branch: %s", task.Branch)
-	if !noSwitch {
-		app.Logger.Info("Switched to task: %s", task.Name)
+	taskPolicyPath := ""
+	if taskPolicy != nil {
+		taskPolicyPath = filepath.Join(app.BarDir, "tasks", t.ID, "policy.yaml")
+		if err := os.WriteFile(taskPolicyPath, taskPolicy, 0o644); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return app.TaskManager.UpdateTask(t.ID, func(saved *task.Task) error {
+		saved.BaseSHA = baseSHA
+		saved.Policy = taskPolicyPath
+		return nil
+	})
 }
 
 func sanitizeName(name string) string {
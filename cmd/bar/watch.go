@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	"github.com/user/blade-agent-runtime/internal/web"
+)
+
+// watchInterval is how often a running step's workspace is re-diffed.
+const watchInterval = 2 * time.Second
+
+// watchDiff diffs the task workspace against its base every watchInterval
+// until stop is closed, calling each of onChange whenever the diff changed.
+func watchDiff(app *App, t *task.Task, stop <-chan struct{}, onChange ...func(*diff.Result)) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var lastPatchLen int
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			diffResult, err := app.DiffEngine.Generate(t.WorkspacePath, t.BaseRef)
+			if err != nil {
+				continue
+			}
+
+			// Use patch length as simple change detector
+			currentLen := len(diffResult.Patch)
+			if currentLen == lastPatchLen {
+				continue
+			}
+			lastPatchLen = currentLen
+			for _, fn := range onChange {
+				fn(diffResult)
+			}
+		}
+	}
+}
+
+// liveDiffPolicy returns a watchDiff callback that evaluates the path and
+// limit rules against the task diff while a step is still running. Each rule
+// is reported once, on stderr (with explicit carriage returns, as the
+// terminal may be in raw mode) and to the Web UI when uiServer is set.
+func liveDiffPolicy(app *App, t *task.Task, uiServer *web.Server) func(*diff.Result) {
+	reported := map[string]bool{}
+	return func(result *diff.Result) {
+		res, err := app.PolicyEngine.CheckDiff(result)
+		if err != nil {
+			return
+		}
+		for _, ev := range res.Events {
+			if reported[ev.Rule] || ev.Action == "log" {
+				continue
+			}
+			reported[ev.Rule] = true
+			msg := fmt.Sprintf("bar: policy warning: rule '%s' matched (%s)", ev.Rule, ev.Matched)
+			if len(ev.Files) > 0 {
+				msg += " in " + trim(strings.Join(ev.Files, ", "), 80)
+			}
+			if ev.Action == "block" {
+				msg += "; 'bar apply' will be blocked"
+			}
+			fmt.Fprintf(os.Stderr, "\r\n%s\r\n", msg)
+			if uiServer != nil {
+				uiServer.Broadcast("policy_warning", map[string]interface{}{
+					"task_id": t.ID,
+					"rule":    ev.Rule,
+					"source":  ev.Source,
+					"action":  ev.Action,
+					"matched": ev.Matched,
+					"reason":  ev.Reason,
+					"files":   ev.Files,
+				})
+			}
+		}
+	}
+}
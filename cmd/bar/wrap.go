@@ -11,11 +11,10 @@ import (
 	"time"
 
 	"github.com/creack/pty"
-	"github.com/jaevor/go-nanoid"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 
-	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	"github.com/user/blade-agent-runtime/internal/core/diff"
 	"github.com/user/blade-agent-runtime/internal/core/ledger"
 	"github.com/user/blade-agent-runtime/internal/core/task"
 	"github.com/user/blade-agent-runtime/internal/web"
@@ -46,6 +45,32 @@ When the command exits, BAR records a step with the diff of all changes.`,
 				return err
 			}
 
+			task, err := getOrCreateTask(app, args[0])
+			if err != nil {
+				return err
+			}
+			if err := checkNoSync(app, task); err != nil {
+				return err
+			}
+
+			// Hooks get the same BAR_* variables as the wrapped command
+			taskEnv := map[string]string{
+				"BAR_ACTIVE":    "true",
+				"BAR_TASK_ID":   task.ID,
+				"BAR_TASK_NAME": task.Name,
+				"BAR_WORKSPACE": task.WorkspacePath,
+				"BAR_BASE_REF":  task.BaseRef,
+				"BAR_REPO_ROOT": task.RepoRoot,
+			}
+
+			var launchEvents []ledger.PolicyEvent
+			if policyEnforced(app) {
+				launchEvents, err = checkPolicy(app, task.ID, policyCommand(args, task.WorkspacePath, taskEnv))
+				if err != nil {
+					return err
+				}
+			}
+
 			// Start UI by default (unless --no-ui is set)
 			if !noUI {
 				addr := fmt.Sprintf(":%d", uiPort)
@@ -63,12 +88,38 @@ When the command exits, BAR records a step with the diff of all changes.`,
 				openBrowser(url)
 			}
 
-			task, err := getOrCreateTask(app, args[0])
-			if err != nil {
+			startTime := time.Now().UTC()
+
+			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
+			ledgerManager := ledger.NewManager(taskDir)
+			step := &ledger.Step{
+				Kind:      ledger.StepKindRun,
+				StartedAt: startTime,
+				Cmd:       args,
+				Cwd:       task.WorkspacePath,
+				PID:       os.Getpid(),
+				Launcher:  "wrap",
+			}
+			if err := ledgerManager.Begin(step); err != nil {
+				if uiServer != nil {
+					uiServer.Stop()
+				}
+				return err
+			}
+			// fail finishes the started step and stops the UI before
+			// returning err, so a failed session is not left for 'bar resume'
+			fail := func(err error) error {
+				step.EndedAt = time.Now().UTC()
+				_ = ledgerManager.Finish(step)
+				if uiServer != nil {
+					uiServer.Stop()
+				}
 				return err
 			}
 
-			startTime := time.Now().UTC()
+			if err := runHooks(app, ledgerManager, step, ledger.HookPreRun, task.WorkspacePath, taskEnv); err != nil {
+				return fail(err)
+			}
 
 			childCmd := exec.Command(args[0], args[1:]...)
 			childCmd.Dir = task.WorkspacePath
@@ -81,14 +132,23 @@ When the command exits, BAR records a step with the diff of all changes.`,
 				"BAR_REPO_ROOT="+task.RepoRoot,
 			)
 
+			// Interpose on the commands the agent spawns so they are recorded
+			// as sub-steps and checked against policy too
+			recordsPath := ""
+			if app.Config.Wrap.Intercept || policyEnforced(app) {
+				shimEnv, path, err := setupShims(app, taskDir, step.StepID)
+				if err != nil {
+					return fail(err)
+				}
+				recordsPath = path
+				childCmd.Env = append(childCmd.Env, shimEnv...)
+			}
+
 			// Start command with PTY for interactive support
 			ptmx, err := pty.Start(childCmd)
 			if err != nil {
 				app.Logger.Error("Failed to start command '%s': %v", args[0], err)
-				if uiServer != nil {
-					uiServer.Stop()
-				}
-				return fmt.Errorf("failed to start command: %w", err)
+				return fail(fmt.Errorf("failed to start command: %w", err))
 			}
 			defer ptmx.Close()
 
@@ -104,9 +164,10 @@ When the command exits, BAR records a step with the diff of all changes.`,
 			}()
 			ch <- syscall.SIGWINCH // Initial resize
 
-			// Handle Ctrl+C - forward to child process
+			// Handle Ctrl+C and a closed terminal - forward to child process so
+			// we still get to record the step once it exits
 			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 			go func() {
 				for sig := range sigChan {
 					if childCmd.Process != nil {
@@ -119,33 +180,20 @@ When the command exits, BAR records a step with the diff of all changes.`,
 			app.Logger.Info("Changes will be recorded when the command exits")
 			app.Logger.Info("")
 
-			// Start live diff watcher if UI is enabled
+			// Watch the workspace to stream the live diff to the UI and warn
+			// about path and limit rules as soon as the agent trips them
 			stopWatcher := make(chan struct{})
+			var onChange []func(*diff.Result)
 			if uiServer != nil {
-				go func() {
-					ticker := time.NewTicker(2 * time.Second)
-					defer ticker.Stop()
-
-					var lastPatchLen int
-					for {
-						select {
-						case <-stopWatcher:
-							return
-						case <-ticker.C:
-							diffResult, err := app.DiffEngine.Generate(task.WorkspacePath, task.BaseRef)
-							if err != nil {
-								continue
-							}
-
-							// Use patch length as simple change detector
-							currentLen := len(diffResult.Patch)
-							if currentLen != lastPatchLen {
-								lastPatchLen = currentLen
-								uiServer.BroadcastLiveDiff(task.ID, diffResult)
-							}
-						}
-					}
-				}()
+				onChange = append(onChange, func(result *diff.Result) {
+					uiServer.BroadcastLiveDiff(task.ID, result)
+				})
+			}
+			if policyEnforced(app) && app.PolicyEngine.HasDiffRules() {
+				onChange = append(onChange, liveDiffPolicy(app, task, uiServer))
+			}
+			if len(onChange) > 0 {
+				go watchDiff(app, task, stopWatcher, onChange...)
 			}
 
 			// Set stdin to raw mode for proper PTY interaction
@@ -177,60 +225,55 @@ When the command exits, BAR records a step with the diff of all changes.`,
 			app.Logger.Info("")
 			app.Logger.Info("Command exited with code %d", exitCode)
 
-			taskDir := filepath.Join(app.BarDir, "tasks", task.ID)
-			ledgerManager := ledger.NewManager(taskDir)
-
-			stepID, err := ledgerManager.NextStepID()
-			if err != nil {
-				return err
-			}
-
-			diffResult, err := app.DiffEngine.Generate(task.WorkspacePath, task.BaseRef)
-			if err != nil {
-				return err
-			}
-
-			if diffResult.Files == 0 {
-				app.Logger.Info("No changes detected, skipping step record")
-				return nil
-			}
-
-			artifactsDir := filepath.Join(taskDir, "artifacts")
-			if err := os.MkdirAll(artifactsDir, 0o755); err != nil {
-				return err
+			step.EndedAt = endTime
+			step.DurationMs = duration.Milliseconds()
+			step.ExitCode = &exitCode
+			step.PolicyEvents = launchEvents
+			if recordsPath != "" {
+				subSteps, events, blocked, err := shimSubSteps(recordsPath)
+				if err != nil {
+					return fail(err)
+				}
+				step.SubSteps = subSteps
+				step.PolicyEvents = append(step.PolicyEvents, events...)
+				if _, err := os.Stat(recordsPath); err == nil {
+					if step.Artifacts == nil {
+						step.Artifacts = &ledger.Artifacts{}
+					}
+					step.Artifacts.Commands = filepath.Join("artifacts", step.StepID+".commands.jsonl")
+				}
+				if len(subSteps) > 0 {
+					app.Logger.Info("Intercepted %d command(s) spawned by %s", len(subSteps), args[0])
+				}
+				if len(events) > 0 {
+					app.Logger.Info("Policy: %d event(s) from spawned commands, %d command(s) blocked", len(events), blocked)
+				}
 			}
-
-			patchPath := filepath.Join(artifactsDir, stepID+".patch")
-			if err := os.WriteFile(patchPath, diffResult.Patch, 0o644); err != nil {
-				return err
+			if len(step.SubSteps) == 0 && len(step.PolicyEvents) == 0 && len(step.Hooks) == 0 {
+				unchanged, err := workspaceUnchanged(app, task, ledgerManager)
+				if err != nil {
+					return fail(err)
+				}
+				if unchanged {
+					app.Logger.Info("No changes detected, skipping step record")
+					if uiServer != nil {
+						uiServer.Stop()
+					}
+					return ledgerManager.Discard(step)
+				}
 			}
-
-			step := &ledger.Step{
-				StepID:     stepID,
-				Kind:       ledger.StepKindRun,
-				StartedAt:  startTime,
-				EndedAt:    endTime,
-				DurationMs: duration.Milliseconds(),
-				Cmd:        args,
-				Cwd:        task.WorkspacePath,
-				ExitCode:   &exitCode,
-				DiffStat: &ledger.DiffStat{
-					Files:     diffResult.Files,
-					Additions: diffResult.Additions,
-					Deletions: diffResult.Deletions,
-					FileList:  diffResult.FileList,
-				},
-				Artifacts: &ledger.Artifacts{
-					Patch: filepath.Join("artifacts", stepID+".patch"),
-				},
+			if err := runHooks(app, ledgerManager, step, ledger.HookPostRun, task.WorkspacePath, taskEnv); err != nil {
+				return fail(err)
 			}
-
-			if err := ledgerManager.Append(step); err != nil {
-				return err
+			checkPostRunHooks(app, step)
+			diffResult, err := finishStep(app, task, ledgerManager, step)
+			if err != nil {
+				return fail(err)
 			}
 
-			app.Logger.Info("Step %s recorded", stepID)
+			app.Logger.Info("Step %s recorded", step.StepID)
 			app.Logger.Info("Files changed: %d (+%d, -%d)", diffResult.Files, diffResult.Additions, diffResult.Deletions)
+			app.Logger.Info("This step: %d (+%d, -%d)", step.DeltaStat.Files, step.DeltaStat.Additions, step.DeltaStat.Deletions)
 
 			if uiServer != nil {
 				uiServer.Stop()
@@ -244,43 +287,31 @@ When the command exits, BAR records a step with the diff of all changes.`,
 	return cmd
 }
 
-func getOrCreateTask(app *App, cmdName string) (*task.Task, error) {
-	activeTask, err := app.TaskManager.GetActive()
-	if err == nil && activeTask != nil {
-		return activeTask, nil
-	}
-
-	name := "wrap-" + sanitizeName(cmdName)
-	base := ""
-	_, branch, err := gitadapter.CurrentHEAD(app.RepoRoot)
+// workspaceUnchanged reports whether the workspace is as the last step with a
+// snapshot, or the base when there is none, left it.
+func workspaceUnchanged(app *App, t *task.Task, ledgerManager *ledger.Manager) (bool, error) {
+	from, err := ledgerManager.LastSnapshot()
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	if branch != "" {
-		base = branch
-	} else {
-		head, _, err := gitadapter.CurrentHEAD(app.RepoRoot)
-		if err != nil {
-			return nil, err
-		}
-		base = head
+	if from == "" {
+		from = t.BaseRef
 	}
-
-	gen, err := nanoid.Standard(8)
+	result, err := app.DiffEngine.Generate(t.WorkspacePath, from)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	id := gen()
-	branchName := app.Config.Git.BranchPrefix + name + "-" + id
-	workspacePath := filepath.Join(app.BarDir, "workspaces", id)
+	return result.Files == 0, nil
+}
 
-	if _, err := app.WorkspaceManager.Create(id, branchName, base); err != nil {
-		return nil, err
+func getOrCreateTask(app *App, cmdName string) (*task.Task, error) {
+	activeTask, err := app.TaskManager.GetActive()
+	if err == nil && activeTask != nil {
+		return activeTask, nil
 	}
 
-	t, err := app.TaskManager.Create(id, name, base, branchName, workspacePath)
+	t, err := newTask(app, "wrap-"+sanitizeName(cmdName), "", nil)
 	if err != nil {
-		_ = app.WorkspaceManager.Delete(workspacePath)
 		return nil, err
 	}
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	"github.com/user/blade-agent-runtime/internal/core/config"
+	"github.com/user/blade-agent-runtime/internal/core/task"
+	"github.com/user/blade-agent-runtime/internal/core/workspace"
+	utillog "github.com/user/blade-agent-runtime/internal/util/log"
+)
+
+func TestGetOrCreateTask(t *testing.T) {
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	repo := t.TempDir()
+	barDir := t.TempDir()
+	git := gitadapter.NewRunner()
+	for _, args := range [][]string{{"init", "-q", "-b", "main"}, {"commit", "-q", "--allow-empty", "-m", "init"}} {
+		if _, err := git.Run(repo, args...); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	app := &App{
+		RepoRoot:         repo,
+		BarDir:           barDir,
+		Config:           config.DefaultConfig(),
+		Logger:           utillog.New(io.Discard, io.Discard, false, false),
+		Git:              git,
+		TaskManager:      task.NewManager(repo, barDir),
+		WorkspaceManager: workspace.NewManager(repo, filepath.Join(barDir, "workspaces"), git),
+	}
+
+	tk, err := getOrCreateTask(app, "My Agent")
+	if err != nil {
+		t.Fatalf("getOrCreateTask failed: %v", err)
+	}
+	head, _ := git.Run(repo, "rev-parse", "HEAD")
+	if tk.Name != "wrap-my-agent" || tk.BaseRef != "main" || tk.BaseSHA != head || tk.Policy != "" {
+		t.Errorf("unexpected task %+v, want base main at %s", tk, head)
+	}
+	if !strings.HasPrefix(tk.Branch, app.Config.Git.BranchPrefix+"wrap-my-agent-") {
+		t.Errorf("unexpected branch %q", tk.Branch)
+	}
+	if saved, _ := app.TaskManager.Get(tk.ID); saved == nil || saved.BaseSHA != head {
+		t.Errorf("expected the base commit to be saved, got %+v", saved)
+	}
+	if _, err := os.Stat(tk.WorkspacePath); err != nil {
+		t.Errorf("expected the workspace: %v", err)
+	}
+
+	// A later wrap session reuses the active task
+	again, err := getOrCreateTask(app, "other")
+	if err != nil || again.ID != tk.ID {
+		t.Errorf("expected the active task %s, got %+v, %v", tk.ID, again, err)
+	}
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"bytes"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -13,29 +14,60 @@ func NewRunner() *Runner {
 }
 
 func (r *Runner) Run(dir string, args ...string) (string, error) {
+	return r.RunWithEnv(dir, nil, args...)
+}
+
+// RunWithEnv runs git with extra environment variables appended to the
+// current process environment, e.g. GIT_INDEX_FILE for a throwaway index.
+func (r *Runner) RunWithEnv(dir string, env []string, args ...string) (string, error) {
 	cmd := exec.Command("git", args...)
 	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	var out bytes.Buffer
 	var errBuf bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &errBuf
 	err := cmd.Run()
 	if err != nil {
-		if errBuf.Len() > 0 {
-			return "", errorWithOutput(err, errBuf.String())
-		}
-		return "", err
+		return "", &GitError{Err: err, Output: errBuf.String(), Stdout: out.String()}
 	}
 	return strings.TrimSpace(out.String()), nil
 }
 
-func errorWithOutput(err error, out string) error {
-	return &GitError{Err: err, Output: out}
+// WithTempIndex calls fn with an environment that points git at a fresh,
+// empty index file, so commands like add or write-tree can run without
+// touching the repository's real index. The file is removed afterwards.
+func (r *Runner) WithTempIndex(fn func(env []string) error) error {
+	f, err := os.CreateTemp("", "bar-index-*")
+	if err != nil {
+		return err
+	}
+	indexPath := f.Name()
+	f.Close()
+	// git refuses to read an empty file as an index, so let it create one
+	os.Remove(indexPath)
+	defer os.Remove(indexPath)
+	return fn([]string{"GIT_INDEX_FILE=" + indexPath})
+}
+
+// Identity is the author and committer of the commits bar makes for its own
+// bookkeeping (snapshots and the like), so they do not depend on the user's
+// git identity being configured. Append it to the env of RunWithEnv.
+var Identity = []string{
+	"GIT_AUTHOR_NAME=bar",
+	"GIT_AUTHOR_EMAIL=bar@localhost",
+	"GIT_COMMITTER_NAME=bar",
+	"GIT_COMMITTER_EMAIL=bar@localhost",
 }
 
 type GitError struct {
 	Err    error
 	Output string
+	// Stdout is what git printed before failing, e.g. the conflicted files
+	// 'git merge-tree' lists when it exits with status 1.
+	Stdout string
 }
 
 func (e *GitError) Error() string {
@@ -42,11 +42,16 @@ func GetTaskCompletions(barDir string, includeAll bool) []Completion {
 	return completions
 }
 
-func GetStepCompletions(barDir, taskID string) []Completion {
+// GetStepCompletions completes step IDs of a task, restricted to the steps
+// matching q when it is non-nil.
+func GetStepCompletions(barDir, taskID string, q *ledger.Query) []Completion {
 	taskDir := filepath.Join(barDir, "tasks", taskID)
 	lm := ledger.NewManager(taskDir)
 
-	steps, err := lm.List()
+	if q == nil {
+		q = &ledger.Query{}
+	}
+	steps, _, err := lm.Query(q)
 	if err != nil {
 		return nil
 	}
@@ -71,6 +76,42 @@ func GetStepCompletions(barDir, taskID string) []Completion {
 	return completions
 }
 
+// GetFileCompletions completes the paths touched by the steps of a task.
+func GetFileCompletions(barDir, taskID string) []Completion {
+	lm := ledger.NewManager(filepath.Join(barDir, "tasks", taskID))
+	steps, err := lm.List()
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var completions []Completion
+	for _, s := range steps {
+		for _, f := range ledger.TouchedFiles(s) {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			completions = append(completions, Completion{
+				Value:       f,
+				Description: fmt.Sprintf("step %s", s.StepID),
+			})
+		}
+	}
+
+	return completions
+}
+
+func GetKindCompletions() []Completion {
+	return []Completion{
+		{Value: string(ledger.StepKindRun), Description: "command runs"},
+		{Value: string(ledger.StepKindApply), Description: "applied changes"},
+		{Value: string(ledger.StepKindRollback), Description: "rollbacks"},
+		{Value: string(ledger.StepKindGate), Description: "quality gate runs"},
+		{Value: string(ledger.StepKindSync), Description: "syncs with the base branch"},
+	}
+}
+
 func ToCobraCompletions(completions []Completion) []string {
 	result := make([]string, len(completions))
 	for i, c := range completions {
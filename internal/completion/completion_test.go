@@ -145,7 +145,7 @@ func TestGetStepCompletions(t *testing.T) {
 	createTestStep(t, barDir, "task1", "0002")
 	createTestStep(t, barDir, "task1", "0003")
 
-	completions := GetStepCompletions(barDir, "task1")
+	completions := GetStepCompletions(barDir, "task1", nil)
 
 	if len(completions) != 3 {
 		t.Errorf("got %d completions, want 3", len(completions))
@@ -170,13 +170,45 @@ func TestGetStepCompletions_NoTask(t *testing.T) {
 	barDir, cleanup := setupTestEnv(t)
 	defer cleanup()
 
-	completions := GetStepCompletions(barDir, "nonexistent")
+	completions := GetStepCompletions(barDir, "nonexistent", nil)
 
 	if len(completions) != 0 {
 		t.Errorf("got %d completions, want 0 for nonexistent task", len(completions))
 	}
 }
 
+func TestGetStepCompletions_Query(t *testing.T) {
+	barDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	createTestTask(t, barDir, "task1", "test-task", "active")
+	createTestStep(t, barDir, "task1", "0001")
+	lm := ledger.NewManager(filepath.Join(barDir, "tasks", "task1"))
+	lm.Append(&ledger.Step{StepID: "0002", Kind: ledger.StepKindApply})
+
+	completions := GetStepCompletions(barDir, "task1", &ledger.Query{Kinds: []ledger.StepKind{ledger.StepKindApply}})
+
+	if len(completions) != 1 || completions[0].Value != "0002" {
+		t.Errorf("expected only apply step 0002, got %v", completions)
+	}
+}
+
+func TestGetFileCompletions(t *testing.T) {
+	barDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	createTestTask(t, barDir, "task1", "test-task", "active")
+	lm := ledger.NewManager(filepath.Join(barDir, "tasks", "task1"))
+	lm.Append(&ledger.Step{StepID: "0001", Kind: ledger.StepKindRun, DiffStat: &ledger.DiffStat{FileList: []string{"main.go", "util.go"}}})
+	lm.Append(&ledger.Step{StepID: "0002", Kind: ledger.StepKindRun, DeltaStat: &ledger.DiffStat{FileList: []string{"main.go"}}})
+
+	completions := GetFileCompletions(barDir, "task1")
+
+	if len(completions) != 2 {
+		t.Errorf("got %d completions, want 2 unique files", len(completions))
+	}
+}
+
 func TestCompletion_HasDescription(t *testing.T) {
 	barDir, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -1,9 +1,53 @@
 package apply
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+
 	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+// Modes of 'bar apply', recorded in the apply step's Mode.
+const (
+	// ModeSquash commits all task changes as a single commit (the default).
+	ModeSquash = "squash"
+	// ModeSteps commits each recorded step separately.
+	ModeSteps = "steps"
+	// ModeMerge commits each recorded step on the task branch and merges it
+	// into the base branch with a merge commit.
+	ModeMerge = "merge"
+	// ModePatch writes the per-step commits as a mailbox patch series and
+	// leaves the base branch untouched.
+	ModePatch = "patch"
 )
 
+// Modes lists the apply modes in the order they are documented.
+var Modes = []string{ModeSquash, ModeSteps, ModeMerge, ModePatch}
+
+// ErrNothingToApply is returned when the task has no changes to commit.
+var ErrNothingToApply = errors.New("nothing to apply: the task has no changes")
+
+// Step is a recorded workspace state to commit: the snapshot of a ledger step
+// and the commit message for it.
+type Step struct {
+	Snapshot string
+	Message  string
+	// StepID names the ledger step, for reporting.
+	StepID string
+}
+
+// Target is where applied commits go. BaseRef is advanced to them unless
+// Branch is set: then Branch is created or reset to the task branch, after
+// rebasing the task branch onto BaseRef when Rebase is set, and BaseRef is
+// left untouched.
+type Target struct {
+	BaseRef string
+	Branch  string
+	Rebase  bool
+}
+
 type Engine struct {
 	Git *gitadapter.Runner
 }
@@ -12,7 +56,9 @@ func NewEngine(git *gitadapter.Runner) *Engine {
 	return &Engine{Git: git}
 }
 
-func (e *Engine) Commit(workspacePath string, repoRoot string, baseRef string, message string) (string, error) {
+// Commit commits all task changes as one commit on the task branch and brings
+// it to target, returning the commit (as rebased, see Target).
+func (e *Engine) Commit(workspacePath string, repoRoot string, target Target, message string) (string, error) {
 	if message == "" {
 		message = "bar: apply changes"
 	}
@@ -26,17 +72,213 @@ func (e *Engine) Commit(workspacePath string, repoRoot string, baseRef string, m
 	if err != nil {
 		return "", err
 	}
-	branch, err := e.Git.Run(workspacePath, "rev-parse", "--abbrev-ref", "HEAD")
+	commits, err := e.integrate(workspacePath, repoRoot, target, []string{sha})
 	if err != nil {
 		return "", err
 	}
-	if _, err := e.Git.Run(repoRoot, "fetch", ".", branch+":"+baseRef); err != nil {
-		if _, err := e.Git.Run(repoRoot, "checkout", baseRef); err != nil {
-			return "", err
+	return commits[0], nil
+}
+
+// CommitSteps commits the task as one commit per step (see commitSteps),
+// moves the task branch to the last of them and brings them to target. It
+// returns the commits in order.
+func (e *Engine) CommitSteps(workspacePath string, repoRoot string, target Target, steps []Step, message string) ([]string, error) {
+	commits, err := e.commitSteps(workspacePath, steps, message)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.Git.Run(workspacePath, "reset", "-q", commits[len(commits)-1]); err != nil {
+		return nil, err
+	}
+	return e.integrate(workspacePath, repoRoot, target, commits)
+}
+
+// Merge commits the task as one commit per step on the task branch like
+// CommitSteps and merges the branch into baseRef with a merge commit, even
+// when a fast-forward is possible. The merge is computed with 'git merge-tree'
+// so a conflict fails without touching any checkout. It returns the merge
+// commit and the step commits.
+func (e *Engine) Merge(workspacePath string, repoRoot string, baseRef string, steps []Step, message string) (string, []string, error) {
+	base, err := e.Git.Run(repoRoot, "rev-parse", "refs/heads/"+baseRef)
+	if err != nil {
+		return "", nil, err
+	}
+	commits, err := e.commitSteps(workspacePath, steps, message)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := e.Git.Run(workspacePath, "reset", "-q", commits[len(commits)-1]); err != nil {
+		return "", nil, err
+	}
+	branch, err := e.Git.Run(workspacePath, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", nil, err
+	}
+	if message == "" {
+		message = "bar: merge " + branch
+	}
+	tree, conflicts, err := e.mergeTree(repoRoot, base, commits[len(commits)-1])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(conflicts) > 0 {
+		return "", nil, barerrors.ApplyConflict(baseRef, conflicts)
+	}
+	sha, err := e.Git.Run(repoRoot, "commit-tree", tree, "-p", base, "-p", commits[len(commits)-1], "-m", message)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := e.advance(repoRoot, baseRef, base, sha); err != nil {
+		return "", nil, err
+	}
+	return sha, commits, nil
+}
+
+// FormatPatch writes the task as a mailbox patch series into dir, one patch
+// per step (see commitSteps), and returns the patch files in order. Neither
+// the task branch nor baseRef is moved.
+func (e *Engine) FormatPatch(workspacePath string, steps []Step, message string, dir string) ([]string, error) {
+	base, err := e.Git.Run(workspacePath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	commits, err := e.commitSteps(workspacePath, steps, message)
+	if err != nil {
+		return nil, err
+	}
+	// commitSteps staged the workspace; leave the index as it was.
+	if _, err := e.Git.Run(workspacePath, "reset", "-q"); err != nil {
+		return nil, err
+	}
+	out, err := e.Git.Run(workspacePath, "format-patch", "-o", dir, base+".."+commits[len(commits)-1])
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, f := range strings.Split(out, "\n") {
+		if f != "" {
+			files = append(files, f)
 		}
-		if _, err := e.Git.Run(repoRoot, "cherry-pick", sha); err != nil {
-			return "", err
+	}
+	return files, nil
+}
+
+// commitSteps creates a chain of commits on top of the workspace HEAD, one for
+// each step snapshot that changes the tree and a last one with message for
+// changes made after the last step. The commits are not referenced by any
+// branch yet. It stages the whole workspace and fails with ErrNothingToApply
+// when there is nothing to commit.
+func (e *Engine) commitSteps(workspacePath string, steps []Step, message string) ([]string, error) {
+	if message == "" {
+		message = "bar: apply changes"
+	}
+	parent, err := e.Git.Run(workspacePath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := e.Git.Run(workspacePath, "rev-parse", "HEAD^{tree}")
+	if err != nil {
+		return nil, err
+	}
+	commits := []string{}
+	commit := func(tree string, msg string) error {
+		if tree == parentTree {
+			return nil
 		}
+		sha, err := e.Git.Run(workspacePath, "commit-tree", tree, "-p", parent, "-m", msg)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, sha)
+		parent, parentTree = sha, tree
+		return nil
+	}
+	for _, s := range steps {
+		tree, err := e.Git.Run(workspacePath, "rev-parse", s.Snapshot+"^{tree}")
+		if err != nil {
+			return nil, err
+		}
+		if err := commit(tree, s.Message); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := e.Git.Run(workspacePath, "add", "-A"); err != nil {
+		return nil, err
+	}
+	tree, err := e.Git.Run(workspacePath, "write-tree")
+	if err != nil {
+		return nil, err
+	}
+	if err := commit(tree, message); err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, ErrNothingToApply
+	}
+	return commits, nil
+}
+
+// integrate brings commits, the last ones of the task branch checked out in
+// workspacePath, to target. Onto the base branch it first rebases the task
+// branch in the workspace if the base has moved on, then fast-forwards the
+// base to it (see advance); onto a target branch it points that branch at the
+// task branch. It returns the commits as they end up, which differ from
+// commits after a rebase.
+func (e *Engine) integrate(workspacePath string, repoRoot string, target Target, commits []string) ([]string, error) {
+	if target.Branch != "" {
+		if target.Rebase {
+			var err error
+			if commits, err = e.rebase(workspacePath, target.BaseRef, len(commits)); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := e.Git.Run(workspacePath, "branch", "-f", target.Branch, "HEAD"); err != nil {
+			return nil, err
+		}
+		return commits, nil
+	}
+	base, err := e.Git.Run(repoRoot, "rev-parse", "refs/heads/"+target.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.Git.Run(workspacePath, "merge-base", "--is-ancestor", base, "HEAD"); err != nil {
+		if commits, err = e.rebase(workspacePath, target.BaseRef, len(commits)); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.advance(repoRoot, target.BaseRef, base, commits[len(commits)-1]); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// rebase rebases the task branch checked out in workspacePath onto baseRef
+// and returns its last n commits. A conflicting rebase is aborted, leaving the
+// task branch as it was.
+func (e *Engine) rebase(workspacePath string, baseRef string, n int) ([]string, error) {
+	if _, err := e.Git.Run(workspacePath, "rebase", "-q", baseRef); err != nil {
+		_, _ = e.Git.Run(workspacePath, "rebase", "--abort")
+		return nil, err
+	}
+	out, err := e.Git.Run(workspacePath, "rev-list", "--reverse", "-n", strconv.Itoa(n), "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// advance moves the base branch from old to sha, a descendant of it. Where
+// the branch is checked out its working tree is fast-forwarded along with it,
+// which Preflight has made sure is clean; elsewhere only the ref moves.
+func (e *Engine) advance(repoRoot string, baseRef string, old string, sha string) error {
+	checkout, err := e.checkoutOf(repoRoot, baseRef)
+	if err != nil {
+		return err
+	}
+	if checkout != "" {
+		_, err = e.Git.Run(checkout, "merge", "-q", "--ff-only", sha)
+		return err
 	}
-	return sha, nil
+	_, err = e.Git.Run(repoRoot, "update-ref", "refs/heads/"+baseRef, sha, old)
+	return err
 }
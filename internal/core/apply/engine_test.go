@@ -0,0 +1,284 @@
+package apply
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	"github.com/user/blade-agent-runtime/internal/core/workspace"
+)
+
+// setupTask creates a repository on main with a task worktree on bar/task and
+// records two steps in it, returning the engine, repository, workspace and
+// steps. The second step is followed by an unrecorded change.
+func setupTask(t *testing.T) (*Engine, string, string, []Step) {
+	t.Helper()
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	repo := t.TempDir()
+	git := gitadapter.NewRunner()
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		out, err := git.Run(dir, args...)
+		if err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+		return out
+	}
+	run(repo, "init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("a\n"), 0o644)
+	run(repo, "add", "-A")
+	run(repo, "commit", "-q", "-m", "init")
+	run(repo, "checkout", "-q", "--detach")
+
+	wm := workspace.NewManager(repo, filepath.Join(t.TempDir(), "workspaces"), git)
+	ws, err := wm.Create("task", "bar/task", "main")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	steps := []Step{}
+	for i, content := range []string{"step1\n", "step2\n"} {
+		os.WriteFile(filepath.Join(ws, "a.txt"), []byte(content), 0o644)
+		snap, err := wm.Snapshot(ws, "", "snapshot")
+		if err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		steps = append(steps, Step{Snapshot: snap, Message: "step " + string(rune('1'+i))})
+	}
+	os.WriteFile(filepath.Join(ws, "b.txt"), []byte("b\n"), 0o644)
+	return NewEngine(git), repo, ws, steps
+}
+
+func subjects(t *testing.T, git *gitadapter.Runner, dir, rev string) string {
+	t.Helper()
+	out, err := git.Run(dir, "log", "--format=%s", rev)
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	return strings.ReplaceAll(out, "\n", "|")
+}
+
+func TestEngine_CommitSteps(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	commits, err := e.CommitSteps(ws, repo, Target{BaseRef: "main"}, steps, "rest")
+	if err != nil {
+		t.Fatalf("CommitSteps failed: %v", err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("expected 3 commits, got %v", commits)
+	}
+	if got := subjects(t, e.Git, repo, "main"); got != "rest|step 2|step 1|init" {
+		t.Errorf("main history = %q", got)
+	}
+	if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "" {
+		t.Errorf("expected a clean workspace, got %q", status)
+	}
+}
+
+func TestEngine_CommitSteps_SkipsUnchangedSteps(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	steps = append(steps, Step{Snapshot: steps[1].Snapshot, Message: "no-op"})
+	commits, err := e.CommitSteps(ws, repo, Target{BaseRef: "main"}, steps, "rest")
+	if err != nil {
+		t.Fatalf("CommitSteps failed: %v", err)
+	}
+	if len(commits) != 3 {
+		t.Errorf("expected the unchanged step to be skipped, got %d commits", len(commits))
+	}
+}
+
+func TestEngine_Merge(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	sha, commits, err := e.Merge(ws, repo, "main", steps, "merge task")
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if len(commits) != 3 {
+		t.Errorf("expected 3 step commits, got %v", commits)
+	}
+	parents, _ := e.Git.Run(repo, "rev-list", "--parents", "-n", "1", sha)
+	if len(strings.Fields(parents)) != 3 {
+		t.Errorf("expected a merge commit, got parents %q", parents)
+	}
+	if msg, _ := e.Git.Run(repo, "log", "-1", "--format=%s", "main"); msg != "merge task" {
+		t.Errorf("merge message = %q", msg)
+	}
+}
+
+func TestEngine_FormatPatch(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	before, _ := e.Git.Run(repo, "rev-parse", "main")
+	dir := t.TempDir()
+	files, err := e.FormatPatch(ws, steps, "rest", dir)
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+	if len(files) != 3 || !strings.HasSuffix(files[0], "0001-step-1.patch") {
+		t.Fatalf("unexpected patch files %v", files)
+	}
+	data, _ := os.ReadFile(files[2])
+	if !strings.Contains(string(data), "Subject: [PATCH 3/3] rest") || !strings.Contains(string(data), "+b") {
+		t.Errorf("unexpected last patch:\n%s", data)
+	}
+	if after, _ := e.Git.Run(repo, "rev-parse", "main"); after != before {
+		t.Error("FormatPatch should not move the base branch")
+	}
+	if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+		t.Errorf("FormatPatch should leave the workspace as it was, got %q", status)
+	}
+}
+
+func TestEngine_NothingToApply(t *testing.T) {
+	e, repo, ws, _ := setupTask(t)
+	e.Git.Run(ws, "checkout", "--", "a.txt")
+	os.Remove(filepath.Join(ws, "b.txt"))
+	if _, err := e.CommitSteps(ws, repo, Target{BaseRef: "main"}, nil, ""); err != ErrNothingToApply {
+		t.Errorf("expected ErrNothingToApply, got %v", err)
+	}
+}
+
+func TestEngine_CommitToBranch(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	before, _ := e.Git.Run(repo, "rev-parse", "main")
+	// Move main on after the task started.
+	os.WriteFile(filepath.Join(repo, "c.txt"), []byte("c\n"), 0o644)
+	e.Git.Run(repo, "checkout", "-q", "main")
+	e.Git.Run(repo, "add", "c.txt")
+	e.Git.Run(repo, "commit", "-q", "-m", "upstream")
+	upstream, _ := e.Git.Run(repo, "rev-parse", "main")
+
+	commits, err := e.CommitSteps(ws, repo, Target{BaseRef: "main", Branch: "pr/task", Rebase: true}, steps, "rest")
+	if err != nil {
+		t.Fatalf("CommitSteps failed: %v", err)
+	}
+	if after, _ := e.Git.Run(repo, "rev-parse", "main"); after != upstream || after == before {
+		t.Error("applying to a branch should leave the base branch untouched")
+	}
+	if got := subjects(t, e.Git, repo, "pr/task"); got != "rest|step 2|step 1|upstream|init" {
+		t.Errorf("pr/task history = %q", got)
+	}
+	tip, _ := e.Git.Run(repo, "rev-parse", "pr/task")
+	if len(commits) != 3 || commits[2] != tip {
+		t.Errorf("expected the rebased commits ending at %s, got %v", tip, commits)
+	}
+
+	sha, err := e.Commit(ws, repo, Target{BaseRef: "main", Branch: "pr/task"}, "noop")
+	if err == nil || sha != "" {
+		t.Errorf("expected nothing to commit, got %q", sha)
+	}
+}
+
+// moveBase checks main out in repo and commits content to file on it.
+func moveBase(t *testing.T, e *Engine, repo, file, content string) {
+	t.Helper()
+	e.Git.Run(repo, "checkout", "-q", "main")
+	os.WriteFile(filepath.Join(repo, file), []byte(content), 0o644)
+	e.Git.Run(repo, "add", file)
+	if _, err := e.Git.Run(repo, "commit", "-q", "-m", "upstream "+file); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+}
+
+func TestEngine_WorkspaceCommit(t *testing.T) {
+	e, _, ws, _ := setupTask(t)
+	sha, err := e.workspaceCommit(ws, "bar: test")
+	if err != nil {
+		t.Fatalf("workspaceCommit failed: %v", err)
+	}
+	if who, _ := e.Git.Run(ws, "log", "-1", "--format=%an <%ae> %cn <%ce>", sha); who != "bar <bar@localhost> bar <bar@localhost>" {
+		t.Errorf("expected the commit to be made as bar, got %q", who)
+	}
+	if files, _ := e.Git.Run(ws, "show", "--format=", "--name-only", sha); files != "a.txt\nb.txt" {
+		t.Errorf("expected the uncommitted changes in the commit, got %q", files)
+	}
+	if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+		t.Errorf("workspaceCommit should not touch the workspace, got %q", status)
+	}
+}
+
+func TestEngine_Preflight(t *testing.T) {
+	e, repo, ws, _ := setupTask(t)
+	target := Target{BaseRef: "main"}
+	p, err := e.Preflight(ws, repo, target, "")
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if p.Moved() || p.Checkout != "" || p.Err("main") != nil {
+		t.Errorf("expected a clean preflight, got %+v", p)
+	}
+
+	moveBase(t, e, repo, "a.txt", "upstream\n")
+	before, _ := e.Git.Run(repo, "rev-parse", "main")
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("local\n"), 0o644)
+	os.WriteFile(filepath.Join(repo, "new file.txt"), []byte("new\n"), 0o644)
+	p, err = e.Preflight(ws, repo, target, "")
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if p.Behind != 1 || p.CurrentSHA != before {
+		t.Errorf("expected the base to be 1 commit ahead, got %+v", p)
+	}
+	if p.Checkout != repo || !reflect.DeepEqual(p.Dirty, []string{"a.txt", "new file.txt"}) {
+		t.Errorf("expected the dirty main checkout, got %q %v", p.Checkout, p.Dirty)
+	}
+	if len(p.Conflicts) != 1 || p.Conflicts[0] != "a.txt" {
+		t.Errorf("expected a conflict in a.txt, got %v", p.Conflicts)
+	}
+	if p.Err("main") == nil {
+		t.Error("expected the preflight to fail")
+	}
+	if after, _ := e.Git.Run(repo, "rev-parse", "main"); after != before {
+		t.Error("Preflight should not move the base branch")
+	}
+	if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+		t.Errorf("Preflight should not touch the workspace, got %q", status)
+	}
+
+	p, err = e.Preflight(ws, repo, Target{BaseRef: "main", Branch: "pr/task"}, "")
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if p.Err("main") != nil {
+		t.Errorf("applying to a branch should not need a clean base, got %+v", p)
+	}
+}
+
+func TestEngine_CommitSteps_BaseMoved(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	moveBase(t, e, repo, "c.txt", "c\n")
+	commits, err := e.CommitSteps(ws, repo, Target{BaseRef: "main"}, steps, "rest")
+	if err != nil {
+		t.Fatalf("CommitSteps failed: %v", err)
+	}
+	if got := subjects(t, e.Git, repo, "main"); got != "rest|step 2|step 1|upstream c.txt|init" {
+		t.Errorf("main history = %q", got)
+	}
+	if tip, _ := e.Git.Run(repo, "rev-parse", "main"); commits[2] != tip {
+		t.Errorf("expected main at the rebased commits, got %v", commits)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "b.txt")); err != nil {
+		t.Error("expected the main checkout to be fast-forwarded")
+	}
+}
+
+func TestEngine_Merge_Conflict(t *testing.T) {
+	e, repo, ws, steps := setupTask(t)
+	moveBase(t, e, repo, "a.txt", "upstream\n")
+	before, _ := e.Git.Run(repo, "rev-parse", "main")
+	if _, _, err := e.Merge(ws, repo, "main", steps, ""); err == nil {
+		t.Fatal("expected a conflict")
+	}
+	if after, _ := e.Git.Run(repo, "rev-parse", "main"); after != before {
+		t.Error("a conflicting merge should leave the base branch alone")
+	}
+	if status, _ := e.Git.Run(repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("a conflicting merge should leave the main checkout alone, got %q", status)
+	}
+}
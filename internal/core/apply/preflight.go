@@ -0,0 +1,178 @@
+package apply
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+// Preflight is what applying a task would run into, found without changing
+// the repository.
+type Preflight struct {
+	// StartSHA is the base commit the task branch is based on, CurrentSHA
+	// the commit the base branch points at now and Behind how many commits
+	// it has gained since.
+	StartSHA   string
+	CurrentSHA string
+	Behind     int
+	// Checkout is the working tree the base branch is checked out in, if
+	// any: applying fast-forwards it, so it must not have local changes.
+	// Dirty lists its modified and untracked files.
+	Checkout string
+	Dirty    []string
+	// Conflicts lists the files the task's changes conflict in with the
+	// changes made to the base branch since StartSHA.
+	Conflicts []string
+}
+
+// Moved reports whether the base branch has moved on since the task started.
+func (p *Preflight) Moved() bool {
+	return p.Behind > 0
+}
+
+// Err returns why applying would fail, or nil.
+func (p *Preflight) Err(baseRef string) error {
+	if len(p.Dirty) > 0 {
+		return barerrors.BaseCheckoutDirty(baseRef, p.Checkout, p.Dirty)
+	}
+	if len(p.Conflicts) > 0 {
+		return barerrors.ApplyConflict(baseRef, p.Conflicts)
+	}
+	return nil
+}
+
+// Preflight checks what applying the task in workspacePath to target would
+// run into: whether the base branch moved since startSHA (the base commit the
+// task started from; empty to use the merge base), whether the checkout of
+// the base branch has local changes and whether the task's changes, including
+// uncommitted ones, conflict with the base branch's. Only the first two
+// matter when applying to a target branch without rebasing.
+func (e *Engine) Preflight(workspacePath string, repoRoot string, target Target, startSHA string) (*Preflight, error) {
+	current, err := e.Git.Run(repoRoot, "rev-parse", "--verify", "-q", "refs/heads/"+target.BaseRef)
+	if err != nil {
+		return nil, barerrors.GitOperation("resolve base branch "+target.BaseRef+" (applying needs a local branch)", err)
+	}
+	p := &Preflight{StartSHA: startSHA, CurrentSHA: current}
+	if p.StartSHA == "" {
+		if p.StartSHA, err = e.Git.Run(workspacePath, "merge-base", "HEAD", current); err != nil {
+			return nil, err
+		}
+	}
+	count, err := e.Git.Run(repoRoot, "rev-list", "--count", p.StartSHA+".."+current)
+	if err != nil {
+		return nil, err
+	}
+	p.Behind, _ = strconv.Atoi(count)
+	if target.Branch != "" && !target.Rebase {
+		return p, nil
+	}
+	if target.Branch == "" {
+		if p.Checkout, err = e.checkoutOf(repoRoot, target.BaseRef); err != nil {
+			return nil, err
+		}
+		if p.Checkout != "" {
+			out, err := e.Git.Run(p.Checkout, "status", "--porcelain=v2", "-z")
+			if err != nil {
+				return nil, err
+			}
+			p.Dirty = porcelainFiles(out)
+		}
+	}
+	if p.Moved() {
+		tip, err := e.workspaceCommit(workspacePath, "bar: preflight")
+		if err != nil {
+			return nil, err
+		}
+		if _, p.Conflicts, err = e.mergeTree(repoRoot, current, tip); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// workspaceCommit records the workspace state, uncommitted changes included,
+// as a commit on top of its HEAD without touching its index or branch. Like
+// workspace snapshots it is made as bar, see gitadapter.Identity.
+func (e *Engine) workspaceCommit(workspacePath string, message string) (string, error) {
+	var sha string
+	err := e.Git.WithTempIndex(func(env []string) error {
+		env = append(env, gitadapter.Identity...)
+		if _, err := e.Git.RunWithEnv(workspacePath, env, "read-tree", "HEAD"); err != nil {
+			return err
+		}
+		if _, err := e.Git.RunWithEnv(workspacePath, env, "add", "-A"); err != nil {
+			return err
+		}
+		tree, err := e.Git.RunWithEnv(workspacePath, env, "write-tree")
+		if err != nil {
+			return err
+		}
+		sha, err = e.Git.RunWithEnv(workspacePath, env, "commit-tree", tree, "-p", "HEAD", "-m", message)
+		return err
+	})
+	return sha, err
+}
+
+// porcelainFiles returns the paths listed by 'git status --porcelain=v2 -z'.
+// Unlike v1 entries, v2 ones never start with a space, which Run would trim.
+func porcelainFiles(out string) []string {
+	// Fields before the path of ordinary, renamed or copied, and unmerged
+	// entries; untracked and ignored ones have the path right after "?"/"!".
+	fields := map[string]int{"1": 8, "2": 9, "u": 10, "?": 1, "!": 1}
+	files := []string{}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		kind, _, _ := strings.Cut(entries[i], " ")
+		n, ok := fields[kind]
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(entries[i], " ", n+1)
+		if len(parts) == n+1 {
+			files = append(files, parts[n])
+		}
+		if kind == "2" {
+			// The original path follows as its own entry.
+			i++
+		}
+	}
+	return files
+}
+
+// mergeTree merges commits ours and theirs in memory with 'git merge-tree'
+// and returns the resulting tree, or the conflicted files when they conflict.
+func (e *Engine) mergeTree(repoRoot string, ours string, theirs string) (string, []string, error) {
+	out, err := e.Git.Run(repoRoot, "merge-tree", "--write-tree", "--name-only", "--no-messages", ours, theirs)
+	if err != nil {
+		var gitErr *gitadapter.GitError
+		if !errors.As(err, &gitErr) || gitErr.Output != "" || gitErr.Stdout == "" {
+			return "", nil, err
+		}
+		// Exit status 1: the first line is the tree with conflict markers,
+		// the others the conflicted files.
+		lines := strings.Split(strings.TrimSpace(gitErr.Stdout), "\n")
+		return "", lines[1:], nil
+	}
+	return strings.SplitN(out, "\n", 2)[0], nil, nil
+}
+
+// checkoutOf returns the working tree baseRef is checked out in, or "".
+func (e *Engine) checkoutOf(repoRoot string, baseRef string) (string, error) {
+	out, err := e.Git.Run(repoRoot, "worktree", "list", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	path := ""
+	for _, line := range strings.Split(out, "\n") {
+		if p, ok := strings.CutPrefix(line, "worktree "); ok {
+			path = p
+		}
+		if line == "branch refs/heads/"+baseRef {
+			return path, nil
+		}
+	}
+	return "", nil
+}
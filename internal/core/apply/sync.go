@@ -0,0 +1,204 @@
+package apply
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+// Modes of 'bar sync', recorded in the sync step's Mode.
+const (
+	// SyncRebase rebases the task branch onto the base branch (the default).
+	SyncRebase = "rebase"
+	// SyncMerge merges the base branch into the task branch.
+	SyncMerge = "merge"
+)
+
+// SyncState is a sync of a task branch onto its base branch. While conflicts
+// are being resolved it is kept by the caller to continue or abort the sync.
+type SyncState struct {
+	Mode string `json:"mode"`
+	// OldBase is the base commit the task branch was based on, NewBase the
+	// commit the base branch points at now.
+	OldBase string `json:"old_base"`
+	NewBase string `json:"new_base"`
+	// Head is the task branch before syncing. Snapshot is Head plus the
+	// uncommitted workspace changes, committed on the task branch for the
+	// duration of the sync; it equals Head when there were none.
+	Head     string `json:"head"`
+	Snapshot string `json:"snapshot"`
+	// Conflicts lists the files that conflicted, across all attempts.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// UpToDate reports whether the task branch already contains the base branch.
+func (s *SyncState) UpToDate() bool {
+	return s.OldBase == s.NewBase
+}
+
+// Sync brings the task branch checked out in workspacePath up to date with
+// baseRef by rebasing or merging (see SyncRebase and SyncMerge). Uncommitted
+// changes are committed first and turned back into uncommitted changes
+// afterwards. On conflicts the rebase or merge is left in progress in the
+// workspace and a SyncConflict error is returned with the state, to be passed
+// to ContinueSync once the conflicts are resolved or to AbortSync.
+func (e *Engine) Sync(workspacePath string, repoRoot string, baseRef string, mode string) (*SyncState, error) {
+	newBase, err := e.Git.Run(repoRoot, "rev-parse", "--verify", "-q", "refs/heads/"+baseRef)
+	if err != nil {
+		return nil, barerrors.GitOperation("resolve base branch "+baseRef+" (syncing needs a local branch)", err)
+	}
+	s := &SyncState{Mode: mode, NewBase: newBase}
+	if s.Head, err = e.Git.Run(workspacePath, "rev-parse", "HEAD"); err != nil {
+		return nil, err
+	}
+	if s.OldBase, err = e.Git.Run(workspacePath, "merge-base", "HEAD", newBase); err != nil {
+		return nil, err
+	}
+	if s.UpToDate() {
+		return s, nil
+	}
+	s.Snapshot = s.Head
+	status, err := e.Git.Run(workspacePath, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if status != "" {
+		if s.Snapshot, err = e.workspaceCommit(workspacePath, "bar: sync snapshot"); err != nil {
+			return nil, err
+		}
+		if _, err := e.Git.Run(workspacePath, "reset", "-q", s.Snapshot); err != nil {
+			return nil, err
+		}
+	}
+	if mode == SyncMerge {
+		_, err = e.Git.Run(workspacePath, "merge", "-q", "-m", "bar: sync with "+baseRef, newBase)
+	} else {
+		// Keep the snapshot commit even if it becomes empty, finishSync
+		// expects it on top.
+		_, err = e.Git.Run(workspacePath, "rebase", "-q", "--empty=keep", newBase)
+	}
+	if err != nil {
+		return s, e.syncFailed(workspacePath, baseRef, s, err)
+	}
+	return s, e.finishSync(workspacePath, s)
+}
+
+// ContinueSync stages the resolved conflicts of a sync left in progress by
+// Sync and carries on with it. Files still containing conflict markers fail
+// it with a SyncConflict error, as do conflicts in later rebased commits.
+func (e *Engine) ContinueSync(workspacePath string, baseRef string, s *SyncState) error {
+	unmerged, err := e.Git.Run(workspacePath, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return err
+	}
+	unresolved := []string{}
+	for _, f := range strings.Fields(unmerged) {
+		if hasConflictMarkers(filepath.Join(workspacePath, f)) {
+			unresolved = append(unresolved, f)
+		}
+	}
+	if len(unresolved) > 0 {
+		return barerrors.SyncConflict(baseRef, workspacePath, unresolved)
+	}
+	if _, err := e.Git.Run(workspacePath, "add", "-A"); err != nil {
+		return err
+	}
+	if s.Mode == SyncMerge {
+		_, err = e.Git.Run(workspacePath, "commit", "-q", "--no-edit")
+	} else {
+		_, err = e.Git.RunWithEnv(workspacePath, []string{"GIT_EDITOR=true"}, "rebase", "--continue")
+	}
+	if err != nil {
+		return e.syncFailed(workspacePath, baseRef, s, err)
+	}
+	return e.finishSync(workspacePath, s)
+}
+
+// AbortSync stops a sync left in progress by Sync and returns the workspace
+// to its state before it, uncommitted changes included.
+func (e *Engine) AbortSync(workspacePath string, s *SyncState) error {
+	if s.Mode == SyncMerge {
+		_, _ = e.Git.Run(workspacePath, "merge", "--abort")
+	} else {
+		_, _ = e.Git.Run(workspacePath, "rebase", "--abort")
+	}
+	if _, err := e.Git.Run(workspacePath, "reset", "-q", "--hard", s.Snapshot); err != nil {
+		return err
+	}
+	_, err := e.Git.Run(workspacePath, "reset", "-q", s.Head)
+	return err
+}
+
+// syncFailed records the conflicts of a failed rebase or merge in s and
+// returns them as a SyncConflict error. A failure without conflicts is
+// aborted and returned as is.
+func (e *Engine) syncFailed(workspacePath string, baseRef string, s *SyncState, err error) error {
+	out, diffErr := e.Git.Run(workspacePath, "diff", "--name-only", "--diff-filter=U")
+	conflicts := strings.Fields(out)
+	if diffErr != nil || len(conflicts) == 0 {
+		_ = e.AbortSync(workspacePath, s)
+		return err
+	}
+	for _, f := range conflicts {
+		if !slices.Contains(s.Conflicts, f) {
+			s.Conflicts = append(s.Conflicts, f)
+		}
+	}
+	return barerrors.SyncConflict(baseRef, workspacePath, conflicts)
+}
+
+// finishSync turns the snapshot commit Sync made of uncommitted changes back
+// into uncommitted changes on top of the synced task branch.
+func (e *Engine) finishSync(workspacePath string, s *SyncState) error {
+	if s.Snapshot == s.Head {
+		return nil
+	}
+	if s.Mode != SyncMerge {
+		_, err := e.Git.Run(workspacePath, "reset", "-q", "HEAD~1")
+		return err
+	}
+	// The base was merged into the snapshot commit; move the task branch to
+	// the merge of its previous head instead: the base itself when it had no
+	// commits of its own, a merge commit otherwise.
+	target := s.NewBase
+	if _, err := e.Git.Run(workspacePath, "merge-base", "--is-ancestor", s.Head, s.NewBase); err != nil {
+		tree, conflicts, err := e.mergeTree(workspacePath, s.Head, s.NewBase)
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			// Only resolvable together with the uncommitted changes: keep
+			// the merge on top of the snapshot commit.
+			return nil
+		}
+		msg, err := e.Git.Run(workspacePath, "log", "-1", "--format=%B", "HEAD")
+		if err != nil {
+			return err
+		}
+		if target, err = e.Git.Run(workspacePath, "commit-tree", tree, "-p", s.Head, "-p", s.NewBase, "-m", msg); err != nil {
+			return err
+		}
+	}
+	_, err := e.Git.Run(workspacePath, "reset", "-q", target)
+	return err
+}
+
+// hasConflictMarkers reports whether a file has a line starting a conflict.
+func hasConflictMarkers(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "<<<<<<< ") {
+			return true
+		}
+	}
+	return false
+}
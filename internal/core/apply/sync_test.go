@@ -0,0 +1,124 @@
+package apply
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
+)
+
+func TestEngine_Sync(t *testing.T) {
+	for _, mode := range []string{SyncRebase, SyncMerge} {
+		t.Run(mode, func(t *testing.T) {
+			e, repo, ws, _ := setupTask(t)
+			old, _ := e.Git.Run(ws, "rev-parse", "HEAD")
+			moveBase(t, e, repo, "c.txt", "c\n")
+			upstream, _ := e.Git.Run(repo, "rev-parse", "main")
+
+			s, err := e.Sync(ws, repo, "main", mode)
+			if err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+			if s.OldBase != old || s.NewBase != upstream || s.UpToDate() {
+				t.Errorf("unexpected sync state %+v", s)
+			}
+			if head, _ := e.Git.Run(ws, "rev-parse", "HEAD"); head != upstream {
+				t.Errorf("expected the task branch at %s, got %s", upstream, head)
+			}
+			if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+				t.Errorf("expected the uncommitted changes to be kept, got %q", status)
+			}
+			if _, err := os.Stat(filepath.Join(ws, "c.txt")); err != nil {
+				t.Error("expected the upstream file in the workspace")
+			}
+
+			s, err = e.Sync(ws, repo, "main", mode)
+			if err != nil || !s.UpToDate() {
+				t.Errorf("expected the task to be up to date, got %+v, %v", s, err)
+			}
+		})
+	}
+}
+
+func TestEngine_Sync_Conflict(t *testing.T) {
+	e, repo, ws, _ := setupTask(t)
+	moveBase(t, e, repo, "a.txt", "upstream\n")
+	s, err := e.Sync(ws, repo, "main", SyncRebase)
+	var barErr *barerrors.BarError
+	if !errors.As(err, &barErr) || barErr.Code != barerrors.ErrSyncConflict {
+		t.Fatalf("expected a sync conflict, got %v", err)
+	}
+	if len(s.Conflicts) != 1 || s.Conflicts[0] != "a.txt" {
+		t.Fatalf("expected a conflict in a.txt, got %v", s.Conflicts)
+	}
+
+	if err := e.ContinueSync(ws, "main", s); err == nil {
+		t.Fatal("expected unresolved conflict markers to stop the sync")
+	}
+	os.WriteFile(filepath.Join(ws, "a.txt"), []byte("resolved\n"), 0o644)
+	if err := e.ContinueSync(ws, "main", s); err != nil {
+		t.Fatalf("ContinueSync failed: %v", err)
+	}
+	if head, _ := e.Git.Run(ws, "rev-parse", "HEAD"); head != s.NewBase {
+		t.Errorf("expected the task branch at %s, got %s", s.NewBase, head)
+	}
+	if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+		t.Errorf("expected the resolved changes to be uncommitted, got %q", status)
+	}
+}
+
+func TestEngine_AbortSync(t *testing.T) {
+	for _, mode := range []string{SyncRebase, SyncMerge} {
+		t.Run(mode, func(t *testing.T) {
+			e, repo, ws, _ := setupTask(t)
+			moveBase(t, e, repo, "a.txt", "upstream\n")
+			s, err := e.Sync(ws, repo, "main", mode)
+			if err == nil {
+				t.Fatal("expected a conflict")
+			}
+			if err := e.AbortSync(ws, s); err != nil {
+				t.Fatalf("AbortSync failed: %v", err)
+			}
+			if head, _ := e.Git.Run(ws, "rev-parse", "HEAD"); head != s.Head {
+				t.Errorf("expected the task branch back at %s, got %s", s.Head, head)
+			}
+			if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+				t.Errorf("expected the workspace as before, got %q", status)
+			}
+			if data, _ := os.ReadFile(filepath.Join(ws, "a.txt")); string(data) != "step2\n" {
+				t.Errorf("expected the uncommitted change back, got %q", data)
+			}
+		})
+	}
+}
+
+func TestEngine_Sync_MergeConflict(t *testing.T) {
+	e, repo, ws, _ := setupTask(t)
+	moveBase(t, e, repo, "a.txt", "upstream\n")
+	s, err := e.Sync(ws, repo, "main", SyncMerge)
+	var barErr *barerrors.BarError
+	if !errors.As(err, &barErr) || barErr.Code != barerrors.ErrSyncConflict {
+		t.Fatalf("expected a sync conflict, got %v", err)
+	}
+	if s.Snapshot == s.Head {
+		t.Fatal("expected the uncommitted changes in a snapshot commit")
+	}
+
+	os.WriteFile(filepath.Join(ws, "a.txt"), []byte("resolved\n"), 0o644)
+	if err := e.ContinueSync(ws, "main", s); err != nil {
+		t.Fatalf("ContinueSync failed: %v", err)
+	}
+	// Without commits of its own the task branch moves to the base, the
+	// resolved changes stay uncommitted
+	if got, _ := e.Git.Run(ws, "rev-parse", "HEAD"); got != s.NewBase {
+		t.Errorf("expected the task branch at %s, got %s", s.NewBase, got)
+	}
+	if status, _ := e.Git.Run(ws, "status", "--porcelain"); status != "M a.txt\n?? b.txt" {
+		t.Errorf("expected the resolved changes to be uncommitted, got %q", status)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "a.txt")); string(data) != "resolved\n" {
+		t.Errorf("expected the resolution in the workspace, got %q", data)
+	}
+}
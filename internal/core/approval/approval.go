@@ -0,0 +1,204 @@
+// Package approval holds the pending confirmations of "confirm" policy rules.
+//
+// A command that matches a "confirm" rule while no terminal is available (a
+// non-interactive 'bar run', or a command spawned by a wrapped agent) is
+// paused: bar writes a Request into the store and polls it until someone
+// decides it through the web API or WebSocket. Requests are plain JSON files
+// so the deciding process (e.g. 'bar ui') need not be the one waiting.
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	utiljson "github.com/user/blade-agent-runtime/internal/util/json"
+	"github.com/user/blade-agent-runtime/internal/util/lock"
+)
+
+// EnvDir and EnvTimeout tell commands spawned during 'bar wrap' where to file
+// requests and how long to wait for them (policy.confirm_timeout).
+const (
+	EnvDir     = "BAR_APPROVALS_DIR"
+	EnvTimeout = "BAR_CONFIRM_TIMEOUT"
+)
+
+// DefaultTimeout applies when policy.confirm_timeout is unset or invalid.
+const DefaultTimeout = 10 * time.Minute
+
+// Via values of a ledger.PolicyDecision.
+const (
+	ViaTerminal = "terminal"
+	ViaWeb      = "web"
+	ViaTimeout  = "timeout"
+)
+
+var (
+	ErrNotFound       = errors.New("approval request not found")
+	ErrAlreadyDecided = errors.New("approval request already decided")
+)
+
+// Request asks for confirmation of a command matched by "confirm" rules.
+type Request struct {
+	ID        string                 `json:"id"`
+	TaskID    string                 `json:"task_id,omitempty"`
+	Rules     []string               `json:"rules"`
+	Reasons   []string               `json:"reasons,omitempty"`
+	Command   []string               `json:"command"`
+	Cwd       string                 `json:"cwd,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Decision  *ledger.PolicyDecision `json:"decision,omitempty"`
+}
+
+// Store keeps one JSON file per request in a directory.
+type Store struct {
+	dir string
+}
+
+// StoreDir returns the store directory of a project's bar directory.
+func StoreDir(barDir string) string {
+	return filepath.Join(barDir, "approvals")
+}
+
+// ParseTimeout parses a policy.confirm_timeout value, falling back to
+// DefaultTimeout.
+func ParseTimeout(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return DefaultTimeout
+	}
+	return d
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Create assigns req an ID and creation time and saves it.
+func (s *Store) Create(req *Request) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	req.CreatedAt = time.Now().UTC()
+	req.ID = req.CreatedAt.Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+	return utiljson.WriteFile(s.path(req.ID), req)
+}
+
+func (s *Store) Get(id string) (*Request, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, ErrNotFound
+	}
+	req := &Request{}
+	if err := utiljson.ReadFile(s.path(id), req); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return req, nil
+}
+
+// List returns the requests oldest first; with pendingOnly, only the ones
+// still waiting for a decision.
+func (s *Store) List(pendingOnly bool) ([]*Request, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Request{}, nil
+		}
+		return nil, err
+	}
+	out := []*Request{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		req, err := s.Get(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		if pendingOnly && req.Decision != nil {
+			continue
+		}
+		out = append(out, req)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Decide records d on request id unless it is already decided. At defaults
+// to now.
+func (s *Store) Decide(id string, d ledger.PolicyDecision) (*Request, error) {
+	req, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	err = lock.With(s.path(id), func() error {
+		var err error
+		req, err = s.Get(id)
+		if err != nil {
+			return err
+		}
+		if req.Decision != nil {
+			return ErrAlreadyDecided
+		}
+		if d.At.IsZero() {
+			d.At = time.Now().UTC()
+		}
+		req.Decision = &d
+		return utiljson.WriteFile(s.path(id), req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Wait polls request id every interval until it is decided. When ctx ends
+// first, the request is denied with Via "timeout" so that a late approval
+// cannot apply to a command that is no longer waiting.
+func (s *Store) Wait(ctx context.Context, id string, interval time.Duration) (*ledger.PolicyDecision, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		req, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if req.Decision != nil {
+			return req.Decision, nil
+		}
+		select {
+		case <-ctx.Done():
+			req, err := s.Decide(id, ledger.PolicyDecision{Approved: false, By: "bar", Via: ViaTimeout})
+			if errors.Is(err, ErrAlreadyDecided) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return req.Decision, nil
+		case <-ticker.C:
+		}
+	}
+}
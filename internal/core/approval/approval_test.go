@@ -0,0 +1,107 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+)
+
+func TestStore_CreateDecide(t *testing.T) {
+	s := NewStore(t.TempDir())
+	req := &Request{TaskID: "t1", Rules: []string{"confirm-push"}, Command: []string{"git", "push"}}
+	if err := s.Create(req); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if req.ID == "" || req.CreatedAt.IsZero() {
+		t.Fatalf("expected ID and CreatedAt to be set, got %+v", req)
+	}
+	pending, err := s.List(true)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("expected 1 pending request, got %d (%v)", len(pending), err)
+	}
+
+	decided, err := s.Decide(req.ID, ledger.PolicyDecision{Approved: true, By: "alice", Via: ViaWeb})
+	if err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	if !decided.Decision.Approved || decided.Decision.At.IsZero() {
+		t.Errorf("unexpected decision %+v", decided.Decision)
+	}
+	if _, err := s.Decide(req.ID, ledger.PolicyDecision{Via: ViaWeb}); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("expected ErrAlreadyDecided, got %v", err)
+	}
+	pending, _ = s.List(true)
+	if len(pending) != 0 {
+		t.Errorf("expected no pending requests, got %d", len(pending))
+	}
+	all, _ := s.List(false)
+	if len(all) != 1 {
+		t.Errorf("expected 1 request, got %d", len(all))
+	}
+}
+
+func TestStore_GetNotFound(t *testing.T) {
+	s := NewStore(t.TempDir())
+	for _, id := range []string{"missing", "../etc/passwd", ""} {
+		if _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): expected ErrNotFound, got %v", id, err)
+		}
+	}
+	if _, err := s.Decide("missing", ledger.PolicyDecision{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Decide: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_Wait(t *testing.T) {
+	s := NewStore(t.TempDir())
+	req := &Request{Rules: []string{"r"}, Command: []string{"make", "deploy"}}
+	if err := s.Create(req); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = s.Decide(req.ID, ledger.PolicyDecision{Approved: true, By: "bob", Via: ViaWeb})
+	}()
+	d, err := s.Wait(context.Background(), req.ID, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if !d.Approved || d.By != "bob" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+func TestStore_WaitTimeout(t *testing.T) {
+	s := NewStore(t.TempDir())
+	req := &Request{Rules: []string{"r"}, Command: []string{"make", "deploy"}}
+	if err := s.Create(req); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	d, err := s.Wait(ctx, req.ID, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if d.Approved || d.Via != ViaTimeout {
+		t.Errorf("expected timeout denial, got %+v", d)
+	}
+	stored, _ := s.Get(req.ID)
+	if stored.Decision == nil || stored.Decision.Via != ViaTimeout {
+		t.Error("expected the timeout to be stored")
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	if d := ParseTimeout("90s"); d != 90*time.Second {
+		t.Errorf("ParseTimeout(90s) = %v", d)
+	}
+	for _, s := range []string{"", "soon", "-1m"} {
+		if d := ParseTimeout(s); d != DefaultTimeout {
+			t.Errorf("ParseTimeout(%q) = %v, want default", s, d)
+		}
+	}
+}
@@ -39,7 +39,11 @@ func (m *Manager) Save(cfg *Config) error {
 	v.Set("version", cfg.Version)
 	v.Set("git", cfg.Git)
 	v.Set("policy", cfg.Policy)
+	v.Set("diff", cfg.Diff)
+	v.Set("wrap", cfg.Wrap)
 	v.Set("hooks", cfg.Hooks)
+	v.Set("apply", cfg.Apply)
+	v.Set("gates", cfg.Gates)
 	v.Set("output", cfg.Output)
 	return v.WriteConfigAs(m.Path)
 }
@@ -15,6 +15,13 @@ func TestManager_LoadAndSave(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Git.DefaultBase = "develop"
 	cfg.Policy.Enabled = true
+	cfg.Diff.IncludeUntracked = false
+	cfg.Apply.TargetBranch = "bar/pr/{task}"
+	cfg.Apply.Rebase = true
+	cfg.Gates = []Gate{
+		{Name: "test", Cmd: "go test ./...", Timeout: "10m"},
+		{Name: "lint", Cmd: "golangci-lint run", Optional: true},
+	}
 
 	if err := m.Save(cfg); err != nil {
 		t.Fatalf("Save failed: %v", err)
@@ -34,6 +41,15 @@ func TestManager_LoadAndSave(t *testing.T) {
 	if !loaded.Policy.Enabled {
 		t.Error("expected Policy.Enabled to be true")
 	}
+	if loaded.Diff.IncludeUntracked {
+		t.Error("expected Diff.IncludeUntracked to be false")
+	}
+	if loaded.Apply.TargetBranch != "bar/pr/{task}" || !loaded.Apply.Rebase {
+		t.Errorf("expected apply settings to round-trip, got %+v", loaded.Apply)
+	}
+	if len(loaded.Gates) != 2 || loaded.Gates[0] != cfg.Gates[0] || loaded.Gates[1] != cfg.Gates[1] {
+		t.Errorf("expected gates to round-trip, got %+v", loaded.Gates)
+	}
 }
 
 func TestManager_LoadNonexistent(t *testing.T) {
@@ -66,9 +82,24 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.Policy.Enabled {
 		t.Error("expected Policy.Enabled to be false by default")
 	}
+	if cfg.Policy.ConfirmTimeout != "10m" {
+		t.Errorf("expected Policy.ConfirmTimeout '10m', got '%s'", cfg.Policy.ConfirmTimeout)
+	}
+	if cfg.Hooks.PostRunFailure != HookFailureWarn {
+		t.Errorf("expected Hooks.PostRunFailure 'warn', got '%s'", cfg.Hooks.PostRunFailure)
+	}
 	if !cfg.Output.Color {
 		t.Error("expected Output.Color to be true by default")
 	}
+	if !cfg.Diff.ScanSecrets || cfg.Diff.RedactSecrets {
+		t.Error("expected secret scanning without redaction by default")
+	}
+	if !cfg.Diff.IncludeUntracked {
+		t.Error("expected Diff.IncludeUntracked to be true by default")
+	}
+	if !cfg.Wrap.Intercept || len(cfg.Wrap.ShimCommands) == 0 {
+		t.Error("expected wrap interception with default shim commands")
+	}
 }
 
 func TestManager_SaveCreatesFile(t *testing.T) {
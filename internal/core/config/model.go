@@ -9,11 +9,37 @@ type Config struct {
 	Policy struct {
 		Enabled bool   `mapstructure:"enabled" yaml:"enabled"`
 		Path    string `mapstructure:"path" yaml:"path"`
+		// ConfirmTimeout bounds how long a command matched by a "confirm"
+		// rule waits for approval from the Web UI, e.g. "10m".
+		ConfirmTimeout string `mapstructure:"confirm_timeout" yaml:"confirm_timeout"`
 	} `mapstructure:"policy" yaml:"policy"`
+	Wrap struct {
+		Intercept    bool     `mapstructure:"intercept" yaml:"intercept"`
+		ShimCommands []string `mapstructure:"shim_commands" yaml:"shim_commands"`
+	} `mapstructure:"wrap" yaml:"wrap"`
+	Diff struct {
+		IncludeUntracked bool `mapstructure:"include_untracked" yaml:"include_untracked"`
+		ScanSecrets      bool `mapstructure:"scan_secrets" yaml:"scan_secrets"`
+		RedactSecrets    bool `mapstructure:"redact_secrets" yaml:"redact_secrets"`
+	} `mapstructure:"diff" yaml:"diff"`
 	Hooks struct {
 		PreRun  []string `mapstructure:"pre_run" yaml:"pre_run"`
 		PostRun []string `mapstructure:"post_run" yaml:"post_run"`
+		// PostRunFailure decides what a failing post_run hook does: "warn"
+		// only records it, "fail" marks a successful step as failed and
+		// "block" stops 'bar apply' until a later step's hooks pass.
+		PostRunFailure string `mapstructure:"post_run_failure" yaml:"post_run_failure"`
 	} `mapstructure:"hooks" yaml:"hooks"`
+	Apply struct {
+		// TargetBranch makes 'bar apply' put the task's commits on this
+		// branch instead of the base branch; "{task}" is replaced with the
+		// task name.
+		TargetBranch string `mapstructure:"target_branch" yaml:"target_branch"`
+		// Rebase rebases the commits onto the latest base branch first.
+		Rebase bool `mapstructure:"rebase" yaml:"rebase"`
+	} `mapstructure:"apply" yaml:"apply"`
+	// Gates are the checks 'bar apply' runs in the task workspace first.
+	Gates  []Gate `mapstructure:"gates" yaml:"gates"`
 	Output struct {
 		Color   bool `mapstructure:"color" yaml:"color"`
 		Verbose bool `mapstructure:"verbose" yaml:"verbose"`
@@ -26,9 +52,42 @@ func DefaultConfig() *Config {
 	cfg.Git.BranchPrefix = "bar/"
 	cfg.Policy.Enabled = false
 	cfg.Policy.Path = ".bar/policy.yaml"
+	cfg.Policy.ConfirmTimeout = "10m"
+	cfg.Wrap.Intercept = true
+	cfg.Wrap.ShimCommands = DefaultShimCommands()
+	cfg.Diff.IncludeUntracked = true
+	cfg.Diff.ScanSecrets = true
 	cfg.Hooks.PreRun = []string{}
 	cfg.Hooks.PostRun = []string{}
+	cfg.Hooks.PostRunFailure = HookFailureWarn
+	cfg.Gates = []Gate{}
 	cfg.Output.Color = true
 	cfg.Output.Verbose = false
 	return cfg
 }
+
+// Gate is a quality gate: a shell command that must succeed before a task is
+// applied. A failing optional gate is recorded but does not stop the apply.
+type Gate struct {
+	Name     string `mapstructure:"name" yaml:"name"`
+	Cmd      string `mapstructure:"cmd" yaml:"cmd"`
+	Optional bool   `mapstructure:"optional" yaml:"optional,omitempty"`
+	// Timeout bounds the gate's run time, e.g. "10m"; empty for none.
+	Timeout string `mapstructure:"timeout" yaml:"timeout,omitempty"`
+}
+
+// Values of hooks.post_run_failure.
+const (
+	HookFailureWarn  = "warn"
+	HookFailureFail  = "fail"
+	HookFailureBlock = "block"
+)
+
+// DefaultShimCommands lists the commands intercepted during 'bar wrap' so
+// that the ones an agent spawns are audited and checked against policy.
+func DefaultShimCommands() []string {
+	return []string{
+		"rm", "dd", "mkfs", "chmod", "chown", "sudo",
+		"curl", "wget", "git", "npm", "yarn", "pnpm", "pip", "docker", "kubectl",
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"strings"
 
 	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+	"github.com/user/blade-agent-runtime/internal/core/secrets"
 )
 
 type Engine struct {
 	Git *gitadapter.Runner
+	// IncludeUntracked makes Generate report new files that are not yet
+	// tracked by git (ignored files are still skipped).
+	IncludeUntracked bool
+	// Scanner, when set, reports secrets on the added lines of every diff in
+	// Result.Secrets.
+	Scanner *secrets.Scanner
 }
 
 type Result struct {
@@ -16,78 +23,151 @@ type Result struct {
 	Additions int
 	Deletions int
 	FileList  []string
+	Changes   []FileChange
 	Patch     []byte
+	Secrets   []secrets.Finding
+}
+
+// FileChange describes how a single file differs between the two sides of a
+// diff. Status uses git's letters: A(dded), M(odified), D(eleted),
+// R(enamed), C(opied) and T(ype changed).
+type FileChange struct {
+	Path      string
+	OldPath   string
+	Status    string
+	Additions int
+	Deletions int
+	Binary    bool
+	OldMode   string
+	NewMode   string
 }
 
 func NewEngine(git *gitadapter.Runner) *Engine {
-	return &Engine{Git: git}
+	return &Engine{Git: git, IncludeUntracked: true}
 }
 
+// Generate diffs the workspace working tree against baseRef.
 func (e *Engine) Generate(workspacePath string, baseRef string) (*Result, error) {
-	patch, err := e.Git.Run(workspacePath, "diff", baseRef)
+	if !e.IncludeUntracked {
+		return e.generate(workspacePath, nil, baseRef)
+	}
+	// Diff through a throwaway index holding HEAD plus intent-to-add entries
+	// for untracked files, so new files show up without staging anything in
+	// the workspace's real index.
+	var result *Result
+	err := e.Git.WithTempIndex(func(env []string) error {
+		if _, err := e.Git.RunWithEnv(workspacePath, env, "read-tree", "HEAD"); err != nil {
+			return err
+		}
+		if _, err := e.Git.RunWithEnv(workspacePath, env, "add", "--intent-to-add", "--", "."); err != nil {
+			return err
+		}
+		// Record the stat info of the fresh index once, so the diffs below
+		// compare unchanged files by stat instead of hashing them each
+		if _, err := e.Git.RunWithEnv(workspacePath, env, "update-index", "-q", "--refresh"); err != nil {
+			return err
+		}
+		var err error
+		result, err = e.generate(workspacePath, env, baseRef)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	stat, err := e.Git.Run(workspacePath, "diff", "--shortstat", baseRef)
+	return result, nil
+}
+
+// Between diffs two commits, e.g. the snapshots of two consecutive steps.
+func (e *Engine) Between(repoPath string, fromRef string, toRef string) (*Result, error) {
+	return e.generate(repoPath, nil, fromRef, toRef)
+}
+
+func (e *Engine) generate(dir string, env []string, refs ...string) (*Result, error) {
+	patch, err := e.Git.RunWithEnv(dir, env, append([]string{"diff"}, refs...)...)
 	if err != nil {
 		return nil, err
 	}
-	nameOnly, err := e.Git.Run(workspacePath, "diff", "--name-only", baseRef)
+	summary, err := e.Git.RunWithEnv(dir, env, append([]string{"diff", "--raw", "--numstat", "-z", "-M"}, refs...)...)
 	if err != nil {
 		return nil, err
 	}
-	files, adds, dels := parseShortStat(stat)
-	fileList := parseFileList(nameOnly)
-	return &Result{
-		Files:     files,
-		Additions: adds,
-		Deletions: dels,
-		FileList:  fileList,
-		Patch:     []byte(patch),
-	}, nil
-}
-
-func parseFileList(nameOnly string) []string {
-	lines := strings.Split(strings.TrimSpace(nameOnly), "\n")
-	result := []string{}
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			result = append(result, line)
-		}
+	changes := parseChanges(summary)
+	result := &Result{
+		Files:    len(changes),
+		FileList: make([]string, 0, len(changes)),
+		Changes:  changes,
+		Patch:    []byte(patch),
+	}
+	for _, c := range changes {
+		result.Additions += c.Additions
+		result.Deletions += c.Deletions
+		result.FileList = append(result.FileList, c.Path)
 	}
-	return result
+	if e.Scanner != nil {
+		result.Secrets = e.Scanner.ScanPatch(result.Patch)
+	}
+	return result, nil
 }
 
-func parseShortStat(stat string) (int, int, int) {
-	if strings.TrimSpace(stat) == "" {
-		return 0, 0, 0
-	}
-	fields := strings.Fields(stat)
-	files := 0
-	adds := 0
-	dels := 0
-	for i, f := range fields {
-		if f == "files" || f == "file" {
-			if i > 0 {
-				if v, err := strconv.Atoi(fields[i-1]); err == nil {
-					files = v
-				}
+// parseChanges reads `git diff --raw --numstat -z`: the raw records (status,
+// paths, modes) of every file, followed by their numstat records (line
+// counts, binary detection).
+func parseChanges(out string) []FileChange {
+	changes := []FileChange{}
+	index := map[string]int{}
+	tokens := strings.Split(out, "\x00")
+	for i := 0; i < len(tokens); i++ {
+		header := tokens[i]
+		if !strings.HasPrefix(header, ":") {
+			// A numstat record; they follow the raw records of all files
+			parts := strings.SplitN(header, "\t", 3)
+			if len(parts) != 3 {
+				continue
 			}
-		}
-		if strings.HasPrefix(f, "insertion") || strings.HasPrefix(f, "insertions") {
-			if i > 0 {
-				if v, err := strconv.Atoi(fields[i-1]); err == nil {
-					adds = v
+			path := parts[2]
+			if path == "" {
+				// renames and copies list the old and new path as separate fields
+				if i+2 >= len(tokens) {
+					break
 				}
+				path = tokens[i+2]
+				i += 2
+			}
+			idx, ok := index[path]
+			if !ok {
+				continue
+			}
+			if parts[0] == "-" && parts[1] == "-" {
+				changes[idx].Binary = true
+				continue
 			}
+			changes[idx].Additions, _ = strconv.Atoi(parts[0])
+			changes[idx].Deletions, _ = strconv.Atoi(parts[1])
+			continue
 		}
-		if strings.HasPrefix(f, "deletion") || strings.HasPrefix(f, "deletions") {
-			if i > 0 {
-				if v, err := strconv.Atoi(fields[i-1]); err == nil {
-					dels = v
-				}
+		fields := strings.Fields(header[1:])
+		if len(fields) < 5 || i+1 >= len(tokens) {
+			continue
+		}
+		c := FileChange{Status: fields[4][:1]}
+		if c.Status == "R" || c.Status == "C" {
+			if i+2 >= len(tokens) {
+				break
 			}
+			c.OldPath = tokens[i+1]
+			c.Path = tokens[i+2]
+			i += 2
+		} else {
+			c.Path = tokens[i+1]
+			i++
+		}
+		oldMode, newMode := fields[0], fields[1]
+		if oldMode != newMode && oldMode != "000000" && newMode != "000000" {
+			c.OldMode = oldMode
+			c.NewMode = newMode
 		}
+		index[c.Path] = len(changes)
+		changes = append(changes, c)
 	}
-	return files, adds, dels
+	return changes
 }
@@ -0,0 +1,104 @@
+package ledger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Every ledger record carries the hash of the record before it (prev_hash)
+// and its own hash, computed over the record's JSON with hash left empty.
+// Artifact files are hashed into Artifacts.SHA256 when the record is written,
+// so rewriting a record or an artifact breaks the chain.
+
+func hashRecord(step *Step) (string, error) {
+	record := *step
+	record.Hash = ""
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// seal links step to the current chain head and fills in its artifact and
+// record hashes. It must be called with the ledger lock held.
+func (m *Manager) seal(step *Step) error {
+	head, _, err := m.head()
+	if err != nil {
+		return err
+	}
+	step.PrevHash = head
+	if step.Artifacts != nil {
+		step.Artifacts.SHA256 = nil
+		for _, p := range step.Artifacts.Paths() {
+			sum, err := hashFile(filepath.Join(m.TaskDir, p))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			if step.Artifacts.SHA256 == nil {
+				step.Artifacts.SHA256 = map[string]string{}
+			}
+			step.Artifacts.SHA256[p] = sum
+		}
+	}
+	hash, err := hashRecord(step)
+	if err != nil {
+		return err
+	}
+	step.Hash = hash
+	return nil
+}
+
+// head returns the hash of the last record in the ledger and the number of
+// records.
+func (m *Manager) head() (string, int, error) {
+	f, err := os.Open(m.LedgerPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := ""
+	records := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return "", 0, err
+		}
+		hash = record.Hash
+		records++
+	}
+	return hash, records, scanner.Err()
+}
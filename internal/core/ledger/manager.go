@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+
+	"github.com/user/blade-agent-runtime/internal/util/lock"
 )
 
 type Manager struct {
@@ -20,7 +23,35 @@ func (m *Manager) LedgerPath() string {
 	return filepath.Join(m.TaskDir, "ledger.jsonl")
 }
 
+// Append writes step to the ledger while holding the ledger lock.
 func (m *Manager) Append(step *Step) error {
+	return lock.With(m.LedgerPath(), func() error {
+		return m.append(step)
+	})
+}
+
+// AppendNext allocates the next step ID and appends the step built for it
+// while holding the ledger lock, so concurrent writers never share an ID.
+func (m *Manager) AppendNext(build func(stepID string) (*Step, error)) (*Step, error) {
+	var step *Step
+	err := lock.With(m.LedgerPath(), func() error {
+		stepID, err := m.NextStepID()
+		if err != nil {
+			return err
+		}
+		step, err = build(stepID)
+		if err != nil {
+			return err
+		}
+		return m.append(step)
+	})
+	return step, err
+}
+
+func (m *Manager) append(step *Step) error {
+	if err := m.seal(step); err != nil {
+		return err
+	}
 	f, err := os.OpenFile(m.LedgerPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
@@ -34,32 +65,126 @@ func (m *Manager) Append(step *Step) error {
 	return err
 }
 
+// Begin writes the "started" record of a step, allocating its ID under the
+// ledger lock if unset.
+func (m *Manager) Begin(step *Step) error {
+	step.Phase = StepPhaseStarted
+	if step.StepID != "" {
+		return m.Append(step)
+	}
+	_, err := m.AppendNext(func(stepID string) (*Step, error) {
+		step.StepID = stepID
+		return step, nil
+	})
+	return err
+}
+
+// Finish writes the "finished" record of a step started with Begin. The record
+// carries the complete step and supersedes the started record in List.
+func (m *Manager) Finish(step *Step) error {
+	step.Phase = StepPhaseFinished
+	return m.Append(step)
+}
+
+// Discard writes the "discarded" record of a step started with Begin that
+// turned out to have nothing to record. List omits the step; both records
+// stay in the hash chain.
+func (m *Manager) Discard(step *Step) error {
+	discarded := &Step{StepID: step.StepID, Kind: step.Kind, Phase: StepPhaseDiscarded, StartedAt: step.StartedAt, EndedAt: step.EndedAt}
+	return m.Append(discarded)
+}
+
+// List returns the steps in the ledger, folding the started and finished
+// records of a step into one entry at the position of the started record and
+// omitting discarded steps.
 func (m *Manager) List() ([]*Step, error) {
+	records, err := m.records()
+	if err != nil {
+		return nil, err
+	}
+	return fold(records), nil
+}
+
+// ListReadable is List for display: lines that cannot be parsed, such as one
+// cut short by a crash, are skipped and their line numbers returned instead of
+// failing the read. 'bar ledger verify' reports them as invalid records.
+func (m *Manager) ListReadable() ([]*Step, []int, error) {
+	records, skipped, err := m.scan(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fold(records), skipped, nil
+}
+
+func fold(records []*Step) []*Step {
+	steps := []*Step{}
+	started := map[string]int{}
+	for _, step := range records {
+		switch step.Phase {
+		case StepPhaseStarted:
+			started[step.StepID] = len(steps)
+		case StepPhaseFinished:
+			if i, ok := started[step.StepID]; ok {
+				delete(started, step.StepID)
+				steps[i] = step
+				continue
+			}
+		case StepPhaseDiscarded:
+			if i, ok := started[step.StepID]; ok {
+				delete(started, step.StepID)
+				steps[i] = nil
+			}
+			continue
+		}
+		steps = append(steps, step)
+	}
+	return slices.DeleteFunc(steps, func(s *Step) bool { return s == nil })
+}
+
+// records returns the records in the ledger as written, each started,
+// finished and discarded record on its own.
+func (m *Manager) records() ([]*Step, error) {
+	records, _, err := m.scan(false)
+	return records, err
+}
+
+// scan reads the ledger records. With skipInvalid, lines that cannot be
+// parsed are skipped and their line numbers returned; otherwise the first one
+// fails the read.
+func (m *Manager) scan(skipInvalid bool) ([]*Step, []int, error) {
 	f, err := os.Open(m.LedgerPath())
 	if err != nil {
 		if os.IsNotExist(err) {
-			return []*Step{}, nil
+			return []*Step{}, nil, nil
 		}
-		return nil, err
+		return nil, nil, err
 	}
 	defer f.Close()
-	steps := []*Step{}
+	records := []*Step{}
+	var skipped []int
+	line := 0
 	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
 	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
+		line++
+		data := scanner.Bytes()
+		if len(data) == 0 {
 			continue
 		}
 		var step Step
-		if err := json.Unmarshal(line, &step); err != nil {
-			return nil, err
+		if err := json.Unmarshal(data, &step); err != nil {
+			if !skipInvalid {
+				return nil, nil, err
+			}
+			skipped = append(skipped, line)
+			continue
 		}
-		steps = append(steps, &step)
+		records = append(records, &step)
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return steps, nil
+	return records, skipped, nil
 }
 
 func (m *Manager) GetLast() (*Step, error) {
@@ -86,19 +211,92 @@ func (m *Manager) GetByID(stepID string) (*Step, error) {
 	return nil, nil
 }
 
-func (m *Manager) NextStepID() (string, error) {
-	last, err := m.GetLast()
+// LastSnapshot returns the most recent workspace snapshot recorded in the
+// ledger, or an empty string when no step has one yet or the workspace was
+// last rolled back to base without one.
+func (m *Manager) LastSnapshot() (string, error) {
+	steps, err := m.List()
+	if err != nil {
+		return "", err
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].Snapshot != "" || steps[i].rollbackToBase() {
+			return steps[i].Snapshot, nil
+		}
+	}
+	return "", nil
+}
+
+// LastHooks returns the most recent step that ran hooks of the given phase,
+// or nil when no step has.
+func (m *Manager) LastHooks(phase string) (*Step, error) {
+	steps, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		for _, h := range steps[i].Hooks {
+			if h.Phase == phase {
+				return steps[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// SnapshotBefore returns the snapshot that was current when stepID started,
+// or an empty string if no earlier step has one (see LastSnapshot).
+func (m *Manager) SnapshotBefore(stepID string) (string, error) {
+	steps, err := m.List()
 	if err != nil {
 		return "", err
 	}
-	if last == nil || last.StepID == "" {
-		return "0001", nil
+	prev := ""
+	for _, s := range steps {
+		if s.StepID == stepID {
+			return prev, nil
+		}
+		if s.Snapshot != "" || s.rollbackToBase() {
+			prev = s.Snapshot
+		}
 	}
-	num, err := strconv.Atoi(last.StepID)
+	return prev, nil
+}
+
+// Unfinished returns steps that have a started record but no finished one.
+func (m *Manager) Unfinished() ([]*Step, error) {
+	steps, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	out := []*Step{}
+	for _, s := range steps {
+		if s.Unfinished() {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// NextStepID returns the ID following the highest one in the ledger. Every
+// record counts, so the IDs of discarded and unfinished steps, whose
+// artifacts and snapshot refs may exist, are never handed out again.
+func (m *Manager) NextStepID() (string, error) {
+	records, err := m.records()
 	if err != nil {
 		return "", err
 	}
-	return formatStepID(num + 1), nil
+	max := 0
+	for _, s := range records {
+		num, err := strconv.Atoi(s.StepID)
+		if err != nil {
+			return "", err
+		}
+		if num > max {
+			max = num
+		}
+	}
+	return formatStepID(max + 1), nil
 }
 
 func formatStepID(n int) string {
@@ -3,6 +3,8 @@ package ledger
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -135,6 +137,247 @@ func TestManager_NextStepID(t *testing.T) {
 	}
 }
 
+func TestManager_Snapshots(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	m := NewManager(tmpDir)
+
+	last, err := m.LastSnapshot()
+	if err != nil {
+		t.Fatalf("LastSnapshot failed: %v", err)
+	}
+	if last != "" {
+		t.Errorf("expected no snapshot, got '%s'", last)
+	}
+
+	_ = m.Append(&Step{StepID: "0001", Kind: "run", Snapshot: "aaa"})
+	_ = m.Append(&Step{StepID: "0002", Kind: "run"})
+	_ = m.Append(&Step{StepID: "0003", Kind: "run", Snapshot: "ccc"})
+
+	last, _ = m.LastSnapshot()
+	if last != "ccc" {
+		t.Errorf("expected last snapshot 'ccc', got '%s'", last)
+	}
+
+	tests := []struct {
+		stepID string
+		want   string
+	}{
+		{"0001", ""},
+		{"0002", "aaa"},
+		{"0003", "aaa"},
+		{"0005", ""},
+		{"0006", "eee"},
+	}
+	_ = m.Append(&Step{StepID: "0004", Kind: StepKindRollback, Target: "base"})
+	if last, _ = m.LastSnapshot(); last != "" {
+		t.Errorf("expected no snapshot after a rollback to base, got '%s'", last)
+	}
+	_ = m.Append(&Step{StepID: "0005", Kind: "run", Snapshot: "eee"})
+	_ = m.Append(&Step{StepID: "0006", Kind: StepKindRollback, Target: "base", Snapshot: "fff"})
+	if last, _ = m.LastSnapshot(); last != "fff" {
+		t.Errorf("expected the base rollback's snapshot 'fff', got '%s'", last)
+	}
+	for _, tt := range tests {
+		got, err := m.SnapshotBefore(tt.stepID)
+		if err != nil {
+			t.Fatalf("SnapshotBefore failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("SnapshotBefore(%s) = '%s', want '%s'", tt.stepID, got, tt.want)
+		}
+	}
+}
+
+func TestManager_LastHooks(t *testing.T) {
+	m := NewManager(t.TempDir())
+
+	_ = m.Append(&Step{StepID: "0001", Kind: "run", Hooks: []HookResult{{Phase: HookPostRun, Cmd: "go test ./...", ExitCode: 1}}})
+	_ = m.Append(&Step{StepID: "0002", Kind: "run", Hooks: []HookResult{{Phase: HookPreRun, Cmd: "gofmt -l ."}}})
+	_ = m.Append(&Step{StepID: "0003", Kind: "apply"})
+
+	step, err := m.LastHooks(HookPostRun)
+	if err != nil {
+		t.Fatalf("LastHooks failed: %v", err)
+	}
+	if step == nil || step.StepID != "0001" || !step.Hooks[0].Failed() {
+		t.Errorf("expected the failed post_run hook of step 0001, got %+v", step)
+	}
+	step, _ = m.LastHooks(HookPreRun)
+	if step == nil || step.StepID != "0002" {
+		t.Errorf("expected step 0002, got %+v", step)
+	}
+	if step, _ := NewManager(t.TempDir()).LastHooks(HookPostRun); step != nil {
+		t.Errorf("expected no step in an empty ledger, got %+v", step)
+	}
+}
+
+func TestManager_BeginAndFinish(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	m := NewManager(tmpDir)
+
+	first := &Step{Kind: "run", Cmd: []string{"claude"}, PID: 100, StartedAt: time.Now().UTC()}
+	if err := m.Begin(first); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if first.StepID != "0001" {
+		t.Errorf("expected Begin to allocate '0001', got '%s'", first.StepID)
+	}
+
+	second := &Step{Kind: "run", Cmd: []string{"aider"}, StartedAt: time.Now().UTC()}
+	if err := m.Begin(second); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if second.StepID != "0002" {
+		t.Errorf("expected Begin to allocate '0002', got '%s'", second.StepID)
+	}
+
+	first.ExitCode = intPtr(0)
+	first.EndedAt = time.Now().UTC()
+	if err := m.Finish(first); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+
+	steps, err := m.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("expected started and finished records to fold into 2 steps, got %d", len(steps))
+	}
+	if steps[0].StepID != "0001" || steps[0].Unfinished() || steps[0].ExitCode == nil {
+		t.Errorf("expected step 0001 to be finished with exit code, got %+v", steps[0])
+	}
+	if steps[0].PID != 100 {
+		t.Errorf("expected finished record to keep PID, got %d", steps[0].PID)
+	}
+	if steps[1].StepID != "0002" || !steps[1].Unfinished() {
+		t.Errorf("expected step 0002 to be unfinished, got %+v", steps[1])
+	}
+
+	unfinished, err := m.Unfinished()
+	if err != nil {
+		t.Fatalf("Unfinished failed: %v", err)
+	}
+	if len(unfinished) != 1 || unfinished[0].StepID != "0002" {
+		t.Errorf("expected only step 0002 to be unfinished, got %v", unfinished)
+	}
+
+	next, _ := m.NextStepID()
+	if next != "0003" {
+		t.Errorf("expected next step '0003', got '%s'", next)
+	}
+}
+
+func TestManager_Discard(t *testing.T) {
+	m := NewManager(t.TempDir())
+	_ = m.Append(&Step{StepID: "0001", Kind: "run", Snapshot: "aaa"})
+	step := &Step{Kind: "run", Cmd: []string{"claude"}, StartedAt: time.Now().UTC()}
+	if err := m.Begin(step); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := m.Discard(step); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+	// The discarded step's ID is not reused: its artifacts and snapshot ref
+	// may already exist
+	next := &Step{Kind: "run", Cmd: []string{"claude"}, StartedAt: time.Now().UTC()}
+	if err := m.Begin(next); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if next.StepID != "0003" {
+		t.Fatalf("expected step 0003 after discarding %s, got %s", step.StepID, next.StepID)
+	}
+	if err := m.Finish(next); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if id, _ := m.NextStepID(); id != "0004" {
+		t.Errorf("expected the next step ID to be 0004, got %s", id)
+	}
+
+	steps, err := m.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(steps) != 2 || steps[0].StepID != "0001" || steps[1].StepID != "0003" {
+		t.Errorf("expected the discarded step to be omitted, got %+v", steps)
+	}
+	if unfinished, _ := m.Unfinished(); len(unfinished) != 0 {
+		t.Errorf("expected no unfinished steps, got %v", unfinished)
+	}
+	report, err := m.Verify("")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected the chain to verify, got %+v", report.Issues)
+	}
+}
+
+func TestManager_ConcurrentBegin(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	const workers = 40
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewManager(tmpDir)
+			step := &Step{Kind: "run", Cmd: []string{"true"}, StartedAt: time.Now().UTC()}
+			if err := m.Begin(step); err != nil {
+				t.Errorf("Begin failed: %v", err)
+				return
+			}
+			step.EndedAt = time.Now().UTC()
+			if err := m.Finish(step); err != nil {
+				t.Errorf("Finish failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	steps, err := NewManager(tmpDir).List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(steps) != workers {
+		t.Fatalf("expected %d steps, got %d", workers, len(steps))
+	}
+	seen := map[string]bool{}
+	for _, s := range steps {
+		if seen[s.StepID] {
+			t.Errorf("duplicate step ID %s", s.StepID)
+		}
+		seen[s.StepID] = true
+		if s.Unfinished() {
+			t.Errorf("step %s left unfinished", s.StepID)
+		}
+	}
+}
+
+func TestManager_AppendNext(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	m := NewManager(tmpDir)
+	m.Append(&Step{StepID: "0001", Kind: "run"})
+
+	step, err := m.AppendNext(func(stepID string) (*Step, error) {
+		return &Step{StepID: stepID, Kind: "rollback", Target: "step", SnapshotRef: "refs/bar/t/" + stepID}, nil
+	})
+	if err != nil {
+		t.Fatalf("AppendNext failed: %v", err)
+	}
+	if step.StepID != "0002" || step.SnapshotRef != "refs/bar/t/0002" {
+		t.Errorf("unexpected appended step %+v", step)
+	}
+	last, _ := m.GetLast()
+	if last.StepID != "0002" {
+		t.Errorf("expected last step '0002', got '%s'", last.StepID)
+	}
+}
+
 func TestManager_EmptyLedger(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -157,6 +400,46 @@ func TestManager_EmptyLedger(t *testing.T) {
 	}
 }
 
+func TestManager_ListReadable(t *testing.T) {
+	tmpDir := t.TempDir()
+	m := NewManager(tmpDir)
+	m.Append(&Step{StepID: "0001", Kind: StepKindRun})
+	m.Append(&Step{StepID: "0003", Kind: StepKindRun})
+	// A line cut short by a crash, after a blank line that still counts
+	data, _ := os.ReadFile(m.LedgerPath())
+	lines := strings.SplitAfter(string(data), "\n")
+	data = []byte(lines[0] + "\n{\"step_id\":\"0002\",\"ki\n" + lines[1])
+	os.WriteFile(m.LedgerPath(), data, 0o644)
+
+	if _, err := m.List(); err == nil {
+		t.Error("expected List to fail on an unparsable line")
+	}
+	steps, skipped, err := m.ListReadable()
+	if err != nil {
+		t.Fatalf("ListReadable failed: %v", err)
+	}
+	if len(steps) != 2 || steps[0].StepID != "0001" || steps[1].StepID != "0003" {
+		t.Errorf("expected steps 0001 and 0003, got %+v", steps)
+	}
+	if len(skipped) != 1 || skipped[0] != 3 {
+		t.Errorf("expected line 3 to be skipped, got %v", skipped)
+	}
+
+	found, skipped, err := m.Query(&Query{Kinds: []StepKind{StepKindRun}})
+	if err != nil || len(found) != 2 || len(skipped) != 1 {
+		t.Errorf("Query() = %d steps, skipped %v, %v", len(found), skipped, err)
+	}
+	entries, skipped, err := NewReader(filepath.Dir(tmpDir)).ReadAll(filepath.Base(tmpDir))
+	if err != nil || len(entries) != 2 || len(skipped) != 1 {
+		t.Errorf("ReadAll() = %d steps, skipped %v, %v", len(entries), skipped, err)
+	}
+
+	// The ID of a skipped line may be taken, so new IDs are refused
+	if _, err := m.NextStepID(); err == nil {
+		t.Error("expected NextStepID to fail on an unparsable line")
+	}
+}
+
 func intPtr(i int) *int {
 	return &i
 }
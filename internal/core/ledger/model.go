@@ -5,6 +5,7 @@ import "time"
 type Step struct {
 	StepID     string    `json:"step_id"`
 	Kind       StepKind  `json:"kind"`
+	Phase      StepPhase `json:"phase,omitempty"`
 	StartedAt  time.Time `json:"started_at"`
 	EndedAt    time.Time `json:"ended_at"`
 	DurationMs int64     `json:"duration_ms,omitempty"`
@@ -12,19 +13,49 @@ type Step struct {
 	Cmd          []string          `json:"cmd,omitempty"`
 	Cwd          string            `json:"cwd,omitempty"`
 	Env          map[string]string `json:"env,omitempty"`
+	PID          int               `json:"pid,omitempty"`
+	Launcher     string            `json:"launcher,omitempty"`
 	ExitCode     *int              `json:"exit_code,omitempty"`
 	DiffStat     *DiffStat         `json:"diff_stat,omitempty"`
+	DeltaStat    *DiffStat         `json:"delta_stat,omitempty"`
 	Artifacts    *Artifacts        `json:"artifacts,omitempty"`
 	PolicyEvents []PolicyEvent     `json:"policy_events,omitempty"`
+	SubSteps     []SubStep         `json:"sub_steps,omitempty"`
+	Hooks        []HookResult      `json:"hooks,omitempty"`
+	Snapshot     string            `json:"snapshot,omitempty"`
+	SnapshotRef  string            `json:"snapshot_ref,omitempty"`
+	Recovered    bool              `json:"recovered,omitempty"`
 
 	Mode          string `json:"mode,omitempty"`
 	CommitSHA     string `json:"commit_sha,omitempty"`
 	CommitMessage string `json:"commit_message,omitempty"`
 	TargetBranch  string `json:"target_branch,omitempty"`
+	GatesSkipped  bool   `json:"gates_skipped,omitempty"`
+	// Commits lists the commits created for each step by the steps and merge
+	// apply modes, in order.
+	Commits []string `json:"commits,omitempty"`
+
+	// Gate names the quality gate a "gate" step ran; see config.Gate.
+	Gate         string `json:"gate,omitempty"`
+	GateOptional bool   `json:"gate_optional,omitempty"`
+
+	// OldBase and NewBase are the base commits a "sync" step moved the task
+	// branch from and to; Conflicts lists the files resolved while syncing.
+	OldBase   string   `json:"old_base,omitempty"`
+	NewBase   string   `json:"new_base,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
 
 	Target     string `json:"target,omitempty"`
 	TargetStep string `json:"target_step,omitempty"`
 	Hard       *bool  `json:"hard,omitempty"`
+
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// rollbackToBase reports whether the step reset the workspace to the base.
+func (s *Step) rollbackToBase() bool {
+	return s.Kind == StepKindRollback && s.Target == "base"
 }
 
 type StepKind string
@@ -33,22 +64,130 @@ const (
 	StepKindRun      StepKind = "run"
 	StepKindApply    StepKind = "apply"
 	StepKindRollback StepKind = "rollback"
+	StepKindGate     StepKind = "gate"
+	StepKindSync     StepKind = "sync"
+)
+
+// StepPhase distinguishes the two records written for a step that runs a
+// command: a write-ahead "started" record before execution and a "finished"
+// record afterwards, or a "discarded" one when there was nothing to record.
+// Steps written in a single record leave it empty.
+type StepPhase string
+
+const (
+	StepPhaseStarted   StepPhase = "started"
+	StepPhaseFinished  StepPhase = "finished"
+	StepPhaseDiscarded StepPhase = "discarded"
 )
 
+// Unfinished reports whether only the "started" record of the step exists,
+// i.e. the process recording it has not finished or was killed.
+func (s *Step) Unfinished() bool {
+	return s.Phase == StepPhaseStarted
+}
+
 type DiffStat struct {
-	Files     int      `json:"files"`
-	Additions int      `json:"additions"`
-	Deletions int      `json:"deletions"`
-	FileList  []string `json:"file_list,omitempty"`
+	Files     int          `json:"files"`
+	Additions int          `json:"additions"`
+	Deletions int          `json:"deletions"`
+	FileList  []string     `json:"file_list,omitempty"`
+	Changes   []FileChange `json:"changes,omitempty"`
+}
+
+type FileChange struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"old_path,omitempty"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+	OldMode   string `json:"old_mode,omitempty"`
+	NewMode   string `json:"new_mode,omitempty"`
 }
 
 type Artifacts struct {
-	Patch  string `json:"patch,omitempty"`
+	Patch      string   `json:"patch,omitempty"`
+	DeltaPatch string   `json:"delta_patch,omitempty"`
+	Output     string   `json:"output,omitempty"`
+	Commands   string   `json:"commands,omitempty"`
+	Hooks      []string `json:"hooks,omitempty"`
+	Patches    []string `json:"patches,omitempty"`
+	// Description is the pull request description written when applying to
+	// a target branch.
+	Description string            `json:"description,omitempty"`
+	SHA256      map[string]string `json:"sha256,omitempty"`
+}
+
+// Paths returns the artifact paths (relative to the task directory) that are
+// set.
+func (a *Artifacts) Paths() []string {
+	paths := []string{}
+	for _, p := range append(append([]string{a.Patch, a.DeltaPatch, a.Output, a.Commands, a.Description}, a.Hooks...), a.Patches...) {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// SubStep is a command spawned by the step's process and intercepted by the
+// wrap shim, in the order the commands were started.
+type SubStep struct {
+	Cmd        []string  `json:"cmd"`
+	Cwd        string    `json:"cwd,omitempty"`
+	Shell      bool      `json:"shell,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Blocked    bool      `json:"blocked,omitempty"`
+}
+
+// Hook phases, named after the config keys the commands come from.
+const (
+	HookPreRun  = "pre_run"
+	HookPostRun = "post_run"
+)
+
+// HookResult is the outcome of one of the hooks.pre_run or hooks.post_run
+// commands run around the step's command.
+type HookResult struct {
+	Phase      string `json:"phase"`
+	Cmd        string `json:"cmd"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	// Output is the artifact holding the hook's stdout and stderr.
 	Output string `json:"output,omitempty"`
 }
 
+// Failed reports whether the hook exited non-zero.
+func (h HookResult) Failed() bool {
+	return h.ExitCode != 0
+}
+
 type PolicyEvent struct {
-	Rule    string `json:"rule"`
+	Rule string `json:"rule"`
+	// Source names the policy layer the rule came from: "global",
+	// "project", "repo" or "task".
+	Source  string `json:"source,omitempty"`
 	Action  string `json:"action"`
 	Matched string `json:"matched"`
+	// Command is set for events raised by a command the step's process
+	// spawned (intercepted by the wrap shim) rather than the step command.
+	Command []string `json:"command,omitempty"`
+	// Files is set for events raised by a path rule and lists the changed
+	// files it matched.
+	Files []string `json:"files,omitempty"`
+	// Decision records how a "confirm" event was resolved.
+	Decision *PolicyDecision `json:"decision,omitempty"`
+}
+
+// PolicyDecision is the answer to a "confirm" policy event.
+type PolicyDecision struct {
+	Approved bool `json:"approved"`
+	// By names who decided: the local user for terminal prompts, the name
+	// sent with a web approval, or "bar" when the request timed out.
+	By string `json:"by,omitempty"`
+	// Via is "terminal", "web" or "timeout".
+	Via string    `json:"via"`
+	At  time.Time `json:"at"`
 }
@@ -0,0 +1,201 @@
+package ledger
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query filters ledger steps. Zero-value fields match everything; set fields
+// must all match.
+type Query struct {
+	Kinds        []StepKind
+	Failed       bool
+	Since        time.Time
+	Until        time.Time
+	Command      string
+	File         string
+	PolicyAction string
+	// Limit keeps only the last Limit matching steps when positive.
+	Limit int
+}
+
+// Match reports whether step satisfies every filter in q.
+func (q *Query) Match(step *Step) bool {
+	if len(q.Kinds) > 0 {
+		found := false
+		for _, k := range q.Kinds {
+			if step.Kind == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Failed && (step.ExitCode == nil || *step.ExitCode == 0) {
+		return false
+	}
+	if !q.Since.IsZero() && step.StartedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && step.StartedAt.After(q.Until) {
+		return false
+	}
+	if q.Command != "" && !runsCommand(step, q.Command) {
+		return false
+	}
+	if q.File != "" && !touches(step, q.File) {
+		return false
+	}
+	if q.PolicyAction != "" {
+		found := false
+		for _, ev := range step.PolicyEvents {
+			if ev.Action == q.PolicyAction {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the steps matching q, honoring Limit.
+func (q *Query) Apply(steps []*Step) []*Step {
+	out := []*Step{}
+	for _, s := range steps {
+		if q.Match(s) {
+			out = append(out, s)
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+// TouchedFiles returns the files a step changed itself: its delta diff when
+// recorded, otherwise its cumulative diff. Renamed files contribute both
+// paths.
+func TouchedFiles(step *Step) []string {
+	stat := step.DeltaStat
+	if stat == nil {
+		stat = step.DiffStat
+	}
+	if stat == nil {
+		return nil
+	}
+	if len(stat.Changes) == 0 {
+		return stat.FileList
+	}
+	files := []string{}
+	for _, c := range stat.Changes {
+		files = append(files, c.Path)
+		if c.OldPath != "" {
+			files = append(files, c.OldPath)
+		}
+	}
+	return files
+}
+
+// touches matches pattern against the files a step touched. The pattern is an
+// exact path, a directory (matching everything below it) or a path.Match
+// glob.
+func touches(step *Step, pattern string) bool {
+	dir := strings.TrimSuffix(pattern, "/") + "/"
+	for _, f := range TouchedFiles(step) {
+		if f == pattern || strings.HasPrefix(f, dir) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, f); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the steps matching q, along with the line numbers of ledger
+// lines skipped because they cannot be parsed (see ListReadable).
+func (m *Manager) Query(q *Query) ([]*Step, []int, error) {
+	steps, skipped, err := m.ListReadable()
+	if err != nil {
+		return nil, nil, err
+	}
+	return q.Apply(steps), skipped, nil
+}
+
+// runsCommand reports whether the step command or one of its sub-steps
+// contains command.
+func runsCommand(step *Step, command string) bool {
+	if strings.Contains(strings.Join(step.Cmd, " "), command) {
+		return true
+	}
+	for _, sub := range step.SubSteps {
+		if strings.Contains(strings.Join(sub.Cmd, " "), command) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTime parses a query time bound: RFC 3339, a date (2006-01-02) or a
+// duration such as "2h" or "30m" meaning that long before now.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339, YYYY-MM-DD or a duration like 2h", value)
+}
+
+// ParseQuery builds a Query from URL query parameters: kind (comma
+// separated), failed, since, until, cmd, file, policy and limit.
+func ParseQuery(values url.Values) (*Query, error) {
+	q := &Query{
+		Command:      values.Get("cmd"),
+		File:         values.Get("file"),
+		PolicyAction: values.Get("policy"),
+	}
+	for _, k := range strings.Split(values.Get("kind"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			q.Kinds = append(q.Kinds, StepKind(k))
+		}
+	}
+	if v := values.Get("failed"); v != "" {
+		failed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid failed %q", v)
+		}
+		q.Failed = failed
+	}
+	now := time.Now()
+	for key, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := values.Get(key); v != "" {
+			t, err := ParseTime(v, now)
+			if err != nil {
+				return nil, err
+			}
+			*dst = t
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func queryFixture() []*Step {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	return []*Step{
+		{StepID: "0001", Kind: StepKindRun, StartedAt: base, Cmd: []string{"claude", "fix bug"}, ExitCode: intPtr(0),
+			DiffStat: &DiffStat{FileList: []string{"src/main.go"}}},
+		{StepID: "0002", Kind: StepKindRun, StartedAt: base.Add(time.Hour), Cmd: []string{"npm", "test"}, ExitCode: intPtr(1),
+			PolicyEvents: []PolicyEvent{{Rule: "warn-npm", Action: "warn"}}},
+		{StepID: "0003", Kind: StepKindRun, StartedAt: base.Add(2 * time.Hour), Cmd: []string{"claude", "rename"}, ExitCode: intPtr(0),
+			SubSteps:  []SubStep{{Cmd: []string{"git", "mv", "docs/old.md", "docs/new.md"}, ExitCode: intPtr(0)}},
+			DiffStat:  &DiffStat{FileList: []string{"src/main.go", "docs/new.md"}},
+			DeltaStat: &DiffStat{Changes: []FileChange{{Path: "docs/new.md", OldPath: "docs/old.md", Status: "R"}}}},
+		{StepID: "0004", Kind: StepKindApply, StartedAt: base.Add(3 * time.Hour)},
+	}
+}
+
+func stepIDs(steps []*Step) []string {
+	ids := []string{}
+	for _, s := range steps {
+		ids = append(ids, s.StepID)
+	}
+	return ids
+}
+
+func TestQuery_Apply(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"empty", Query{}, []string{"0001", "0002", "0003", "0004"}},
+		{"kind", Query{Kinds: []StepKind{StepKindApply}}, []string{"0004"}},
+		{"failed", Query{Failed: true}, []string{"0002"}},
+		{"since", Query{Since: base.Add(90 * time.Minute)}, []string{"0003", "0004"}},
+		{"until", Query{Until: base.Add(time.Hour)}, []string{"0001", "0002"}},
+		{"command", Query{Command: "claude"}, []string{"0001", "0003"}},
+		{"sub-step command", Query{Command: "git mv"}, []string{"0003"}},
+		{"file exact", Query{File: "src/main.go"}, []string{"0001"}},
+		{"file old path", Query{File: "docs/old.md"}, []string{"0003"}},
+		{"file dir", Query{File: "docs"}, []string{"0003"}},
+		{"file glob", Query{File: "src/*.go"}, []string{"0001"}},
+		{"policy", Query{PolicyAction: "warn"}, []string{"0002"}},
+		{"combined", Query{Kinds: []StepKind{StepKindRun}, Command: "claude", Limit: 1}, []string{"0003"}},
+	}
+	for _, tt := range tests {
+		got := stepIDs(tt.query.Apply(queryFixture()))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	values, _ := url.ParseQuery("kind=run,apply&failed=1&since=2024-01-15&cmd=npm&file=src/&policy=block&limit=5")
+	q, err := ParseQuery(values)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if len(q.Kinds) != 2 || q.Kinds[1] != StepKindApply {
+		t.Errorf("unexpected kinds %v", q.Kinds)
+	}
+	if !q.Failed || q.Command != "npm" || q.File != "src/" || q.PolicyAction != "block" || q.Limit != 5 {
+		t.Errorf("unexpected query %+v", q)
+	}
+	if q.Since.IsZero() {
+		t.Error("expected since to be parsed")
+	}
+
+	for _, bad := range []string{"failed=maybe", "since=yesterday", "limit=ten"} {
+		values, _ := url.ParseQuery(bad)
+		if _, err := ParseQuery(values); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	got, err := ParseTime("2h", now)
+	if err != nil || !got.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("ParseTime(2h) = %v, %v", got, err)
+	}
+	got, err = ParseTime("2024-01-15T08:00:00Z", now)
+	if err != nil || got.Hour() != 8 {
+		t.Errorf("ParseTime(RFC 3339) = %v, %v", got, err)
+	}
+}
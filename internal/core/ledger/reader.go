@@ -1,8 +1,6 @@
 package ledger
 
 import (
-	"bufio"
-	"encoding/json"
 	"os"
 	"path/filepath"
 )
@@ -15,30 +13,24 @@ func NewReader(tasksDir string) *Reader {
 	return &Reader{tasksDir: tasksDir}
 }
 
-func (r *Reader) ReadAll(taskID string) ([]Step, error) {
-	ledgerPath := filepath.Join(r.tasksDir, taskID, "ledger.jsonl")
-	file, err := os.Open(ledgerPath)
+// ReadAll returns the steps of a task for display, skipping ledger lines that
+// cannot be parsed and returning their line numbers.
+func (r *Reader) ReadAll(taskID string) ([]Step, []int, error) {
+	steps, skipped, err := NewManager(filepath.Join(r.tasksDir, taskID)).ListReadable()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []Step{}, nil
-		}
-		return nil, err
+		return nil, nil, err
 	}
-	defer file.Close()
-
-	var entries []Step
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var entry Step
-		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-			continue
-		}
-		entries = append(entries, entry)
+	entries := make([]Step, 0, len(steps))
+	for _, s := range steps {
+		entries = append(entries, *s)
 	}
-
-	return entries, scanner.Err()
+	return entries, skipped, nil
 }
 
 func (r *Reader) ReadFile(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
+
+func (r *Reader) Query(taskID string, q *Query) ([]*Step, []int, error) {
+	return NewManager(filepath.Join(r.tasksDir, taskID)).Query(q)
+}
@@ -0,0 +1,124 @@
+package ledger
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	utiljson "github.com/user/blade-agent-runtime/internal/util/json"
+	"github.com/user/blade-agent-runtime/internal/util/lock"
+)
+
+// Signature is an ed25519 signature over the ledger chain head, stored next
+// to the ledger in ledger.sig.
+type Signature struct {
+	Head      string    `json:"head"`
+	Records   int       `json:"records"`
+	PublicKey string    `json:"public_key"`
+	Signature string    `json:"signature"`
+	SignedAt  time.Time `json:"signed_at"`
+}
+
+func signedMessage(head string, records int) []byte {
+	return []byte("bar-ledger-v1:" + head + ":" + strconv.Itoa(records))
+}
+
+// Check verifies the signature against its embedded public key.
+func (s *Signature) Check() error {
+	pub, err := hex.DecodeString(s.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("invalid public key in ledger.sig")
+	}
+	sig, err := hex.DecodeString(s.Signature)
+	if err != nil {
+		return errors.New("invalid signature encoding in ledger.sig")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), signedMessage(s.Head, s.Records), sig) {
+		return errors.New("signature does not match the signed head")
+	}
+	return nil
+}
+
+func (m *Manager) SignaturePath() string {
+	return filepath.Join(m.TaskDir, "ledger.sig")
+}
+
+func (m *Manager) LoadSignature() (*Signature, error) {
+	sig := &Signature{}
+	if err := utiljson.ReadFile(m.SignaturePath(), sig); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Sign signs the current chain head with key and writes ledger.sig.
+func (m *Manager) Sign(key ed25519.PrivateKey) (*Signature, error) {
+	var sig *Signature
+	err := lock.With(m.LedgerPath(), func() error {
+		head, records, err := m.head()
+		if err != nil {
+			return err
+		}
+		sig = &Signature{
+			Head:      head,
+			Records:   records,
+			PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Signature: hex.EncodeToString(ed25519.Sign(key, signedMessage(head, records))),
+			SignedAt:  time.Now().UTC(),
+		}
+		return utiljson.WriteFile(m.SignaturePath(), sig)
+	})
+	return sig, err
+}
+
+// LoadOrCreateKey reads the hex-encoded ed25519 seed at path, generating and
+// saving a new key (mode 0600) if the file does not exist.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid ledger key in " + path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PublicKeyHex returns the hex public key for the key stored at path, or an
+// empty string if there is no key.
+func PublicKeyHex(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	key, err := LoadOrCreateKey(path)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
@@ -0,0 +1,154 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	IssueInvalidRecord    = "invalid_record"
+	IssueBrokenLink       = "broken_link"
+	IssueHashMismatch     = "hash_mismatch"
+	IssueUnhashed         = "unhashed"
+	IssueMissingArtifact  = "missing_artifact"
+	IssueModifiedArtifact = "modified_artifact"
+	IssueBadSignature     = "bad_signature"
+	IssueUntrustedKey     = "untrusted_key"
+)
+
+type VerifyIssue struct {
+	Line   int    `json:"line"`
+	StepID string `json:"step_id,omitempty"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+type VerifyReport struct {
+	Records       int           `json:"records"`
+	Legacy        int           `json:"legacy"`
+	Head          string        `json:"head"`
+	Signed        bool          `json:"signed"`
+	SignedRecords int           `json:"signed_records,omitempty"`
+	Issues        []VerifyIssue `json:"issues"`
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Verify walks the ledger and checks the hash chain, the recorded artifact
+// hashes and, if the ledger has been signed, the signature over the chain
+// head. Records written before hashing existed are counted as legacy as long
+// as they precede the first hashed record. trustedKey, if non-empty, is the
+// hex ed25519 public key the signature must have been made with.
+func (m *Manager) Verify(trustedKey string) (*VerifyReport, error) {
+	f, err := os.Open(m.LedgerPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &VerifyReport{Issues: []VerifyIssue{}}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	report := &VerifyReport{Issues: []VerifyIssue{}}
+	add := func(line int, stepID, kind, format string, args ...any) {
+		report.Issues = append(report.Issues, VerifyIssue{Line: line, StepID: stepID, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+	heads := map[string]int{}
+	prev := ""
+	chained := false
+	line := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		report.Records++
+		var step Step
+		if err := json.Unmarshal(data, &step); err != nil {
+			add(line, "", IssueInvalidRecord, "record is not valid JSON: %v", err)
+			prev = ""
+			continue
+		}
+		if step.Hash == "" {
+			if chained {
+				add(line, step.StepID, IssueUnhashed, "record has no hash but follows hashed records")
+			} else {
+				report.Legacy++
+			}
+			prev = ""
+			continue
+		}
+		chained = true
+		if step.PrevHash != prev {
+			add(line, step.StepID, IssueBrokenLink, "prev_hash %s does not match previous record %s", short(step.PrevHash), short(prev))
+		}
+		want, err := hashRecord(&step)
+		if err != nil {
+			return nil, err
+		}
+		if want != step.Hash {
+			add(line, step.StepID, IssueHashMismatch, "record was modified (hash %s, content hashes to %s)", short(step.Hash), short(want))
+		}
+		if step.Artifacts != nil {
+			for _, p := range step.Artifacts.Paths() {
+				recorded, ok := step.Artifacts.SHA256[p]
+				if !ok {
+					continue
+				}
+				sum, err := hashFile(filepath.Join(m.TaskDir, p))
+				if err != nil {
+					if os.IsNotExist(err) {
+						add(line, step.StepID, IssueMissingArtifact, "%s is missing", p)
+						continue
+					}
+					return nil, err
+				}
+				if sum != recorded {
+					add(line, step.StepID, IssueModifiedArtifact, "%s was modified", p)
+				}
+			}
+		}
+		prev = step.Hash
+		heads[step.Hash] = report.Records
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	report.Head = prev
+
+	sig, err := m.LoadSignature()
+	if err != nil {
+		return nil, err
+	}
+	if sig != nil {
+		report.Signed = true
+		if err := sig.Check(); err != nil {
+			add(0, "", IssueBadSignature, "%v", err)
+		} else if n, ok := heads[sig.Head]; !ok || n != sig.Records {
+			add(0, "", IssueBadSignature, "signed head %s (record %d) is not in the chain", short(sig.Head), sig.Records)
+		} else {
+			report.SignedRecords = n
+		}
+		if trustedKey != "" && sig.PublicKey != trustedKey {
+			add(0, "", IssueUntrustedKey, "ledger was signed with key %s, expected %s", short(sig.PublicKey), short(trustedKey))
+		}
+	}
+	return report, nil
+}
+
+func short(hash string) string {
+	if hash == "" {
+		return "(none)"
+	}
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
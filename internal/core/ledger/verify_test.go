@@ -0,0 +1,158 @@
+package ledger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeChain(t *testing.T) *Manager {
+	t.Helper()
+	tmpDir := t.TempDir()
+	m := NewManager(tmpDir)
+	os.MkdirAll(filepath.Join(tmpDir, "artifacts"), 0o755)
+	os.WriteFile(filepath.Join(tmpDir, "artifacts", "0001.patch"), []byte("diff --git a/x b/x\n"), 0o644)
+
+	step := &Step{Kind: "run", Cmd: []string{"claude"}, StartedAt: time.Now().UTC()}
+	if err := m.Begin(step); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	step.EndedAt = time.Now().UTC()
+	step.Artifacts = &Artifacts{Patch: "artifacts/0001.patch"}
+	if err := m.Finish(step); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if err := m.Append(&Step{StepID: "0002", Kind: "apply", CommitSHA: "abc"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	return m
+}
+
+func issueKinds(r *VerifyReport) []string {
+	kinds := []string{}
+	for _, i := range r.Issues {
+		kinds = append(kinds, i.Kind)
+	}
+	return kinds
+}
+
+func TestManager_HashChain(t *testing.T) {
+	m := writeChain(t)
+
+	data, _ := os.ReadFile(m.LedgerPath())
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(lines))
+	}
+	steps, _ := m.List()
+	if steps[0].Artifacts.SHA256["artifacts/0001.patch"] == "" {
+		t.Error("expected patch artifact hash to be recorded")
+	}
+	if steps[1].PrevHash != steps[0].Hash {
+		t.Error("expected second step to link to the first")
+	}
+
+	report, err := m.Verify("")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !report.OK() || report.Records != 3 || report.Head != steps[1].Hash {
+		t.Errorf("expected clean report with 3 records, got %+v", report)
+	}
+}
+
+func TestManager_VerifyDetectsTampering(t *testing.T) {
+	m := writeChain(t)
+	data, _ := os.ReadFile(m.LedgerPath())
+
+	os.WriteFile(m.LedgerPath(), []byte(strings.Replace(string(data), `"abc"`, `"def"`, 1)), 0o644)
+	report, _ := m.Verify("")
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueHashMismatch {
+		t.Errorf("expected hash_mismatch, got %v", kinds)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	os.WriteFile(m.LedgerPath(), []byte(lines[0]+"\n"+lines[2]+"\n"), 0o644)
+	report, _ = m.Verify("")
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueBrokenLink {
+		t.Errorf("expected broken_link after deleting a record, got %v", kinds)
+	}
+
+	os.WriteFile(m.LedgerPath(), data, 0o644)
+	patch := filepath.Join(m.TaskDir, "artifacts", "0001.patch")
+	os.WriteFile(patch, []byte("rewritten\n"), 0o644)
+	report, _ = m.Verify("")
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueModifiedArtifact {
+		t.Errorf("expected modified_artifact, got %v", kinds)
+	}
+
+	os.Remove(patch)
+	report, _ = m.Verify("")
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueMissingArtifact {
+		t.Errorf("expected missing_artifact, got %v", kinds)
+	}
+}
+
+func TestManager_VerifyLegacyRecords(t *testing.T) {
+	tmpDir := t.TempDir()
+	m := NewManager(tmpDir)
+	os.WriteFile(m.LedgerPath(), []byte(`{"step_id":"0001","kind":"run","started_at":"2024-01-15T10:01:00Z","ended_at":"2024-01-15T10:01:30Z"}`+"\n"), 0o644)
+	m.Append(&Step{StepID: "0002", Kind: "run"})
+
+	report, err := m.Verify("")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !report.OK() || report.Legacy != 1 {
+		t.Errorf("expected legacy prefix to be accepted, got %+v", report)
+	}
+
+	f, _ := os.OpenFile(m.LedgerPath(), os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"step_id":"0003","kind":"run"}` + "\n")
+	f.Close()
+	report, _ = m.Verify("")
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueUnhashed {
+		t.Errorf("expected unhashed record after the chain started, got %v", kinds)
+	}
+}
+
+func TestManager_Sign(t *testing.T) {
+	m := writeChain(t)
+	keyPath := filepath.Join(t.TempDir(), "ledger.key")
+	key, err := LoadOrCreateKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey failed: %v", err)
+	}
+	if info, _ := os.Stat(keyPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("expected key mode 0600, got %v", info.Mode().Perm())
+	}
+	sig, err := m.Sign(key)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	trusted, _ := PublicKeyHex(keyPath)
+	if sig.PublicKey != trusted {
+		t.Errorf("expected signature public key %s, got %s", trusted, sig.PublicKey)
+	}
+
+	m.Append(&Step{StepID: "0003", Kind: "run"})
+	report, _ := m.Verify(trusted)
+	if !report.OK() || !report.Signed || report.SignedRecords != 3 {
+		t.Errorf("expected signed prefix of 3 records, got %+v", report)
+	}
+
+	report, _ = m.Verify(strings.Repeat("0", 64))
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueUntrustedKey {
+		t.Errorf("expected untrusted_key, got %v", kinds)
+	}
+
+	sig.Records = 2
+	data := []byte(`{"head":"` + sig.Head + `","records":2,"public_key":"` + sig.PublicKey + `","signature":"` + sig.Signature + `"}`)
+	os.WriteFile(m.SignaturePath(), data, 0o644)
+	report, _ = m.Verify("")
+	if kinds := issueKinds(report); len(kinds) != 1 || kinds[0] != IssueBadSignature {
+		t.Errorf("expected bad_signature, got %v", kinds)
+	}
+}
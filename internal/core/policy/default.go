@@ -5,16 +5,24 @@ func DefaultPolicy() *Policy {
 		Version: 1,
 		Rules: []Rule{
 			{
-				Name:    "no-rm-rf-root",
-				Pattern: `rm\s+(-[a-zA-Z]*r[a-zA-Z]*f|(-[a-zA-Z]*f[a-zA-Z]*r))\s+/\s*$`,
-				Action:  "block",
-				Reason:  "Dangerous: recursive delete from root",
+				Name: "no-rm-rf-root",
+				Match: &Match{
+					Command: []string{"rm"},
+					Flags:   []string{"r|R|recursive", "f|force"},
+					Args:    []string{"/"},
+				},
+				Action: "block",
+				Reason: "Dangerous: recursive delete from root",
 			},
 			{
-				Name:    "no-rm-rf-home",
-				Pattern: `rm\s+(-[a-zA-Z]*r[a-zA-Z]*f|(-[a-zA-Z]*f[a-zA-Z]*r))\s+~/?\s*$`,
-				Action:  "block",
-				Reason:  "Dangerous: recursive delete home directory",
+				Name: "no-rm-rf-home",
+				Match: &Match{
+					Command: []string{"rm"},
+					Flags:   []string{"r|R|recursive", "f|force"},
+					Args:    []string{"~", "~/"},
+				},
+				Action: "block",
+				Reason: "Dangerous: recursive delete home directory",
 			},
 			{
 				Name:    "no-disk-write",
@@ -73,12 +81,18 @@ func DefaultPolicyYAML() string {
 
 rules:
   - name: no-rm-rf-root
-    pattern: 'rm\s+(-[a-zA-Z]*r[a-zA-Z]*f|(-[a-zA-Z]*f[a-zA-Z]*r))\s+/\s*$'
+    match:
+      command: [rm]
+      flags: ['r|R|recursive', 'f|force']
+      args: ['/']
     action: block
     reason: "Dangerous: recursive delete from root"
 
   - name: no-rm-rf-home
-    pattern: 'rm\s+(-[a-zA-Z]*r[a-zA-Z]*f|(-[a-zA-Z]*f[a-zA-Z]*r))\s+~/?\s*$'
+    match:
+      command: [rm]
+      flags: ['r|R|recursive', 'f|force']
+      args: ['~', '~/']
     action: block
     reason: "Dangerous: recursive delete home directory"
 
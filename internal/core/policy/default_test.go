@@ -1,7 +1,10 @@
 package policy
 
 import (
+	"reflect"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestDefaultPolicy_BlockRmRfRoot(t *testing.T) {
@@ -14,6 +17,9 @@ func TestDefaultPolicy_BlockRmRfRoot(t *testing.T) {
 	}{
 		{[]string{"rm", "-rf", "/"}, true},
 		{[]string{"rm", "-fr", "/"}, true},
+		{[]string{"rm", "-r", "-f", "/"}, true},
+		{[]string{"/bin/rm", "--recursive", "--force", "/"}, true},
+		{[]string{"sh", "-c", "rm -rf ~"}, true},
 		{[]string{"rm", "-rf", "/tmp"}, false},
 		{[]string{"rm", "-rf", "."}, false},
 	}
@@ -110,3 +116,13 @@ func TestDefaultPolicyYAML(t *testing.T) {
 		t.Error("DefaultPolicyYAML seems too short")
 	}
 }
+
+func TestDefaultPolicy_YAMLMatchesDefault(t *testing.T) {
+	p := &Policy{}
+	if err := yaml.Unmarshal([]byte(DefaultPolicyYAML()), p); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(p, DefaultPolicy()) {
+		t.Error("DefaultPolicyYAML does not match DefaultPolicy")
+	}
+}
@@ -1,58 +1,272 @@
 package policy
 
 import (
-	"os"
+	"fmt"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
-	"gopkg.in/yaml.v3"
+	"github.com/user/blade-agent-runtime/internal/core/secrets"
 )
 
 type Engine struct {
 	Policy *Policy
+	// Layers lists the policy files Load merged into Policy, lowest
+	// precedence first.
+	Layers []Layer
 }
 
 func NewEngine() *Engine {
 	return &Engine{}
 }
 
-func (e *Engine) Load(path string) error {
-	data, err := os.ReadFile(path)
+// Check evaluates argv against the command rules, see CheckCommand.
+func (e *Engine) Check(cmd []string) (*Result, error) {
+	return e.CheckCommand(Command{Argv: cmd})
+}
+
+// CheckCommand evaluates c against the command rules. Rules are matched
+// against the command itself and the commands it runs through wrappers and
+// shell scripts ("sudo rm ...", "sh -c 'rm ...'"); Pattern rules see both the
+// original command line and one with the executable reduced to its basename.
+// Each matching rule yields one event, except "allow" rules, which exempt the
+// commands they match, and those run through wrappers, from lower-priority
+// "block" and "confirm" rules and from allowlist mode; in a shell script
+// every command must be allowed for the script to be. Allow rules of the repo
+// and task layers do not exempt from protected rules of the global and
+// project layers, nor from an allowlist those layers set. "confirm" events
+// leave the command allowed; callers must obtain the confirmation before
+// running it.
+func (e *Engine) CheckCommand(c Command) (*Result, error) {
+	return e.evaluate(c, nil)
+}
+
+// Trace records how one rule fared against a command, see Explain.
+type Trace struct {
+	Rule     string `json:"rule"`
+	Source   string `json:"source,omitempty"`
+	Action   string `json:"action"`
+	Priority int    `json:"priority,omitempty"`
+	Matched  bool   `json:"matched"`
+	// Command is the command the rule matched: c itself or one it runs
+	// through a wrapper or shell script.
+	Command []string `json:"command,omitempty"`
+	// Overridden is set for a matching "block" or "confirm" rule that an
+	// earlier "allow" rule exempted the command from.
+	Overridden bool `json:"overridden,omitempty"`
+}
+
+// Explain evaluates c like CheckCommand and also returns a trace of every
+// command rule in evaluation order, matching or not.
+func (e *Engine) Explain(c Command) (*Result, []Trace, error) {
+	traces := []Trace{}
+	res, err := e.evaluate(c, &traces)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	p := &Policy{}
-	if err := yaml.Unmarshal(data, p); err != nil {
-		return err
-	}
-	e.Policy = p
-	return nil
+	return res, traces, nil
 }
 
-func (e *Engine) Check(cmd []string) (*Result, error) {
+func (e *Engine) evaluate(c Command, traces *[]Trace) (*Result, error) {
 	if e.Policy == nil {
 		return &Result{Allowed: true}, nil
 	}
-	full := strings.Join(cmd, " ")
+	nodes := expandTree(c)
+	commands := make([]Command, len(nodes))
+	for i, n := range nodes {
+		commands[i] = n.Command
+	}
+	// allowedBy[i] is set once an "allow" rule matched commands[i]. It
+	// covers the command and what it runs through wrappers, but not the
+	// other commands of a shell script: each of those is allowed or blocked
+	// on its own, and the script only when all of them are. baseAllowedBy
+	// only counts the allow rules of baseline layers, the only ones that
+	// exempt commands from protected rules.
+	allowedBy := make([]bool, len(nodes))
+	baseAllowedBy := make([]bool, len(nodes))
+	var coveredBelow func(allowed []bool, i int) bool
+	coveredBelow = func(allowed []bool, i int) bool {
+		if allowed[i] {
+			return true
+		}
+		if nodes[i].leaf {
+			return false
+		}
+		for j, n := range nodes {
+			if n.parent == i && !coveredBelow(allowed, j) {
+				return false
+			}
+		}
+		return true
+	}
+	covered := func(allowed []bool, i int) bool {
+		if coveredBelow(allowed, i) {
+			return true
+		}
+		for ; nodes[i].wrapped; i = nodes[i].parent {
+			if allowed[nodes[i].parent] {
+				return true
+			}
+		}
+		return false
+	}
 	events := []Event{}
 	allowed := true
-	for _, rule := range e.Policy.Rules {
-		re, err := regexp.Compile(rule.Pattern)
+	rules := SortRules(e.Policy.Rules)
+	for n := range rules {
+		rule := &rules[n]
+		if !rule.commandRule() {
+			continue
+		}
+		hits, err := ruleMatches(rule, c, commands)
 		if err != nil {
 			return nil, err
 		}
-		if re.MatchString(full) {
-			action := strings.ToLower(rule.Action)
+		action := strings.ToLower(rule.Action)
+		trace := Trace{Rule: rule.Name, Source: rule.Source, Action: action, Priority: rule.Priority, Matched: len(hits) > 0}
+		if len(hits) > 0 {
+			trace.Command = commands[hits[0]].Argv
+			switch action {
+			case "allow":
+				for _, i := range hits {
+					allowedBy[i] = true
+					if baseline(rule.Source) {
+						baseAllowedBy[i] = true
+					}
+				}
+			case "block", "confirm":
+				exempt := allowedBy
+				if rule.protected() {
+					exempt = baseAllowedBy
+				}
+				trace.Overridden = true
+				for _, i := range hits {
+					if !covered(exempt, i) {
+						trace.Command = commands[i].Argv
+						trace.Overridden = false
+						break
+					}
+				}
+				if !trace.Overridden && action == "block" {
+					allowed = false
+				}
+			}
+		}
+		if traces != nil {
+			*traces = append(*traces, trace)
+		}
+		if len(hits) == 0 || action == "allow" || trace.Overridden {
+			continue
+		}
+		matched := rule.Pattern
+		if rule.Match != nil {
+			matched = strings.TrimSpace(matched + " " + rule.Match.String())
+		}
+		events = append(events, Event{
+			Rule:    rule.Name,
+			Source:  rule.Source,
+			Action:  action,
+			Matched: matched,
+			Reason:  rule.Reason,
+		})
+	}
+	if e.Policy.Mode == ModeAllowlist && allowed {
+		// Every command actually run must be allowed, not just one of them.
+		exempt := allowedBy
+		if baseline(e.Policy.ModeSource) {
+			exempt = baseAllowedBy
+		}
+		for i, n := range nodes {
+			if !n.leaf || covered(exempt, i) {
+				continue
+			}
+			allowed = false
+			name := ""
+			if len(n.Argv) > 0 {
+				name = filepath.Base(n.Argv[0])
+			}
 			events = append(events, Event{
-				Rule:    rule.Name,
-				Action:  action,
-				Matched: rule.Pattern,
-				Reason:  rule.Reason,
+				Rule:    "allowlist",
+				Source:  e.Policy.ModeSource,
+				Action:  "block",
+				Matched: name,
+				Reason:  "Command is not on the policy allow-list",
 			})
-			if action == "block" {
-				allowed = false
-			}
+			break
 		}
 	}
 	return &Result{Allowed: allowed, Events: events}, nil
 }
+
+// SortRules returns a copy of rules in evaluation order: by descending
+// priority, keeping file order among equal priorities.
+func SortRules(rules []Rule) []Rule {
+	out := append([]Rule(nil), rules...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Priority > out[j].Priority
+	})
+	return out
+}
+
+// ruleMatches returns the indexes of the commands (the expansion of c) that
+// match both the Pattern and the Match of rule.
+func ruleMatches(rule *Rule, c Command, commands []Command) ([]int, error) {
+	var re *regexp.Regexp
+	if rule.Pattern != "" || rule.Match == nil {
+		var err error
+		re, err = compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hits := []int{}
+	for i, cmd := range commands {
+		if re != nil {
+			hit := re.MatchString(normalize(cmd.Argv))
+			if i == 0 {
+				hit = hit || re.MatchString(strings.Join(c.Argv, " "))
+			}
+			if !hit {
+				continue
+			}
+		}
+		if rule.Match != nil {
+			ok, err := rule.Match.matches(cmd)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		hits = append(hits, i)
+	}
+	return hits, nil
+}
+
+// EnvMap converts an os.Environ-style list into a map for Command.Env.
+func EnvMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// SecretScanner returns a scanner with the built-in secret patterns plus the
+// ones declared under "secrets" in the policy.
+func (e *Engine) SecretScanner() (*secrets.Scanner, error) {
+	scanner := secrets.NewScanner()
+	if e.Policy == nil {
+		return scanner, nil
+	}
+	for _, p := range e.Policy.Secrets.Patterns {
+		if err := scanner.Add(p.Name, p.Pattern); err != nil {
+			return nil, fmt.Errorf("secret pattern %s: %w", p.Name, err)
+		}
+	}
+	return scanner, nil
+}
@@ -29,6 +29,20 @@ func TestEngine_Check_Block(t *testing.T) {
 	}
 }
 
+func TestSortRules(t *testing.T) {
+	rules := []Rule{{Name: "a"}, {Name: "b", Priority: 10}, {Name: "c"}, {Name: "d", Priority: 10}, {Name: "e", Priority: -1}}
+	got := SortRules(rules)
+	want := []string{"b", "d", "a", "c", "e"}
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Fatalf("SortRules() order = %v, want %v", got, want)
+		}
+	}
+	if rules[0].Name != "a" || rules[1].Name != "b" {
+		t.Error("expected SortRules to leave its input untouched")
+	}
+}
+
 func TestEngine_Check_Allow(t *testing.T) {
 	e := NewEngine()
 	e.Policy = &Policy{
@@ -162,3 +176,29 @@ func TestEngine_Check_LogAction(t *testing.T) {
 		t.Errorf("expected action 'log', got '%s'", result.Events[0].Action)
 	}
 }
+
+func TestEngine_SecretScanner(t *testing.T) {
+	e := NewEngine()
+	scanner, err := e.SecretScanner()
+	if err != nil {
+		t.Fatalf("SecretScanner failed: %v", err)
+	}
+	builtin := len(scanner.Patterns)
+
+	e.Policy = &Policy{
+		Version: 1,
+		Secrets: Secrets{Patterns: []SecretPattern{{Name: "internal-token", Pattern: `itk_[a-z0-9]{8}`}}},
+	}
+	scanner, err = e.SecretScanner()
+	if err != nil {
+		t.Fatalf("SecretScanner failed: %v", err)
+	}
+	if len(scanner.Patterns) != builtin+1 {
+		t.Errorf("expected custom pattern to be added, got %d patterns", len(scanner.Patterns))
+	}
+
+	e.Policy.Secrets.Patterns[0].Pattern = `[invalid`
+	if _, err := e.SecretScanner(); err == nil {
+		t.Error("expected error for invalid secret pattern")
+	}
+}
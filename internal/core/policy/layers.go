@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy layers, in increasing order of precedence.
+const (
+	// LayerGlobal is the user's baseline, ~/.bar/policy.yaml.
+	LayerGlobal = "global"
+	// LayerProject is the file policy.path of the project config points at.
+	LayerProject = "project"
+	// LayerRepo is .bar-policy.yaml committed at the repository root.
+	LayerRepo = "repo"
+	// LayerTask is the file given to 'bar task start --policy'.
+	LayerTask = "task"
+)
+
+// RepoPolicyFile is the name of the policy file committed in a repository.
+const RepoPolicyFile = ".bar-policy.yaml"
+
+// Layer is one policy file of a layered policy.
+type Layer struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Optional layers are skipped when their file does not exist.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Load reads the given policy layers, lowest precedence first, and merges
+// them into e.Policy (see Merge). The rules of each layer are tagged with the
+// layer name, which events report as their Source. A missing optional layer
+// is skipped; when no layer is loaded e.Policy stays nil and every command is
+// allowed.
+func (e *Engine) Load(layers ...Layer) error {
+	policies := []*Policy{}
+	e.Layers = []Layer{}
+	for _, l := range layers {
+		data, err := os.ReadFile(l.Path)
+		if err != nil {
+			if l.Optional && os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		p := &Policy{}
+		if err := yaml.Unmarshal(data, p); err != nil {
+			return fmt.Errorf("%s: %w", l.Path, err)
+		}
+		p.setSource(l.Name)
+		policies = append(policies, p)
+		e.Layers = append(e.Layers, l)
+	}
+	e.Policy = nil
+	if len(policies) > 0 {
+		e.Policy = Merge(policies...)
+	}
+	return nil
+}
+
+// setSource tags the rules and mode of p with the layer they come from.
+func (p *Policy) setSource(layer string) {
+	for i := range p.Rules {
+		p.Rules[i].Source = layer
+	}
+	if p.Mode != "" {
+		p.ModeSource = layer
+	}
+}
+
+// baseline reports whether rules from the layer are the user's own: the repo
+// layer comes with the code and the task layer with the task, so neither may
+// relax what the global and project layers enforce.
+func baseline(layer string) bool {
+	return layer != LayerRepo && layer != LayerTask
+}
+
+// protected reports whether the rule is a block or confirm rule of a baseline
+// layer that only baseline layers may relax.
+func (r *Rule) protected() bool {
+	action := strings.ToLower(r.Action)
+	return baseline(r.Source) && !r.Overridable && (action == "block" || action == "confirm")
+}
+
+// Merge combines policies, later ones taking precedence. A rule replaces the
+// earlier rule with the same name in place, so a layer can tighten or relax a
+// rule it inherits; rules with new names are appended. A non-empty mode
+// overrides the earlier mode, and secret patterns merge by name like rules.
+//
+// The repo and task layers cannot relax the global and project layers: a
+// same-name rule of theirs is added next to a protected rule instead of
+// replacing it, and their mode does not turn an allowlist back into a
+// denylist. Their allow rules do not exempt commands from protected rules
+// either (see Engine.CheckCommand); a baseline rule opts out of all this with
+// overridable: true.
+func Merge(policies ...*Policy) *Policy {
+	out := &Policy{Rules: []Rule{}}
+	rules := map[string]int{}
+	secrets := map[string]int{}
+	for _, p := range policies {
+		if p.Version > out.Version {
+			out.Version = p.Version
+		}
+		if p.Mode != "" && !(out.Mode == ModeAllowlist && baseline(out.ModeSource) && !baseline(p.ModeSource)) {
+			out.Mode = p.Mode
+			out.ModeSource = p.ModeSource
+		}
+		for _, r := range p.Rules {
+			if i, ok := rules[r.Name]; ok && r.Name != "" && (baseline(r.Source) || !out.Rules[i].protected()) {
+				out.Rules[i] = r
+				continue
+			}
+			rules[r.Name] = len(out.Rules)
+			out.Rules = append(out.Rules, r)
+		}
+		for _, sp := range p.Secrets.Patterns {
+			if i, ok := secrets[sp.Name]; ok && sp.Name != "" {
+				out.Secrets.Patterns[i] = sp
+				continue
+			}
+			secrets[sp.Name] = len(out.Secrets.Patterns)
+			out.Secrets.Patterns = append(out.Secrets.Patterns, sp)
+		}
+	}
+	return out
+}
+
+// FormatLayers encodes layers for an environment variable as name=path
+// entries separated by the OS path list separator; see ParseLayers.
+func FormatLayers(layers []Layer) string {
+	entries := make([]string, len(layers))
+	for i, l := range layers {
+		entries[i] = l.Name + "=" + l.Path
+	}
+	return strings.Join(entries, string(os.PathListSeparator))
+}
+
+// ParseLayers decodes the output of FormatLayers. An entry without a layer
+// name is a plain path and taken as the project layer.
+func ParseLayers(s string) []Layer {
+	layers := []Layer{}
+	for _, entry := range filepath.SplitList(s) {
+		if entry == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(entry, "=")
+		if !ok || strings.ContainsAny(name, `/\`) {
+			name, path = LayerProject, entry
+		}
+		layers = append(layers, Layer{Name: name, Path: path})
+	}
+	return layers
+}
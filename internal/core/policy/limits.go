@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+)
+
+// Check returns a description of each limit the changes exceed, e.g.
+// "files 312 > 200", and the files responsible for per-file limits (files
+// that grew too much, and deleted files when there are too many).
+func (l *Limits) Check(changes []diff.FileChange) ([]string, []string) {
+	exceeded := []string{}
+	files := []string{}
+	additions, deletions := 0, 0
+	deleted := []string{}
+	for _, c := range changes {
+		additions += c.Additions
+		deletions += c.Deletions
+		if c.Status == "D" {
+			deleted = append(deleted, c.Path)
+		}
+		if l.MaxFileGrowth > 0 {
+			if growth := c.Additions - c.Deletions; growth > l.MaxFileGrowth {
+				exceeded = append(exceeded, fmt.Sprintf("file growth %s +%d > %d", c.Path, growth, l.MaxFileGrowth))
+				files = append(files, c.Path)
+			}
+		}
+	}
+	if l.MaxFiles > 0 && len(changes) > l.MaxFiles {
+		exceeded = append(exceeded, fmt.Sprintf("files %d > %d", len(changes), l.MaxFiles))
+	}
+	if l.MaxAdditions > 0 && additions > l.MaxAdditions {
+		exceeded = append(exceeded, fmt.Sprintf("additions %d > %d", additions, l.MaxAdditions))
+	}
+	if l.MaxDeletions > 0 && deletions > l.MaxDeletions {
+		exceeded = append(exceeded, fmt.Sprintf("deletions %d > %d", deletions, l.MaxDeletions))
+	}
+	if l.MaxDeletedFiles > 0 && len(deleted) > l.MaxDeletedFiles {
+		exceeded = append(exceeded, fmt.Sprintf("deleted files %d > %d", len(deleted), l.MaxDeletedFiles))
+		files = append(files, deleted...)
+	}
+	return exceeded, files
+}
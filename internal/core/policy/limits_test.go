@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+)
+
+func limitsFixture() *diff.Result {
+	return &diff.Result{
+		Changes: []diff.FileChange{
+			{Path: "src/a.go", Status: "M", Additions: 600, Deletions: 10},
+			{Path: "src/b.go", Status: "M", Additions: 20, Deletions: 5},
+			{Path: "old/c.go", Status: "D", Deletions: 300},
+			{Path: "old/d.go", Status: "D", Deletions: 200},
+		},
+	}
+}
+
+func TestLimits_Check(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   Limits
+		exceeded int
+		files    []string
+	}{
+		{"within", Limits{MaxFiles: 10, MaxAdditions: 1000, MaxDeletions: 1000}, 0, nil},
+		{"files", Limits{MaxFiles: 3}, 1, nil},
+		{"additions", Limits{MaxAdditions: 500}, 1, nil},
+		{"deletions", Limits{MaxDeletions: 500}, 1, nil},
+		{"file growth", Limits{MaxFileGrowth: 100}, 1, []string{"src/a.go"}},
+		{"deleted files", Limits{MaxDeletedFiles: 1}, 1, []string{"old/c.go", "old/d.go"}},
+		{"zero is unlimited", Limits{}, 0, nil},
+	}
+	for _, tt := range tests {
+		exceeded, files := tt.limits.Check(limitsFixture().Changes)
+		if len(exceeded) != tt.exceeded {
+			t.Errorf("%s: expected %d exceeded limits, got %v", tt.name, tt.exceeded, exceeded)
+		}
+		if len(files) != len(tt.files) {
+			t.Errorf("%s: expected files %v, got %v", tt.name, tt.files, files)
+			continue
+		}
+		for i := range files {
+			if files[i] != tt.files[i] {
+				t.Errorf("%s: expected files %v, got %v", tt.name, tt.files, files)
+			}
+		}
+	}
+}
+
+func TestEngine_CheckDiff_Limits(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Rules: []Rule{
+			{Name: "max-files", Limits: &Limits{MaxFiles: 3}, Action: "block"},
+			{Name: "src-growth", Paths: []string{"src/"}, Limits: &Limits{MaxAdditions: 700}, Action: "warn"},
+			{Name: "old-deletes", Paths: []string{"old/"}, Limits: &Limits{MaxDeletedFiles: 1}, Action: "warn"},
+		},
+	}
+	if !e.HasDiffRules() {
+		t.Error("expected limit rules to be diff rules")
+	}
+	res, err := e.CheckDiff(limitsFixture())
+	if err != nil {
+		t.Fatalf("CheckDiff failed: %v", err)
+	}
+	if res.Allowed {
+		t.Error("expected max-files to block")
+	}
+	if len(res.Events) != 2 {
+		t.Fatalf("expected max-files and old-deletes events, got %+v", res.Events)
+	}
+	if res.Events[0].Matched != "files 4 > 3" {
+		t.Errorf("unexpected description %q", res.Events[0].Matched)
+	}
+	if res.Events[1].Rule != "old-deletes" || len(res.Events[1].Files) != 2 {
+		t.Errorf("expected scoped deleted-files event, got %+v", res.Events[1])
+	}
+
+	res, _ = e.Check([]string{"rm", "-rf", "old"})
+	if !res.Allowed || len(res.Events) != 0 {
+		t.Errorf("expected limit rules to ignore commands, got %+v", res)
+	}
+}
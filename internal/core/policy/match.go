@@ -0,0 +1,378 @@
+package policy
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Command is what a command rule is evaluated against: the argv and, when
+// known, the environment and working directory it runs with.
+type Command struct {
+	Argv []string
+	Env  map[string]string
+	Cwd  string
+}
+
+// Match is the structured part of a command rule. Every set field must
+// match; within a field:
+//
+//   - Command: the executable basename matches one of the globs
+//   - Args: one of the positional arguments matches one of the globs
+//   - Flags: every entry is present; an entry lists alternatives separated
+//     by "|" ("r|R|recursive"), without dashes. Combined short flags ("-rf")
+//     count as separate flags
+//   - Env: every variable is set and matches its glob
+//   - Cwd: the working directory matches the glob
+//
+// Globs use "*" for any run of characters (including "/") and "?" for one.
+type Match struct {
+	Command []string          `yaml:"command,omitempty"`
+	Args    []string          `yaml:"args,omitempty"`
+	Flags   []string          `yaml:"flags,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Cwd     string            `yaml:"cwd,omitempty"`
+}
+
+// String describes the match for policy events, e.g. "command=rm flags=r,f".
+func (m *Match) String() string {
+	parts := []string{}
+	if len(m.Command) > 0 {
+		parts = append(parts, "command="+strings.Join(m.Command, ","))
+	}
+	if len(m.Flags) > 0 {
+		parts = append(parts, "flags="+strings.Join(m.Flags, ","))
+	}
+	if len(m.Args) > 0 {
+		parts = append(parts, "args="+strings.Join(m.Args, ","))
+	}
+	if len(m.Env) > 0 {
+		keys := make([]string, 0, len(m.Env))
+		for k := range m.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			parts = append(parts, "env."+k+"="+m.Env[k])
+		}
+	}
+	if m.Cwd != "" {
+		parts = append(parts, "cwd="+m.Cwd)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (m *Match) matches(c Command) (bool, error) {
+	if len(c.Argv) == 0 {
+		return false, nil
+	}
+	flags, args := splitArgs(c.Argv[1:])
+	if len(m.Command) > 0 {
+		ok, err := anyGlob(m.Command, filepath.Base(c.Argv[0]))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, want := range m.Flags {
+		found := false
+		for _, alt := range strings.Split(want, "|") {
+			if flags[strings.TrimLeft(alt, "-")] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if len(m.Args) > 0 {
+		found := false
+		for _, arg := range args {
+			ok, err := anyGlob(m.Args, arg)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	for name, pattern := range m.Env {
+		value, ok := c.Env[name]
+		if !ok {
+			return false, nil
+		}
+		if ok, err := anyGlob([]string{pattern}, value); err != nil || !ok {
+			return false, err
+		}
+	}
+	if m.Cwd != "" {
+		if ok, err := anyGlob([]string{m.Cwd}, c.Cwd); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// splitArgs separates flags (without dashes, short flags split up) from
+// positional arguments. Everything after "--" is positional.
+func splitArgs(argv []string) (map[string]bool, []string) {
+	flags := map[string]bool{}
+	args := []string{}
+	for i, a := range argv {
+		switch {
+		case a == "--":
+			return flags, append(args, argv[i+1:]...)
+		case strings.HasPrefix(a, "--"):
+			name, _, _ := strings.Cut(a[2:], "=")
+			flags[name] = true
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			for _, r := range a[1:] {
+				flags[string(r)] = true
+			}
+		default:
+			args = append(args, a)
+		}
+	}
+	return flags, args
+}
+
+// wrappers are commands that run the rest of their argv as another command.
+// valueFlags lists their options that take a separate value.
+var wrappers = map[string]map[string]bool{
+	"sudo":    {"-u": true, "-g": true, "-C": true, "-D": true},
+	"doas":    {"-u": true, "-C": true},
+	"env":     {"-u": true, "-C": true, "-S": true},
+	"nice":    {"-n": true},
+	"nohup":   {},
+	"time":    {"-f": true, "-o": true},
+	"command": {},
+	"exec":    {"-a": true},
+	"timeout": {"-s": true, "-k": true},
+	"xargs":   {"-I": true, "-n": true, "-P": true, "-d": true, "-L": true, "-s": true},
+}
+
+var shells = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true}
+
+// expand returns c followed by the commands it runs: the command behind
+// wrappers like sudo and env ("sudo rm -rf /" also yields "rm -rf /") and
+// each command of a "sh -c" script. Variables assigned by env or at the start
+// of a script command are added to the environment.
+func expand(c Command) []Command {
+	nodes := expandTree(c)
+	out := make([]Command, len(nodes))
+	for i, n := range nodes {
+		out[i] = n.Command
+	}
+	return out
+}
+
+// expanded is a command found by expand and how it is run.
+type expanded struct {
+	Command
+	// parent is the index of the command running this one, -1 for the
+	// expanded command itself; wrapped is set when that is a wrapper like
+	// sudo rather than a shell running a script.
+	parent  int
+	wrapped bool
+	leaf    bool
+}
+
+// expandTree is expand keeping track of which command runs which.
+func expandTree(c Command) []expanded {
+	out := []expanded{}
+	expandInto(&out, c, -1, false)
+	return out
+}
+
+func expandInto(out *[]expanded, c Command, parent int, wrapped bool) {
+	self := len(*out)
+	*out = append(*out, expanded{Command: c, parent: parent, wrapped: wrapped, leaf: true})
+	if len(c.Argv) == 0 {
+		return
+	}
+	name := filepath.Base(c.Argv[0])
+	if valueFlags, ok := wrappers[name]; ok {
+		rest := c.Argv[1:]
+		env := copyEnv(c.Env)
+		for len(rest) > 0 {
+			a := rest[0]
+			if a == "--" {
+				rest = rest[1:]
+				break
+			}
+			if strings.HasPrefix(a, "-") {
+				rest = rest[1:]
+				if valueFlags[a] && len(rest) > 0 {
+					rest = rest[1:]
+				}
+				continue
+			}
+			if k, v, ok := strings.Cut(a, "="); ok && name == "env" {
+				env[k] = v
+				rest = rest[1:]
+				continue
+			}
+			break
+		}
+		if name == "timeout" && len(rest) > 0 {
+			rest = rest[1:]
+		}
+		if len(rest) > 0 {
+			(*out)[self].leaf = false
+			expandInto(out, Command{Argv: rest, Env: env, Cwd: c.Cwd}, self, true)
+		}
+		return
+	}
+	if shells[name] {
+		for i, a := range c.Argv[1:] {
+			if strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.Contains(a, "c") && i+2 < len(c.Argv) {
+				for _, argv := range splitScript(c.Argv[i+2]) {
+					env := copyEnv(c.Env)
+					for len(argv) > 1 {
+						k, v, ok := strings.Cut(argv[0], "=")
+						if !ok || k == "" || strings.ContainsAny(k, "/-") {
+							break
+						}
+						env[k] = v
+						argv = argv[1:]
+					}
+					(*out)[self].leaf = false
+					expandInto(out, Command{Argv: argv, Env: env, Cwd: c.Cwd}, self, false)
+				}
+				break
+			}
+		}
+	}
+}
+
+func copyEnv(env map[string]string) map[string]string {
+	out := make(map[string]string, len(env))
+	for k, v := range env {
+		out[k] = v
+	}
+	return out
+}
+
+// splitScript splits a shell script into the argv of its simple commands,
+// honouring quotes and backslashes and separating commands at ; & | and
+// newlines. It does not expand variables or substitutions.
+func splitScript(script string) [][]string {
+	commands := [][]string{}
+	argv := []string{}
+	var word strings.Builder
+	inWord := false
+	flushWord := func() {
+		if inWord {
+			argv = append(argv, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	flushCommand := func() {
+		flushWord()
+		if len(argv) > 0 {
+			commands = append(commands, argv)
+			argv = []string{}
+		}
+	}
+	var quote rune
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ';' || r == '&' || r == '|' || r == '\n' || r == '(' || r == ')':
+			flushCommand()
+		case r == ' ' || r == '\t':
+			flushWord()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	flushCommand()
+	return commands
+}
+
+// normalize joins argv with the executable reduced to its basename, so
+// "/bin/rm -rf /" is matched like "rm -rf /".
+func normalize(argv []string) string {
+	if len(argv) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{filepath.Base(argv[0])}, argv[1:]...), " ")
+}
+
+func anyGlob(patterns []string, s string) (bool, error) {
+	for _, p := range patterns {
+		re, err := compileGlob(p)
+		if err != nil {
+			return false, err
+		}
+		if re.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]*regexp.Regexp{}
+)
+
+// compile returns the compiled pattern, compiling each distinct pattern only
+// once per process.
+func compile(pattern string) (*regexp.Regexp, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if re, ok := cache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	cache[pattern] = re
+	return re, nil
+}
+
+// compileGlob compiles a Match glob, where "*" also matches "/".
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return compile(sb.String())
+}
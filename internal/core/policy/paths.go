@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+)
+
+// CheckDiff evaluates the path and limit rules against the files changed in
+// result. Path rules match the new and old path of each change; limit rules
+// count the changed files (only those matching Paths when set). Each matching
+// rule yields one event; a "block" rule makes the result disallowed.
+func (e *Engine) CheckDiff(result *diff.Result) (*Result, error) {
+	if e.Policy == nil || result == nil {
+		return &Result{Allowed: true}, nil
+	}
+	events := []Event{}
+	allowed := true
+	for _, rule := range e.Policy.Rules {
+		if !rule.diffRule() {
+			continue
+		}
+		changes := changesOf(result)
+		ev := Event{
+			Rule:   rule.Name,
+			Source: rule.Source,
+			Action: strings.ToLower(rule.Action),
+			Reason: rule.Reason,
+		}
+		if len(rule.Paths) > 0 {
+			matched, files, err := matchChanges(rule.Paths, changes)
+			if err != nil {
+				return nil, err
+			}
+			if len(matched) == 0 {
+				continue
+			}
+			changes = matched
+			ev.Matched = strings.Join(rule.Paths, ", ")
+			ev.Files = files
+		}
+		if rule.Limits != nil {
+			exceeded, files := rule.Limits.Check(changes)
+			if len(exceeded) == 0 {
+				continue
+			}
+			ev.Matched = strings.Join(exceeded, ", ")
+			ev.Files = files
+		}
+		events = append(events, ev)
+		if ev.Action == "block" {
+			allowed = false
+		}
+	}
+	return &Result{Allowed: allowed, Events: events}, nil
+}
+
+// HasDiffRules reports whether any rule is evaluated against diffs, i.e.
+// whether CheckDiff can raise events.
+func (e *Engine) HasDiffRules() bool {
+	if e.Policy == nil {
+		return false
+	}
+	for _, rule := range e.Policy.Rules {
+		if rule.diffRule() {
+			return true
+		}
+	}
+	return false
+}
+
+// changesOf returns the per-file changes of result, falling back to bare
+// paths for results without them.
+func changesOf(result *diff.Result) []diff.FileChange {
+	if len(result.Changes) > 0 || len(result.FileList) == 0 {
+		return result.Changes
+	}
+	changes := make([]diff.FileChange, 0, len(result.FileList))
+	for _, f := range result.FileList {
+		changes = append(changes, diff.FileChange{Path: f})
+	}
+	return changes
+}
+
+// matchChanges returns the changes whose new or old path matches one of
+// patterns, together with the matching paths.
+func matchChanges(patterns []string, changes []diff.FileChange) ([]diff.FileChange, []string, error) {
+	matched := []diff.FileChange{}
+	files := []string{}
+	for _, c := range changes {
+		paths := []string{c.Path}
+		if c.OldPath != "" && c.OldPath != c.Path {
+			paths = append(paths, c.OldPath)
+		}
+		hit := false
+		for _, file := range paths {
+			for _, pattern := range patterns {
+				ok, err := MatchPath(pattern, file)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					files = append(files, file)
+					hit = true
+					break
+				}
+			}
+		}
+		if hit {
+			matched = append(matched, c)
+		}
+	}
+	return matched, files, nil
+}
+
+// MatchPath reports whether the slash-separated, repository-relative file
+// matches pattern, using gitignore-like rules:
+//
+//   - a pattern ending in "/" matches everything below that directory; a
+//     single directory name ("migrations/") matches it at any depth
+//   - a pattern without a "/" matches a file or directory name at any depth
+//     ("*.pem", "go.mod")
+//   - otherwise the pattern is anchored at the repository root, where "*"
+//     and "?" do not cross "/" and "**" matches any number of directories
+//     (".github/workflows/**")
+func MatchPath(pattern string, file string) (bool, error) {
+	if strings.HasSuffix(pattern, "/") {
+		if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+			pattern = "**/" + pattern
+		}
+		pattern += "**"
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false, err
+		}
+		for _, part := range strings.Split(file, "/") {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(file), nil
+}
+
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return compile(sb.String())
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/user/blade-agent-runtime/internal/core/diff"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{".github/workflows/**", ".github/workflows/ci.yml", true},
+		{".github/workflows/**", ".github/dependabot.yml", false},
+		{"go.mod", "go.mod", true},
+		{"go.mod", "tools/go.mod", true},
+		{"go.mod", "go.sum", false},
+		{"*.pem", "certs/server.pem", true},
+		{"*.pem", "certs/server.pem.txt", false},
+		{"migrations/", "migrations/001_init.sql", true},
+		{"migrations/", "db/migrations/001_init.sql", true},
+		{"migrations/", "migrations.go", false},
+		{"db/migrations/", "db/migrations/001_init.sql", true},
+		{"db/migrations/", "other/db/migrations/001_init.sql", false},
+		{"secrets/**", "secrets/prod/key.json", true},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/pkg/main.go", true},
+		{"/Makefile", "Makefile", true},
+	}
+	for _, tt := range tests {
+		got, err := MatchPath(tt.pattern, tt.file)
+		if err != nil {
+			t.Fatalf("MatchPath(%q, %q) failed: %v", tt.pattern, tt.file, err)
+		}
+		if got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+	if _, err := MatchPath("[invalid", "x"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestEngine_CheckDiff(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Rules: []Rule{
+			{Name: "no-rm-rf-root", Pattern: `rm\s+-rf\s+/`, Action: "block"},
+			{Name: "no-ci", Paths: []string{".github/workflows/**"}, Action: "block", Reason: "CI is owned by infra"},
+			{Name: "confirm-secrets", Paths: []string{"secrets/**"}, Action: "confirm"},
+			{Name: "warn-keys", Paths: []string{"*.pem", "*.key"}, Action: "warn"},
+		},
+	}
+	result := &diff.Result{
+		Changes: []diff.FileChange{
+			{Path: "src/main.go", Status: "M"},
+			{Path: "certs/new.pem", OldPath: "secrets/old.pem", Status: "R"},
+		},
+	}
+	res, err := e.CheckDiff(result)
+	if err != nil {
+		t.Fatalf("CheckDiff failed: %v", err)
+	}
+	if !res.Allowed {
+		t.Error("expected diff without workflow changes to be allowed")
+	}
+	if len(res.Events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", res.Events)
+	}
+	if res.Events[0].Rule != "confirm-secrets" || res.Events[0].Files[0] != "secrets/old.pem" {
+		t.Errorf("expected renamed-from path to match, got %+v", res.Events[0])
+	}
+	if len(res.Events[1].Files) != 2 {
+		t.Errorf("expected both sides of the rename to match *.pem, got %v", res.Events[1].Files)
+	}
+	if len(res.Confirmations()) != 1 {
+		t.Errorf("expected 1 confirmation, got %d", len(res.Confirmations()))
+	}
+
+	res, err = e.CheckDiff(&diff.Result{FileList: []string{".github/workflows/ci.yml"}})
+	if err != nil {
+		t.Fatalf("CheckDiff failed: %v", err)
+	}
+	if res.Allowed || res.Events[0].Rule != "no-ci" {
+		t.Errorf("expected workflow change to be blocked, got %+v", res)
+	}
+}
+
+func TestEngine_Check_SkipsPathRules(t *testing.T) {
+	e := NewEngine()
+	e.Policy = &Policy{
+		Version: 1,
+		Rules: []Rule{
+			{Name: "no-ci", Paths: []string{".github/**"}, Action: "block"},
+		},
+	}
+	res, err := e.Check([]string{"echo", "hello"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !res.Allowed || len(res.Events) != 0 {
+		t.Errorf("expected path-only rule to ignore commands, got %+v", res)
+	}
+}
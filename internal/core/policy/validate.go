@@ -0,0 +1,257 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/user/blade-agent-runtime/internal/core/secrets"
+)
+
+// Issue is a problem Validate found in a policy file. Line is 1-based, or 0
+// when the problem has no position (e.g. a missing field).
+type Issue struct {
+	Line     int    `json:"line,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+func (i Issue) String() string {
+	s := i.Severity + ": "
+	if i.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", i.Line, s)
+	}
+	if i.Rule != "" {
+		s += "rule '" + i.Rule + "': "
+	}
+	return s + i.Message
+}
+
+// ErrorCount returns how many issues are errors rather than warnings.
+func ErrorCount(issues []Issue) int {
+	n := 0
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Validate parses a policy file strictly (unknown fields are errors) and
+// checks every rule: known actions, compilable patterns and globs, and rules
+// that cannot do what they look like they do. It returns the policy as far as
+// it could be decoded, which is nil when the YAML itself is malformed.
+func Validate(data []byte) (*Policy, []Issue) {
+	issues := []Issue{}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, append(issues, yamlIssues(err)...)
+	}
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, append(issues, yamlIssues(err)...)
+		}
+		issues = append(issues, yamlIssues(err)...)
+	}
+	doc := &root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+
+	if p.Version != 1 {
+		issues = append(issues, Issue{
+			Line:     valueLine(doc, "version"),
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("unsupported version %d (expected 1)", p.Version),
+		})
+	}
+	switch p.Mode {
+	case "", ModeDenylist, ModeAllowlist:
+	default:
+		issues = append(issues, Issue{
+			Line:     valueLine(doc, "mode"),
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("unknown mode %q (expected %s or %s)", p.Mode, ModeDenylist, ModeAllowlist),
+		})
+	}
+
+	ruleNodes := sequence(mappingValue(doc, "rules"))
+	seen := map[string]int{}
+	for i := range p.Rules {
+		var node *yaml.Node
+		if i < len(ruleNodes) {
+			node = ruleNodes[i]
+		}
+		issues = append(issues, validateRule(&p.Rules[i], node, seen)...)
+	}
+
+	secretNodes := sequence(mappingValue(mappingValue(doc, "secrets"), "patterns"))
+	for i, sp := range p.Secrets.Patterns {
+		var node *yaml.Node
+		if i < len(secretNodes) {
+			node = secretNodes[i]
+		}
+		if sp.Name == "" {
+			issues = append(issues, Issue{Line: nodeLine(node), Severity: SeverityError, Message: "secret pattern has no name"})
+		}
+		if err := secrets.NewScanner().Add(sp.Name, sp.Pattern); err != nil {
+			issues = append(issues, Issue{
+				Line:     valueLine(node, "pattern"),
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("secret pattern '%s': %v", sp.Name, err),
+			})
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return p, issues
+}
+
+var validActions = map[string]bool{"block": true, "confirm": true, "warn": true, "log": true, "allow": true}
+
+func validateRule(rule *Rule, node *yaml.Node, seen map[string]int) []Issue {
+	issues := []Issue{}
+	add := func(line int, severity, format string, args ...any) {
+		if line == 0 {
+			line = nodeLine(node)
+		}
+		issues = append(issues, Issue{Line: line, Rule: rule.Name, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if rule.Name == "" {
+		add(0, SeverityError, "rule has no name")
+	} else if first, ok := seen[rule.Name]; ok {
+		add(valueLine(node, "name"), SeverityError, "duplicate rule name (first defined on line %d)", first)
+	} else {
+		seen[rule.Name] = nodeLine(node)
+	}
+
+	action := strings.ToLower(rule.Action)
+	if !validActions[action] {
+		add(valueLine(node, "action"), SeverityError, "unknown action %q (expected block, confirm, warn, log or allow)", rule.Action)
+	}
+	if rule.Pattern != "" {
+		if _, err := compile(rule.Pattern); err != nil {
+			add(valueLine(node, "pattern"), SeverityError, "invalid pattern: %v", err)
+		}
+	}
+	if m := rule.Match; m != nil {
+		matchNode := mappingValue(node, "match")
+		if len(m.Command) == 0 && len(m.Args) == 0 && len(m.Flags) == 0 && len(m.Env) == 0 && m.Cwd == "" {
+			add(nodeLine(matchNode), SeverityWarning, "match has no fields and matches every command")
+		}
+		for _, f := range m.Flags {
+			for _, alt := range strings.Split(f, "|") {
+				if strings.TrimLeft(alt, "-") == "" {
+					add(valueLine(matchNode, "flags"), SeverityError, "empty flag in %q", f)
+					break
+				}
+			}
+		}
+	}
+	for i, p := range rule.Paths {
+		if _, err := globRegexp(p); err != nil {
+			line := valueLine(node, "paths")
+			if items := sequence(mappingValue(node, "paths")); i < len(items) {
+				line = items[i].Line
+			}
+			add(line, SeverityError, "invalid path glob %q: %v", p, err)
+		}
+	}
+	if l := rule.Limits; l != nil {
+		line := valueLine(node, "limits")
+		for _, v := range []int{l.MaxFiles, l.MaxAdditions, l.MaxDeletions, l.MaxFileGrowth, l.MaxDeletedFiles} {
+			if v < 0 {
+				add(line, SeverityError, "limits must not be negative")
+				break
+			}
+		}
+		if l.MaxFiles <= 0 && l.MaxAdditions <= 0 && l.MaxDeletions <= 0 && l.MaxFileGrowth <= 0 && l.MaxDeletedFiles <= 0 {
+			add(line, SeverityWarning, "limits set no maximum and never match")
+		}
+	}
+
+	switch {
+	case rule.Pattern == "" && rule.Match == nil && !rule.diffRule():
+		add(0, SeverityWarning, "rule has no pattern, match, paths or limits and matches every command")
+	case action == "allow" && rule.Pattern == "" && rule.Match == nil:
+		add(valueLine(node, "action"), SeverityError, "allow only applies to command rules (pattern or match)")
+	}
+	if rule.Priority != 0 && !rule.commandRule() {
+		add(valueLine(node, "priority"), SeverityWarning, "priority only orders command rules")
+	}
+	return issues
+}
+
+// yamlIssues converts a yaml.v3 error into issues, one per "line N: ..."
+// message it carries.
+func yamlIssues(err error) []Issue {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+	issues := []Issue{}
+	for _, msg := range msgs {
+		issue := Issue{Severity: SeverityError, Message: msg}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Message = m[2]
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func sequence(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+func nodeLine(node *yaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	return node.Line
+}
+
+// valueLine returns the line of key's value in mapping node, falling back to
+// the line of the mapping itself.
+func valueLine(node *yaml.Node, key string) int {
+	if v := mappingValue(node, key); v != nil {
+		return v.Line
+	}
+	return nodeLine(node)
+}
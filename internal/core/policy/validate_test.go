@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate_DefaultPolicy(t *testing.T) {
+	p, issues := Validate([]byte(DefaultPolicyYAML()))
+	if p == nil || len(issues) != 0 {
+		t.Fatalf("expected the default policy to be valid, got %v", issues)
+	}
+}
+
+func TestValidate_Issues(t *testing.T) {
+	data := `version: 1
+mode: strict
+rules:
+  - name: bad-regex
+    pattern: 'rm\s+(-rf'
+    action: block
+  - name: bad-action
+    pattern: 'curl'
+    action: deny
+  - name: bad-action
+    paths: ["*.pem"]
+    action: allow
+  - name: typo
+    patern: 'x'
+    action: warn
+  - name: empty-limits
+    limits: {}
+    action: warn
+secrets:
+  patterns:
+    - name: tok
+      pattern: '(['
+`
+	_, issues := Validate([]byte(data))
+	want := []struct {
+		line     int
+		severity string
+		contains string
+	}{
+		{2, SeverityError, "unknown mode"},
+		{5, SeverityError, "invalid pattern"},
+		{9, SeverityError, "unknown action"},
+		{10, SeverityError, "duplicate rule name (first defined on line 7)"},
+		{12, SeverityError, "allow only applies to command rules"},
+		{14, SeverityError, "field patern not found"},
+		{17, SeverityWarning, "limits set no maximum"},
+		{22, SeverityError, "secret pattern 'tok'"},
+	}
+	for _, w := range want {
+		found := false
+		for _, issue := range issues {
+			if issue.Line == w.line && issue.Severity == w.severity && strings.Contains(issue.Message, w.contains) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s on line %d containing %q, got %v", w.severity, w.line, w.contains, issues)
+		}
+	}
+	if ErrorCount(issues) != 7 {
+		t.Errorf("expected 7 errors, got %d", ErrorCount(issues))
+	}
+}
+
+func TestValidate_MalformedYAML(t *testing.T) {
+	p, issues := Validate([]byte("version: 1\nrules:\n  - name: a\n   action: block\n"))
+	if p != nil {
+		t.Error("expected no policy for malformed YAML")
+	}
+	if len(issues) != 1 || issues[0].Line == 0 {
+		t.Errorf("expected one issue with a line number, got %v", issues)
+	}
+}
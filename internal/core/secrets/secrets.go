@@ -0,0 +1,277 @@
+// Package secrets detects credentials in diffs and command output.
+//
+// A Scanner combines regular expressions for well-known credential formats
+// (AWS keys, GitHub and Slack tokens, private key headers) with a generic
+// rule for high-entropy values assigned to key-like names, and can redact
+// what it finds.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// secretGroup names the capture group holding the secret when a pattern
+// matches surrounding context too (e.g. "api_key = <secret>").
+const secretGroup = "secret"
+
+// Pattern is a named secret format.
+type Pattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+	// MinEntropy, when positive, drops matches whose Shannon entropy (bits
+	// per character) is lower, to skip placeholders like "changeme".
+	MinEntropy float64
+}
+
+// Finding is a secret found in a file of a patch or in plain text. File is
+// empty for plain text; Line is 1-based in the new version of the file.
+type Finding struct {
+	Rule   string `json:"rule"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Secret string `json:"-"`
+}
+
+// Location formats the finding position as "file:line" (or "line N").
+func (f Finding) Location() string {
+	if f.File == "" {
+		return "line " + strconv.Itoa(f.Line)
+	}
+	return f.File + ":" + strconv.Itoa(f.Line)
+}
+
+// Scanner finds secrets using its Patterns.
+type Scanner struct {
+	Patterns []Pattern
+}
+
+// NewScanner returns a scanner with the built-in patterns.
+func NewScanner() *Scanner {
+	return &Scanner{Patterns: BuiltinPatterns()}
+}
+
+// BuiltinPatterns returns the patterns every scanner starts with.
+func BuiltinPatterns() []Pattern {
+	return []Pattern{
+		{Name: "aws-access-key-id", Regexp: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "aws-secret-access-key", Regexp: regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}?['"]?\s*[:=]\s*['"]?(?P<secret>[A-Za-z0-9/+=]{40})\b`)},
+		{Name: "github-token", Regexp: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+		{Name: "slack-token", Regexp: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+		{Name: "private-key", Regexp: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----`)},
+		{
+			Name:       "high-entropy-secret",
+			Regexp:     regexp.MustCompile(`(?i)(?:api_?key|secret|token|passw(?:or)?d|pwd|credential|auth)[a-z0-9_\-]*['"]?\s*[:=]\s*['"]?(?P<secret>[A-Za-z0-9+/=_\-.]{20,})`),
+			MinEntropy: 3.5,
+		},
+	}
+}
+
+// Add compiles pattern and adds it under name. A group named "secret"
+// limits the reported and redacted part of the match.
+func (s *Scanner) Add(name string, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	s.Patterns = append(s.Patterns, Pattern{Name: name, Regexp: re})
+	return nil
+}
+
+// ScanText returns the secrets in data, reported by line.
+func (s *Scanner) ScanText(data []byte) []Finding {
+	findings := []Finding{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		findings = append(findings, s.scanLine("", line, scanner.Text())...)
+	}
+	return findings
+}
+
+// ScanPatch returns the secrets on lines added by a unified diff, reported by
+// file and line in the new version. Adding lines to a dotenv file (".env",
+// ".env.local", but not ".env.example") is reported as a "dotenv-file"
+// finding too.
+func (s *Scanner) ScanPatch(patch []byte) []Finding {
+	findings := []Finding{}
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	file := ""
+	line := 0
+	inHeader := false
+	dotenvReported := false
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			inHeader = true
+			file = ""
+			dotenvReported = false
+		case inHeader && strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(text, "@@"):
+			inHeader = false
+			line = hunkStart(text)
+		case inHeader:
+		case strings.HasPrefix(text, "+"):
+			if file != "" && !dotenvReported && isDotenv(file) {
+				findings = append(findings, Finding{Rule: "dotenv-file", File: file, Line: line})
+				dotenvReported = true
+			}
+			findings = append(findings, s.scanLine(file, line, text[1:])...)
+			line++
+		case strings.HasPrefix(text, " "):
+			line++
+		}
+	}
+	return findings
+}
+
+// scanLine reports each secret on a line once, under the first pattern that
+// finds it, so a token assigned to "token = ..." is not also reported as a
+// generic high-entropy value.
+func (s *Scanner) scanLine(file string, line int, text string) []Finding {
+	findings := []Finding{}
+	for _, p := range s.Patterns {
+		for _, secret := range p.matches(text) {
+			if overlaps(findings, secret) {
+				continue
+			}
+			findings = append(findings, Finding{Rule: p.Name, File: file, Line: line, Secret: secret})
+		}
+	}
+	return findings
+}
+
+func overlaps(findings []Finding, secret string) bool {
+	for _, f := range findings {
+		if f.Secret != "" && (strings.Contains(f.Secret, secret) || strings.Contains(secret, f.Secret)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns the secrets p finds in text.
+func (p *Pattern) matches(text string) []string {
+	out := []string{}
+	group := p.Regexp.SubexpIndex(secretGroup)
+	for _, m := range p.Regexp.FindAllStringSubmatch(text, -1) {
+		secret := m[0]
+		if group > 0 {
+			secret = m[group]
+		}
+		if secret == "" || (p.MinEntropy > 0 && Entropy(secret) < p.MinEntropy) {
+			continue
+		}
+		out = append(out, secret)
+	}
+	return out
+}
+
+// Redact replaces every secret found in data with "[REDACTED:<rule>]" and
+// returns the result and the number of replacements. The body of a private
+// key block is redacted line by line, keeping whatever precedes the BEGIN
+// marker (such as a diff "+") so patches keep their shape.
+func (s *Scanner) Redact(data []byte) ([]byte, int) {
+	text := redactKeyBlocks(string(data))
+	count := 0
+	for _, p := range s.Patterns {
+		for _, secret := range p.matches(text) {
+			n := strings.Count(text, secret)
+			if n == 0 {
+				continue
+			}
+			text = strings.ReplaceAll(text, secret, "[REDACTED:"+p.Name+"]")
+			count += n
+		}
+	}
+	return []byte(text), count
+}
+
+var keyBegin = regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----`)
+
+// redactKeyBlocks redacts the lines between private key BEGIN and END
+// markers; the BEGIN marker itself is left to the private-key pattern.
+func redactKeyBlocks(text string) string {
+	if !keyBegin.MatchString(text) {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	prefix := ""
+	inKey := false
+	for i, line := range lines {
+		if loc := keyBegin.FindStringIndex(line); loc != nil && !inKey {
+			prefix = line[:loc[0]]
+			inKey = true
+			continue
+		}
+		if !inKey {
+			continue
+		}
+		if strings.Contains(line, "-----END ") {
+			inKey = false
+			continue
+		}
+		if strings.HasPrefix(line, prefix) {
+			lines[i] = prefix + "[REDACTED:private-key]"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Entropy returns the Shannon entropy of s in bits per character.
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len([]rune(s)))
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+func hunkStart(header string) int {
+	// @@ -a,b +c,d @@
+	fields := strings.Fields(header)
+	for _, f := range fields {
+		if strings.HasPrefix(f, "+") {
+			start, _, _ := strings.Cut(f[1:], ",")
+			n, err := strconv.Atoi(start)
+			if err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+func isDotenv(file string) bool {
+	base := path.Base(file)
+	if base != ".env" && !strings.HasPrefix(base, ".env.") {
+		return false
+	}
+	switch strings.TrimPrefix(base, ".env.") {
+	case "example", "sample", "template", "dist":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+// Package shim interposes on commands spawned inside a 'bar wrap' session.
+//
+// Install writes one small script per intercepted command into a shim
+// directory that wrap prepends to PATH. Each script re-enters bar as
+// 'bar shim <name> args...', which checks the command against the policy
+// recorded in the shim directory, runs the real binary found further down
+// PATH and records its cwd, exit code and duration. A 'bar-shell' wrapper exported as SHELL and BAR_SHELL does the same
+// for commands agents run through '$SHELL -c'.
+package shim
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+	"github.com/user/blade-agent-runtime/internal/util/lock"
+)
+
+const (
+	// EnvDir is the shim directory. The scripts set it themselves, so the
+	// wrapped agent cannot point the shims elsewhere.
+	EnvDir     = "BAR_SHIM_DIR"
+	EnvRecords = "BAR_SHIM_RECORDS"
+	// EnvShell points at the shell wrapper; EnvRealShell at the shell it runs.
+	EnvShell     = "BAR_SHELL"
+	EnvRealShell = "BAR_REAL_SHELL"
+)
+
+// ShellName is the name of the shell wrapper installed next to the shims.
+const ShellName = "bar-shell"
+
+// PolicyFile, in the shim directory, lists the policy layers commands are
+// checked against (see policy.FormatLayers); it is empty when policy is not
+// enforced.
+const PolicyFile = ".policy"
+
+// Record describes one intercepted command.
+type Record struct {
+	Time       time.Time      `json:"time"`
+	Cmd        []string       `json:"cmd"`
+	Cwd        string         `json:"cwd"`
+	Shell      bool           `json:"shell,omitempty"`
+	ExitCode   *int           `json:"exit_code,omitempty"`
+	DurationMs int64          `json:"duration_ms,omitempty"`
+	Events     []policy.Event `json:"events,omitempty"`
+	// Decision answers the "confirm" events, if any.
+	Decision *ledger.PolicyDecision `json:"decision,omitempty"`
+	Blocked  bool                   `json:"blocked,omitempty"`
+}
+
+// Install (re)creates dir with a script for each command that runs
+// 'barPath shim <command>', plus the ShellName wrapper, and the PolicyFile
+// holding policyLayers.
+func Install(dir string, barPath string, commands []string, policyLayers string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, PolicyFile), []byte(policyLayers), 0o644); err != nil {
+		return err
+	}
+	for _, name := range append(slices.Clone(commands), ShellName) {
+		if name == "" || strings.ContainsRune(name, '/') {
+			continue
+		}
+		script := "#!/bin/sh\n" + EnvDir + "=" + quote(dir) + " exec " + quote(barPath) + " shim " + quote(name) + " \"$@\"\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PolicyLayers returns the policy layers recorded in the shim directory dir by
+// Install, empty when policy is not enforced. A missing file is an error, so
+// removing it does not turn the checks off.
+func PolicyLayers(dir string) (string, error) {
+	if dir == "" {
+		return "", errors.New("shim directory not set")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, PolicyFile))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Env returns the environment entries that activate the shims in dir,
+// recording intercepted commands to recordsPath.
+func Env(dir string, recordsPath string) []string {
+	wrapper := filepath.Join(dir, ShellName)
+	return []string{
+		"PATH=" + dir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		EnvDir + "=" + dir,
+		EnvRecords + "=" + recordsPath,
+		"SHELL=" + wrapper,
+		EnvShell + "=" + wrapper,
+		EnvRealShell + "=" + RealShell(),
+	}
+}
+
+// RealShell returns the shell the wrapper should run: BAR_REAL_SHELL inside a
+// wrap session, otherwise SHELL, falling back to /bin/sh.
+func RealShell() string {
+	if sh := os.Getenv(EnvRealShell); sh != "" {
+		return sh
+	}
+	if sh := os.Getenv("SHELL"); sh != "" && filepath.Base(sh) != ShellName {
+		return sh
+	}
+	return "/bin/sh"
+}
+
+// LookPath finds name on PATH, skipping the shim directory.
+func LookPath(name string) (string, error) {
+	shimDir := filepath.Clean(os.Getenv(EnvDir))
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" || filepath.Clean(dir) == shimDir {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// Append adds rec to the records file at path.
+func Append(path string, rec *Record) error {
+	if path == "" {
+		return errors.New("shim records path not set")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return lock.With(path, func() error {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// ReadRecords returns the records written to path, or none if the file does
+// not exist.
+func ReadRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Record{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,155 @@
+package shim
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/policy"
+)
+
+func TestInstall(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "shims")
+	// Spare capacity must not let the shell wrapper leak into the caller's slice
+	commands := make([]string, 4, 5)
+	copy(commands, []string{"rm", "git", "bad/name", ""})
+	if err := Install(dir, "/opt/my bar/bar", commands, "repo=/repo/.bar-policy.yaml"); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if extra := commands[:5][4]; extra != "" {
+		t.Errorf("expected the caller's commands untouched, got %q appended", extra)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 4 {
+		t.Fatalf("expected 2 shims, the shell wrapper and the policy file, got %d", len(entries))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "rm"))
+	if err != nil {
+		t.Fatalf("read shim failed: %v", err)
+	}
+	// The script names its own directory, so the agent cannot redirect the shim
+	if !strings.Contains(string(data), EnvDir+"='"+dir+`' exec '/opt/my bar/bar' shim 'rm' "$@"`) {
+		t.Errorf("unexpected shim script %q", data)
+	}
+	if layers, err := PolicyLayers(dir); err != nil || layers != "repo=/repo/.bar-policy.yaml" {
+		t.Errorf("PolicyLayers() = %q, %v", layers, err)
+	}
+	info, _ := os.Stat(filepath.Join(dir, "rm"))
+	if info.Mode().Perm()&0o111 == 0 {
+		t.Error("expected shim to be executable")
+	}
+
+	if err := Install(dir, "/bar", []string{"curl"}, ""); err != nil {
+		t.Fatalf("reinstall failed: %v", err)
+	}
+	if layers, err := PolicyLayers(dir); err != nil || layers != "" {
+		t.Errorf("expected no policy after reinstall, got %q, %v", layers, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rm")); !os.IsNotExist(err) {
+		t.Error("expected reinstall to drop stale shims")
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, ShellName))
+	if !strings.Contains(string(data), `shim '`+ShellName+`' "$@"`) {
+		t.Errorf("unexpected shell wrapper %q", data)
+	}
+}
+
+func TestPolicyLayers_Missing(t *testing.T) {
+	// A removed policy file or an unset shim dir must not turn the checks off
+	if _, err := PolicyLayers(t.TempDir()); err == nil {
+		t.Error("expected a missing policy file to fail")
+	}
+	if _, err := PolicyLayers(""); err == nil {
+		t.Error("expected an unset shim dir to fail")
+	}
+}
+
+func TestLookPath_SkipsShimDir(t *testing.T) {
+	shimDir := t.TempDir()
+	realDir := t.TempDir()
+	os.WriteFile(filepath.Join(shimDir, "tool"), []byte("#!/bin/sh\n"), 0o755)
+	os.WriteFile(filepath.Join(realDir, "tool"), []byte("#!/bin/sh\n"), 0o755)
+	os.WriteFile(filepath.Join(realDir, "data"), []byte("x"), 0o644)
+
+	t.Setenv("PATH", shimDir+string(os.PathListSeparator)+realDir)
+	t.Setenv(EnvDir, shimDir)
+
+	got, err := LookPath("tool")
+	if err != nil {
+		t.Fatalf("LookPath failed: %v", err)
+	}
+	if got != filepath.Join(realDir, "tool") {
+		t.Errorf("expected real binary, got %s", got)
+	}
+	if _, err := LookPath("data"); err == nil {
+		t.Error("expected non-executable file to be skipped")
+	}
+}
+
+func TestAppendAndReadRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.commands.jsonl")
+
+	records, err := ReadRecords(path)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("expected no records for missing file, got %v, %v", records, err)
+	}
+
+	rec := &Record{
+		Time:    time.Now().UTC(),
+		Cmd:     []string{"rm", "-rf", "build"},
+		Cwd:     "/ws",
+		Events:  []policy.Event{{Rule: "no-rm", Action: "block"}},
+		Blocked: true,
+	}
+	if err := Append(path, rec); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := Append(path, &Record{Cmd: []string{"git", "status"}}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	records, err = ReadRecords(path)
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	if len(records) != 2 || !records[0].Blocked || records[0].Events[0].Rule != "no-rm" {
+		t.Errorf("unexpected records %+v", records)
+	}
+	if err := Append("", rec); err == nil {
+		t.Error("expected error without a records path")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("SHELL", "/bin/zsh")
+	t.Setenv(EnvRealShell, "")
+	env := Env("/shims", "/rec.jsonl")
+	if env[0] != "PATH=/shims"+string(os.PathListSeparator)+"/usr/bin" {
+		t.Errorf("expected shim dir first on PATH, got %s", env[0])
+	}
+	want := map[string]bool{
+		"SHELL=/shims/" + ShellName:       true,
+		EnvShell + "=/shims/" + ShellName: true,
+		EnvRealShell + "=/bin/zsh":        true,
+	}
+	for _, e := range env {
+		delete(want, e)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing shell entries %v in %v", want, env)
+	}
+}
+
+func TestRealShell(t *testing.T) {
+	t.Setenv(EnvRealShell, "")
+	t.Setenv("SHELL", "/shims/"+ShellName)
+	if got := RealShell(); got != "/bin/sh" {
+		t.Errorf("expected the wrapper to never run itself, got %s", got)
+	}
+	t.Setenv(EnvRealShell, "/bin/bash")
+	if got := RealShell(); got != "/bin/bash" {
+		t.Errorf("expected BAR_REAL_SHELL, got %s", got)
+	}
+}
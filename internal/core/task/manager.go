@@ -7,6 +7,7 @@ import (
 
 	barerrors "github.com/user/blade-agent-runtime/internal/util/errors"
 	utiljson "github.com/user/blade-agent-runtime/internal/util/json"
+	"github.com/user/blade-agent-runtime/internal/util/lock"
 )
 
 type Manager struct {
@@ -42,7 +43,7 @@ func (m *Manager) Create(id string, name string, baseRef string, branch string,
 	if err := os.MkdirAll(filepath.Join(taskDir, "artifacts"), 0o755); err != nil {
 		return nil, err
 	}
-	if err := utiljson.WriteFile(filepath.Join(taskDir, "task.json"), task); err != nil {
+	if err := m.writeTask(task); err != nil {
 		return nil, err
 	}
 	ledgerPath := filepath.Join(taskDir, "ledger.jsonl")
@@ -55,9 +56,8 @@ func (m *Manager) Create(id string, name string, baseRef string, branch string,
 }
 
 func (m *Manager) Get(taskID string) (*Task, error) {
-	taskPath := filepath.Join(m.TasksDir, taskID, "task.json")
 	task := &Task{}
-	if err := utiljson.ReadFile(taskPath, task); err != nil {
+	if err := utiljson.ReadFile(m.taskPath(taskID), task); err != nil {
 		return nil, err
 	}
 	return task, nil
@@ -99,13 +99,37 @@ func (m *Manager) SaveState(state *State) error {
 	return SaveState(m.StatePath, state)
 }
 
+// UpdateState applies fn to the current state and saves it while holding the
+// state file lock, so concurrent bar processes do not lose each other's
+// updates.
+func (m *Manager) UpdateState(fn func(state *State) error) error {
+	return lock.With(m.StatePath, func() error {
+		state, err := m.LoadState()
+		if err != nil {
+			return err
+		}
+		if err := fn(state); err != nil {
+			return err
+		}
+		return saveState(m.StatePath, state)
+	})
+}
+
 func (m *Manager) SetActive(taskID string) error {
-	state, err := m.LoadState()
-	if err != nil {
-		return err
-	}
-	state.ActiveTaskID = taskID
-	return m.SaveState(state)
+	return m.UpdateState(func(state *State) error {
+		state.ActiveTaskID = taskID
+		return nil
+	})
+}
+
+// ClearActive unsets the active task if it is taskID.
+func (m *Manager) ClearActive(taskID string) error {
+	return m.UpdateState(func(state *State) error {
+		if state.ActiveTaskID == taskID {
+			state.ActiveTaskID = ""
+		}
+		return nil
+	})
 }
 
 func (m *Manager) GetActive() (*Task, error) {
@@ -119,13 +143,19 @@ func (m *Manager) GetActive() (*Task, error) {
 	return m.Get(state.ActiveTaskID)
 }
 
+// Close marks the task closed, updating task to its saved state.
 func (m *Manager) Close(task *Task) error {
-	now := time.Now().UTC()
-	task.Status = TaskStatusClosed
-	task.ClosedAt = &now
-	task.UpdatedAt = now
-	taskPath := filepath.Join(m.TasksDir, task.ID, "task.json")
-	return utiljson.WriteFile(taskPath, task)
+	updated, err := m.UpdateTask(task.ID, func(t *Task) error {
+		now := time.Now().UTC()
+		t.Status = TaskStatusClosed
+		t.ClosedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*task = *updated
+	return nil
 }
 
 func (m *Manager) Delete(taskID string) error {
@@ -133,10 +163,36 @@ func (m *Manager) Delete(taskID string) error {
 	return os.RemoveAll(taskDir)
 }
 
-func (m *Manager) Update(task *Task) error {
-	task.UpdatedAt = time.Now().UTC()
-	taskPath := filepath.Join(m.TasksDir, task.ID, "task.json")
-	return utiljson.WriteFile(taskPath, task)
+// UpdateTask applies fn to the saved task and saves it while holding the task
+// file lock, so concurrent bar processes do not lose each other's updates. It
+// returns the updated task.
+func (m *Manager) UpdateTask(taskID string, fn func(task *Task) error) (*Task, error) {
+	var task *Task
+	err := lock.With(m.taskPath(taskID), func() error {
+		var err error
+		if task, err = m.Get(taskID); err != nil {
+			return err
+		}
+		if err := fn(task); err != nil {
+			return err
+		}
+		task.UpdatedAt = time.Now().UTC()
+		return utiljson.WriteFile(m.taskPath(taskID), task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (m *Manager) taskPath(taskID string) string {
+	return filepath.Join(m.TasksDir, taskID, "task.json")
+}
+
+func (m *Manager) writeTask(task *Task) error {
+	return lock.With(m.taskPath(task.ID), func() error {
+		return utiljson.WriteFile(m.taskPath(task.ID), task)
+	})
 }
 
 func (m *Manager) ResolveByName(name string) (*Task, error) {
@@ -3,6 +3,7 @@ package task
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -166,3 +167,109 @@ func TestManager_Delete(t *testing.T) {
 		t.Error("expected error after delete")
 	}
 }
+
+func TestManager_ConcurrentStateUpdates(t *testing.T) {
+	tmpDir := t.TempDir()
+	barDir := filepath.Join(tmpDir, ".bar")
+	os.MkdirAll(filepath.Join(barDir, "tasks"), 0755)
+
+	m := NewManager(tmpDir, barDir)
+	if err := m.SaveState(DefaultState()); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	// Each writer bumps Version under UpdateState; a lost update would leave
+	// the counter short.
+	const workers = 40
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := NewManager(tmpDir, barDir).UpdateState(func(state *State) error {
+				state.Version++
+				return nil
+			})
+			if err != nil {
+				t.Errorf("UpdateState failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	state, err := m.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if state.Version != 1+workers {
+		t.Errorf("expected version %d, got %d", 1+workers, state.Version)
+	}
+}
+
+func TestManager_SetAndClearActive(t *testing.T) {
+	tmpDir := t.TempDir()
+	barDir := filepath.Join(tmpDir, ".bar")
+	os.MkdirAll(filepath.Join(barDir, "tasks"), 0755)
+
+	m := NewManager(tmpDir, barDir)
+	_, _ = m.Create("active1", "active-one", "main", "bar/active-one", "/ws/active1")
+
+	if err := m.SetActive("active1"); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+	if err := m.ClearActive("other"); err != nil {
+		t.Fatalf("ClearActive failed: %v", err)
+	}
+	active, err := m.GetActive()
+	if err != nil || active.ID != "active1" {
+		t.Fatalf("expected active1 to stay active, got %v, %v", active, err)
+	}
+	if err := m.ClearActive("active1"); err != nil {
+		t.Fatalf("ClearActive failed: %v", err)
+	}
+	if _, err := m.GetActive(); err == nil {
+		t.Error("expected no active task after ClearActive")
+	}
+}
+
+func TestManager_ConcurrentUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	barDir := filepath.Join(tmpDir, ".bar")
+	os.MkdirAll(filepath.Join(barDir, "tasks"), 0755)
+
+	m := NewManager(tmpDir, barDir)
+	_, _ = m.Create("update1", "update-one", "main", "bar/update-one", "/ws/update1")
+
+	// Each writer appends to BaseSHA under UpdateTask; a lost update would
+	// leave it short.
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := NewManager(tmpDir, barDir).UpdateTask("update1", func(task *Task) error {
+				task.BaseSHA += "x"
+				return nil
+			})
+			if err != nil {
+				t.Errorf("UpdateTask failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := m.Get("update1"); err != nil {
+				t.Errorf("Get saw a partially written task.json: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	task, err := m.Get("update1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(task.BaseSHA) != workers {
+		t.Errorf("expected %d updates, got %d", workers, len(task.BaseSHA))
+	}
+}
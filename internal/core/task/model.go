@@ -14,6 +14,12 @@ type Task struct {
 	UpdatedAt     time.Time      `json:"updated_at"`
 	ClosedAt      *time.Time     `json:"closed_at,omitempty"`
 	Metadata      map[string]any `json:"metadata,omitempty"`
+	// Policy is the task's own policy file, copied from 'bar task start
+	// --policy'; it takes precedence over the other policy layers.
+	Policy string `json:"policy,omitempty"`
+	// BaseSHA is the commit BaseRef pointed at when the task started or was
+	// last synced, to tell whether the base branch moved on before applying.
+	BaseSHA string `json:"base_sha,omitempty"`
 }
 
 type TaskStatus string
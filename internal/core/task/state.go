@@ -4,6 +4,7 @@ import (
 	"time"
 
 	utiljson "github.com/user/blade-agent-runtime/internal/util/json"
+	"github.com/user/blade-agent-runtime/internal/util/lock"
 )
 
 type State struct {
@@ -28,7 +29,14 @@ func LoadState(path string) (*State, error) {
 	return state, nil
 }
 
+// SaveState writes state while holding the state file lock.
 func SaveState(path string, state *State) error {
+	return lock.With(path, func() error {
+		return saveState(path, state)
+	})
+}
+
+func saveState(path string, state *State) error {
 	state.UpdatedAt = time.Now().UTC()
 	return utiljson.WriteFile(path, state)
 }
@@ -2,6 +2,7 @@ package workspace
 
 import (
 	"path/filepath"
+	"strings"
 
 	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
 )
@@ -55,3 +56,81 @@ func (m *Manager) Reset(path string, baseRef string, hard bool) error {
 	_, err := m.Git.Run(path, "reset", "--hard", baseRef)
 	return err
 }
+
+// SnapshotRef returns the hidden ref a step snapshot is kept under. Refs in
+// this namespace are shared by all worktrees, so snapshots outlive the task
+// workspace and are never collected by git gc.
+func SnapshotRef(taskID string, stepID string) string {
+	return "refs/bar/" + taskID + "/" + stepID
+}
+
+// Snapshot records the current worktree state (tracked, modified and
+// untracked non-ignored files) as a commit whose parent is HEAD and, when ref
+// is not empty, points ref at it. The user's index and branch are left
+// untouched.
+func (m *Manager) Snapshot(path string, ref string, message string) (string, error) {
+	var sha string
+	err := m.Git.WithTempIndex(func(env []string) error {
+		env = append(env, gitadapter.Identity...)
+		if _, err := m.Git.RunWithEnv(path, env, "read-tree", "HEAD"); err != nil {
+			return err
+		}
+		if _, err := m.Git.RunWithEnv(path, env, "add", "-A"); err != nil {
+			return err
+		}
+		tree, err := m.Git.RunWithEnv(path, env, "write-tree")
+		if err != nil {
+			return err
+		}
+		sha, err = m.Git.RunWithEnv(path, env, "commit-tree", tree, "-p", "HEAD", "-m", message)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if ref != "" {
+		if err := m.KeepSnapshot(ref, sha); err != nil {
+			return "", err
+		}
+	}
+	return sha, nil
+}
+
+// KeepSnapshot points ref at an existing snapshot commit.
+func (m *Manager) KeepSnapshot(ref string, sha string) error {
+	_, err := m.Git.Run(m.RepoRoot, "update-ref", ref, sha)
+	return err
+}
+
+// DeleteSnapshots removes every snapshot ref recorded for a task.
+func (m *Manager) DeleteSnapshots(taskID string) error {
+	out, err := m.Git.Run(m.RepoRoot, "for-each-ref", "--format=%(refname)", "refs/bar/"+taskID+"/")
+	if err != nil {
+		return err
+	}
+	for _, ref := range strings.Split(out, "\n") {
+		if ref == "" {
+			continue
+		}
+		if _, err := m.Git.Run(m.RepoRoot, "update-ref", "-d", ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore returns the worktree to the state captured by Snapshot: files are
+// rewritten from the snapshot tree and files absent from it are removed. HEAD
+// stays where it is, even when an apply or sync moved it since the snapshot,
+// and the index is reset to it, leaving the restored files as unstaged
+// changes.
+func (m *Manager) Restore(path string, snapshot string) error {
+	if _, err := m.Git.Run(path, "read-tree", "-u", "--reset", snapshot); err != nil {
+		return err
+	}
+	if _, err := m.Git.Run(path, "clean", "-fd"); err != nil {
+		return err
+	}
+	_, err := m.Git.Run(path, "reset", "-q")
+	return err
+}
@@ -0,0 +1,153 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gitadapter "github.com/user/blade-agent-runtime/internal/adapters/git"
+)
+
+func initRepo(t *testing.T) (string, *gitadapter.Runner) {
+	t.Helper()
+	dir := t.TempDir()
+	git := gitadapter.NewRunner()
+	env := []string{
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+	}
+	if _, err := git.Run(dir, "init", "-q", "-b", "main"); err != nil {
+		t.Fatalf("git init failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("ignored.txt\n"), 0o644)
+	if _, err := git.Run(dir, "add", "-A"); err != nil {
+		t.Fatalf("git add failed: %v", err)
+	}
+	if _, err := git.RunWithEnv(dir, env, "commit", "-q", "-m", "init"); err != nil {
+		t.Fatalf("git commit failed: %v", err)
+	}
+	return dir, git
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s failed: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestManager_SnapshotAndRestore(t *testing.T) {
+	dir, git := initRepo(t)
+	m := NewManager(dir, filepath.Join(dir, "workspaces"), git)
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("step1\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0o644)
+	snap, err := m.Snapshot(dir, "", "snapshot 1")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	status, _ := git.Run(dir, "status", "--porcelain")
+	if status != "M a.txt\n?? new.txt" && status != " M a.txt\n?? new.txt" {
+		t.Errorf("Snapshot should not touch the index, got status %q", status)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("step2\n"), 0o644)
+	os.Remove(filepath.Join(dir, "new.txt"))
+	os.WriteFile(filepath.Join(dir, "later.txt"), []byte("later\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("keep\n"), 0o644)
+
+	if err := m.Restore(dir, snap); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "a.txt")); got != "step1\n" {
+		t.Errorf("expected a.txt 'step1', got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "new.txt")); got != "new\n" {
+		t.Errorf("expected new.txt restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "later.txt")); !os.IsNotExist(err) {
+		t.Error("expected later.txt to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ignored.txt")); err != nil {
+		t.Error("expected ignored files to be kept")
+	}
+	status, _ = git.Run(dir, "status", "--porcelain")
+	if status != "M a.txt\n?? new.txt" && status != " M a.txt\n?? new.txt" {
+		t.Errorf("expected restored changes to be unstaged, got status %q", status)
+	}
+}
+
+func TestManager_Restore_KeepsHead(t *testing.T) {
+	dir, git := initRepo(t)
+	m := NewManager(dir, filepath.Join(dir, "workspaces"), git)
+	env := []string{"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com"}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("step1\n"), 0o644)
+	snap, err := m.Snapshot(dir, "", "snapshot 1")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	// An apply or sync moves the task branch past the snapshot's parent
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\n"), 0o644)
+	git.Run(dir, "add", "b.txt")
+	if _, err := git.RunWithEnv(dir, env, "commit", "-q", "-m", "applied"); err != nil {
+		t.Fatalf("git commit failed: %v", err)
+	}
+	head, _ := git.Run(dir, "rev-parse", "HEAD")
+
+	if err := m.Restore(dir, snap); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got, _ := git.Run(dir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("expected HEAD to stay at %s, got %s", head, got)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.txt")); got != "step1\n" {
+		t.Errorf("expected a.txt 'step1', got %q", got)
+	}
+	// The restored tree shows as unstaged changes against the current HEAD
+	status, _ := git.Run(dir, "status", "--porcelain")
+	if status != "M a.txt\n D b.txt" && status != " M a.txt\n D b.txt" {
+		t.Errorf("unexpected status %q", status)
+	}
+}
+
+func TestManager_SnapshotRefs(t *testing.T) {
+	dir, git := initRepo(t)
+	m := NewManager(dir, filepath.Join(dir, "workspaces"), git)
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed\n"), 0o644)
+	ref := SnapshotRef("task1", "0001")
+	if ref != "refs/bar/task1/0001" {
+		t.Errorf("unexpected snapshot ref %q", ref)
+	}
+	snap, err := m.Snapshot(dir, ref, "snapshot 1")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	got, err := git.Run(dir, "rev-parse", ref)
+	if err != nil {
+		t.Fatalf("rev-parse failed: %v", err)
+	}
+	if got != snap {
+		t.Errorf("expected %s to point at %s, got %s", ref, snap, got)
+	}
+	branch, _ := git.Run(dir, "rev-parse", "HEAD")
+	if branch == snap {
+		t.Error("Snapshot should not move HEAD")
+	}
+
+	if err := m.DeleteSnapshots("task1"); err != nil {
+		t.Fatalf("DeleteSnapshots failed: %v", err)
+	}
+	if _, err := git.Run(dir, "rev-parse", "--verify", "-q", ref); err == nil {
+		t.Error("expected snapshot ref to be deleted")
+	}
+}
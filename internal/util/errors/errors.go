@@ -27,6 +27,15 @@ const (
 	ErrCommandFailed     ErrorCode = "COMMAND_FAILED"
 	ErrRollbackFailed    ErrorCode = "ROLLBACK_FAILED"
 	ErrUpdateFailed      ErrorCode = "UPDATE_FAILED"
+	ErrSessionRunning    ErrorCode = "SESSION_RUNNING"
+	ErrLedgerTampered    ErrorCode = "LEDGER_TAMPERED"
+	ErrSecretsDetected   ErrorCode = "SECRETS_DETECTED"
+	ErrPolicyInvalid     ErrorCode = "POLICY_INVALID"
+	ErrHookFailed        ErrorCode = "HOOK_FAILED"
+	ErrGateFailed        ErrorCode = "GATE_FAILED"
+	ErrApplyConflict     ErrorCode = "APPLY_CONFLICT"
+	ErrSyncConflict      ErrorCode = "SYNC_CONFLICT"
+	ErrSyncInProgress    ErrorCode = "SYNC_IN_PROGRESS"
 )
 
 func (e *BarError) Error() string {
@@ -92,6 +101,47 @@ func WorkspaceNotClean() *BarError {
 	}
 }
 
+func BaseCheckoutDirty(baseRef, checkout string, files []string) *BarError {
+	return &BarError{
+		Code:    ErrWorkspaceNotClean,
+		Message: fmt.Sprintf("Apply aborted: %s is checked out in %s, which has uncommitted changes: %s", baseRef, checkout, listFiles(files)),
+		Hint:    "Commit or stash (git stash -u) the changes in " + checkout + " and apply again,\n   or apply to a separate branch with --to-branch.",
+	}
+}
+
+func ApplyConflict(baseRef string, files []string) *BarError {
+	return &BarError{
+		Code:    ErrApplyConflict,
+		Message: fmt.Sprintf("Apply aborted: the task conflicts with changes on %s in %s", baseRef, listFiles(files)),
+		Hint:    "Run 'bar sync' to bring the task up to date with " + baseRef + " and resolve the conflicts in the workspace,\n   or apply to a separate branch with --to-branch.",
+	}
+}
+
+func SyncConflict(baseRef, workspace string, files []string) *BarError {
+	return &BarError{
+		Code:    ErrSyncConflict,
+		Message: fmt.Sprintf("Sync stopped: the task conflicts with changes on %s in %s", baseRef, listFiles(files)),
+		Hint:    "Resolve the conflicts in " + workspace + " (remove the conflict markers),\n   then run 'bar sync --continue', or 'bar sync --abort' to undo the sync.",
+	}
+}
+
+func SyncInProgress(taskName string) *BarError {
+	return &BarError{
+		Code:    ErrSyncInProgress,
+		Message: fmt.Sprintf("Task '%s' has a sync in progress", taskName),
+		Hint:    "Resolve the conflicts and run 'bar sync --continue', or run 'bar sync --abort'.",
+	}
+}
+
+// listFiles joins up to three files, summarizing the rest.
+func listFiles(files []string) string {
+	shown := files
+	if len(shown) > 3 {
+		shown = append(shown[:3:3], fmt.Sprintf("and %d more", len(files)-3))
+	}
+	return strings.Join(shown, ", ")
+}
+
 func PolicyViolation(rule, reason string) *BarError {
 	msg := "Command blocked by policy."
 	if rule != "" {
@@ -108,6 +158,93 @@ func PolicyViolation(rule, reason string) *BarError {
 	}
 }
 
+func ApplyBlockedByPolicy(rule, reason, matched string, files []string) *BarError {
+	hint := fmt.Sprintf("Matched: %s", matched)
+	if len(files) > 0 {
+		hint = fmt.Sprintf("Changed files: %s", strings.Join(files, ", "))
+	}
+	if reason != "" {
+		hint = fmt.Sprintf("Reason: %s\n   %s", reason, hint)
+	}
+	return &BarError{
+		Code:    ErrPolicyViolation,
+		Message: fmt.Sprintf("Apply blocked by policy rule: %s", rule),
+		Hint:    hint + "\n   Revert these changes with 'bar rollback' or change the policy.",
+	}
+}
+
+func PolicyConfirmationRequired(rule string, files []string) *BarError {
+	return &BarError{
+		Code:    ErrPolicyViolation,
+		Message: fmt.Sprintf("Policy rule '%s' requires confirmation before apply.", rule),
+		Hint:    fmt.Sprintf("Changed files: %s\n   Run 'bar apply' in an interactive terminal to confirm.", strings.Join(files, ", ")),
+	}
+}
+
+// PolicyConfirmationDenied reports a command that matched a "confirm" rule
+// and was denied, or not approved within the confirmation timeout.
+func PolicyConfirmationDenied(rule, by, via string) *BarError {
+	hint := fmt.Sprintf("Denied by %s.", by)
+	if via == "timeout" {
+		hint = "No decision arrived in time.\n   Approve pending requests in the Web UI ('bar ui') or raise policy.confirm_timeout."
+	}
+	return &BarError{
+		Code:    ErrPolicyViolation,
+		Message: fmt.Sprintf("Command not confirmed for policy rule: %s", rule),
+		Hint:    hint,
+	}
+}
+
+func PolicyInvalid(path string, errors int) *BarError {
+	return &BarError{
+		Code:    ErrPolicyInvalid,
+		Message: fmt.Sprintf("Policy file %s has %d error(s).", path, errors),
+		Hint:    "Fix the reported lines and run 'bar policy validate' again.",
+	}
+}
+
+func HookFailed(phase, cmd string, exitCode int) *BarError {
+	return &BarError{
+		Code:    ErrHookFailed,
+		Message: fmt.Sprintf("%s hook '%s' failed with exit code %d.", phase, cmd, exitCode),
+		Hint:    "Check the hook output with 'bar log --step <id>' or fix hooks." + phase + " in the config.",
+	}
+}
+
+func ApplyBlockedByHook(stepID, cmd string, exitCode int) *BarError {
+	return &BarError{
+		Code:    ErrHookFailed,
+		Message: fmt.Sprintf("Apply blocked: post_run hook '%s' failed in step %s (exit code %d).", cmd, stepID, exitCode),
+		Hint:    "Fix the failure and record a new step (e.g. 'bar run -- true' runs the hooks again), or set hooks.post_run_failure to warn.",
+	}
+}
+
+func GateFailed(name, stepID string, exitCode int) *BarError {
+	return &BarError{
+		Code:    ErrGateFailed,
+		Message: fmt.Sprintf("Apply blocked: gate '%s' failed in step %s (exit code %d).", name, stepID, exitCode),
+		Hint:    "Check the gate output with 'bar log --step " + stepID + "', fix the failure and apply again, or use --skip-gates.",
+	}
+}
+
+func SecretsDetected(locations []string) *BarError {
+	return &BarError{
+		Code:    ErrSecretsDetected,
+		Message: fmt.Sprintf("Apply blocked: %d possible secret(s) in the changes.", len(locations)),
+		Hint:    fmt.Sprintf("Found at: %s\n   Remove them, or run 'bar apply --allow-secrets' if they are not secrets.", listFiles(locations)),
+	}
+}
+
+// StepSecretsDetected blocks a per-step apply whose step snapshots, which
+// become commits or patches as they are, contain possible secrets.
+func StepSecretsDetected(mode string, locations []string) *BarError {
+	return &BarError{
+		Code:    ErrSecretsDetected,
+		Message: fmt.Sprintf("Apply blocked: %d possible secret(s) in the step snapshots --mode %s would publish.", len(locations), mode),
+		Hint:    fmt.Sprintf("Found at: %s\n   Roll back the steps that added them, apply with --mode squash once they are removed, or run 'bar apply --allow-secrets' if they are not secrets.", listFiles(locations)),
+	}
+}
+
 func NotGitRepo() *BarError {
 	return &BarError{
 		Code:    ErrNotGitRepo,
@@ -134,11 +271,11 @@ func CommandFailed(cmd string, cause error) *BarError {
 	}
 }
 
-func RollbackNotSupported() *BarError {
+func SnapshotNotFound(stepID string) *BarError {
 	return &BarError{
 		Code:    ErrRollbackFailed,
-		Message: "Step-level rollback is not supported in v0.",
-		Hint:    "Use 'bar rollback --base' to rollback to the initial state.",
+		Message: fmt.Sprintf("Step '%s' has no workspace snapshot.", stepID),
+		Hint:    "Only run steps recorded by this version of BAR can be restored.\n   Use 'bar rollback --base' to rollback to the initial state.",
 	}
 }
 
@@ -146,7 +283,23 @@ func RollbackRequiresBase() *BarError {
 	return &BarError{
 		Code:    ErrRollbackFailed,
 		Message: "Rollback target not specified.",
-		Hint:    "Use 'bar rollback --base' to rollback to the initial state.",
+		Hint:    "Use 'bar rollback --base' to rollback to the initial state,\n   or 'bar rollback --step <id>' to restore a recorded step.",
+	}
+}
+
+func SessionStillRunning(pid int) *BarError {
+	return &BarError{
+		Code:    ErrSessionRunning,
+		Message: fmt.Sprintf("The session is still running (pid %d).", pid),
+		Hint:    "Wait for it to finish, or use 'bar resume --force' if the process is not BAR.",
+	}
+}
+
+func LedgerTampered(issues int) *BarError {
+	return &BarError{
+		Code:    ErrLedgerTampered,
+		Message: fmt.Sprintf("Ledger verification failed with %d issue(s).", issues),
+		Hint:    "The ledger or its artifacts were modified after they were recorded.\n   Run 'bar ledger verify --format json' for details.",
 	}
 }
 
@@ -188,6 +188,163 @@ func TestPolicyViolation(t *testing.T) {
 	}
 }
 
+func TestApplyBlockedByPolicy(t *testing.T) {
+	err := ApplyBlockedByPolicy("no-ci", "CI is owned by infra", ".github/**", []string{".github/workflows/ci.yml"})
+	if err.Code != ErrPolicyViolation {
+		t.Errorf("Code = %v, want %v", err.Code, ErrPolicyViolation)
+	}
+	for _, s := range []string{"no-ci", "CI is owned by infra", ".github/workflows/ci.yml"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() = %q, want to contain %q", err.Error(), s)
+		}
+	}
+	err = ApplyBlockedByPolicy("max-files", "", "files 312 > 200", nil)
+	if !strings.Contains(err.Error(), "files 312 > 200") {
+		t.Errorf("Error() should contain the exceeded limit, got %q", err.Error())
+	}
+}
+
+func TestPolicyConfirmationRequired(t *testing.T) {
+	err := PolicyConfirmationRequired("confirm-secrets", []string{"secrets/a.json"})
+	if err.Code != ErrPolicyViolation {
+		t.Errorf("Code = %v, want %v", err.Code, ErrPolicyViolation)
+	}
+	if !strings.Contains(err.Error(), "confirm-secrets") || !strings.Contains(err.Error(), "secrets/a.json") {
+		t.Errorf("Error() should contain the rule and files, got %q", err.Error())
+	}
+}
+
+func TestPolicyConfirmationDenied(t *testing.T) {
+	err := PolicyConfirmationDenied("confirm-deploy", "alice", "web")
+	if err.Code != ErrPolicyViolation {
+		t.Errorf("Code = %v, want %v", err.Code, ErrPolicyViolation)
+	}
+	if !strings.Contains(err.Error(), "confirm-deploy") || !strings.Contains(err.Error(), "alice") {
+		t.Errorf("Error() should contain the rule and who denied it, got %q", err.Error())
+	}
+	err = PolicyConfirmationDenied("confirm-deploy", "bar", "timeout")
+	if !strings.Contains(err.Error(), "policy.confirm_timeout") {
+		t.Errorf("Error() should point at the timeout setting, got %q", err.Error())
+	}
+}
+
+func TestPolicyInvalid(t *testing.T) {
+	err := PolicyInvalid(".bar/policy.yaml", 2)
+	if err.Code != ErrPolicyInvalid {
+		t.Errorf("Code = %v, want %v", err.Code, ErrPolicyInvalid)
+	}
+	if !strings.Contains(err.Error(), ".bar/policy.yaml has 2 error(s)") {
+		t.Errorf("Error() should contain the path and count, got %q", err.Error())
+	}
+}
+
+func TestHookFailed(t *testing.T) {
+	err := HookFailed("pre_run", "make lint", 2)
+	if err.Code != ErrHookFailed {
+		t.Errorf("Code = %v, want %v", err.Code, ErrHookFailed)
+	}
+	if !strings.Contains(err.Error(), "'make lint' failed with exit code 2") {
+		t.Errorf("Error() should contain the hook and exit code, got %q", err.Error())
+	}
+}
+
+func TestApplyBlockedByHook(t *testing.T) {
+	err := ApplyBlockedByHook("0004", "go test ./...", 1)
+	if err.Code != ErrHookFailed {
+		t.Errorf("Code = %v, want %v", err.Code, ErrHookFailed)
+	}
+	for _, s := range []string{"step 0004", "go test ./...", "post_run_failure"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() should contain %q, got %q", s, err.Error())
+		}
+	}
+}
+
+func TestGateFailed(t *testing.T) {
+	err := GateFailed("test", "0005", 2)
+	if err.Code != ErrGateFailed {
+		t.Errorf("Code = %v, want %v", err.Code, ErrGateFailed)
+	}
+	for _, s := range []string{"gate 'test'", "step 0005", "exit code 2", "--skip-gates"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() should contain %q, got %q", s, err.Error())
+		}
+	}
+}
+
+func TestBaseCheckoutDirty(t *testing.T) {
+	err := BaseCheckoutDirty("main", "/src/repo", []string{"a.go", "b.go"})
+	if err.Code != ErrWorkspaceNotClean {
+		t.Errorf("Code = %v, want %v", err.Code, ErrWorkspaceNotClean)
+	}
+	for _, s := range []string{"main", "/src/repo", "a.go, b.go", "--to-branch"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() should contain %q, got %q", s, err.Error())
+		}
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	err := ApplyConflict("main", []string{"a.go", "b.go", "c.go", "d.go", "e.go"})
+	if err.Code != ErrApplyConflict {
+		t.Errorf("Code = %v, want %v", err.Code, ErrApplyConflict)
+	}
+	for _, s := range []string{"changes on main", "a.go, b.go, c.go, and 2 more", "bar sync"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() should contain %q, got %q", s, err.Error())
+		}
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	err := SyncConflict("main", "/ws", []string{"a.go"})
+	if err.Code != ErrSyncConflict {
+		t.Errorf("Code = %v, want %v", err.Code, ErrSyncConflict)
+	}
+	for _, s := range []string{"changes on main in a.go", "/ws", "bar sync --continue", "bar sync --abort"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() should contain %q, got %q", s, err.Error())
+		}
+	}
+}
+
+func TestSyncInProgress(t *testing.T) {
+	err := SyncInProgress("my-task")
+	if err.Code != ErrSyncInProgress {
+		t.Errorf("Code = %v, want %v", err.Code, ErrSyncInProgress)
+	}
+	if !strings.Contains(err.Error(), "my-task") {
+		t.Errorf("Error() should contain the task name, got %q", err.Error())
+	}
+}
+
+func TestSecretsDetected(t *testing.T) {
+	err := SecretsDetected([]string{"a.go:1", "b.go:2", "c.go:3", "d.go:4"})
+	if err.Code != ErrSecretsDetected {
+		t.Errorf("Code = %v, want %v", err.Code, ErrSecretsDetected)
+	}
+	for _, s := range []string{"4 possible secret(s)", "a.go:1", "and 1 more", "--allow-secrets"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() = %q, want to contain %q", err.Error(), s)
+		}
+	}
+	if strings.Contains(err.Error(), "d.go:4") {
+		t.Error("expected only the first 3 locations")
+	}
+}
+
+func TestStepSecretsDetected(t *testing.T) {
+	err := StepSecretsDetected("steps", []string{"step 0002: .env:1"})
+	if err.Code != ErrSecretsDetected {
+		t.Errorf("Code = %v, want %v", err.Code, ErrSecretsDetected)
+	}
+	for _, s := range []string{"1 possible secret(s)", "--mode steps", "step 0002: .env:1", "--mode squash", "--allow-secrets"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error() = %q, want to contain %q", err.Error(), s)
+		}
+	}
+}
+
 func TestNotGitRepo(t *testing.T) {
 	err := NotGitRepo()
 	if err.Code != ErrNotGitRepo {
@@ -229,13 +386,13 @@ func TestCommandFailed(t *testing.T) {
 	}
 }
 
-func TestRollbackNotSupported(t *testing.T) {
-	err := RollbackNotSupported()
+func TestSnapshotNotFound(t *testing.T) {
+	err := SnapshotNotFound("0003")
 	if err.Code != ErrRollbackFailed {
 		t.Errorf("Code = %v, want %v", err.Code, ErrRollbackFailed)
 	}
-	if !strings.Contains(err.Error(), "not supported") {
-		t.Errorf("Error() should contain 'not supported'")
+	if !strings.Contains(err.Error(), "0003") {
+		t.Errorf("Error() should contain step ID '0003'")
 	}
 	if !strings.Contains(err.Error(), "--base") {
 		t.Errorf("Error() should contain hint about '--base'")
@@ -253,6 +410,35 @@ func TestRollbackRequiresBase(t *testing.T) {
 	if !strings.Contains(err.Error(), "--base") {
 		t.Errorf("Error() should contain hint about '--base'")
 	}
+	if !strings.Contains(err.Error(), "--step") {
+		t.Errorf("Error() should contain hint about '--step'")
+	}
+}
+
+func TestSessionStillRunning(t *testing.T) {
+	err := SessionStillRunning(4242)
+	if err.Code != ErrSessionRunning {
+		t.Errorf("Code = %v, want %v", err.Code, ErrSessionRunning)
+	}
+	if !strings.Contains(err.Error(), "4242") {
+		t.Errorf("Error() should contain the pid")
+	}
+	if !strings.Contains(err.Error(), "--force") {
+		t.Errorf("Error() should contain hint about '--force'")
+	}
+}
+
+func TestLedgerTampered(t *testing.T) {
+	err := LedgerTampered(3)
+	if err.Code != ErrLedgerTampered {
+		t.Errorf("Code = %v, want %v", err.Code, ErrLedgerTampered)
+	}
+	if !strings.Contains(err.Error(), "3 issue(s)") {
+		t.Errorf("Error() should contain the issue count")
+	}
+	if !strings.Contains(err.Error(), "bar ledger verify") {
+		t.Errorf("Error() should contain hint about 'bar ledger verify'")
+	}
 }
 
 func TestUpdateFailed(t *testing.T) {
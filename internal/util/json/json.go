@@ -3,6 +3,7 @@ package json
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 )
 
 func ReadFile(path string, out any) error {
@@ -13,11 +14,34 @@ func ReadFile(path string, out any) error {
 	return json.Unmarshal(data, out)
 }
 
+// WriteFile writes value as indented JSON. The data goes to a temporary file
+// in the same directory that is then renamed over path, so readers never see
+// a partially written file.
 func WriteFile(path string, value any) error {
 	data, err := json.MarshalIndent(value, "", "  ")
 	if err != nil {
 		return err
 	}
 	data = append(data, '\n')
-	return os.WriteFile(path, data, 0o644)
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
@@ -0,0 +1,50 @@
+package json
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriteFile_Atomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	type payload struct {
+		N    int    `json:"n"`
+		Data string `json:"data"`
+	}
+	big := string(make([]byte, 64*1024))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(n int) {
+			defer wg.Done()
+			if err := WriteFile(path, payload{N: n, Data: big}); err != nil {
+				t.Errorf("WriteFile failed: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			var p payload
+			if err := ReadFile(path, &p); err != nil && !os.IsNotExist(err) {
+				t.Errorf("read a partially written file: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Errorf("expected mode 0644, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected temp files to be cleaned up, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,48 @@
+// Package lock provides advisory file locks used to serialize writes to BAR
+// state shared between concurrent bar processes.
+package lock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock is an exclusive flock held on a "<path>.lock" file.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire blocks until it holds the exclusive lock guarding path.
+func Acquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release unlocks and closes the lock file.
+func (l *Lock) Release() error {
+	defer l.f.Close()
+	return syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+}
+
+// With runs fn while holding the lock guarding path.
+func With(path string, fn func() error) error {
+	l, err := Acquire(path)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return fn()
+}
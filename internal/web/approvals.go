@@ -0,0 +1,128 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/blade-agent-runtime/internal/core/approval"
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
+)
+
+// DecisionRequest is the body of POST /api/approvals/<id> and the data of an
+// "approval_decision" WebSocket message.
+type DecisionRequest struct {
+	ID       string `json:"id,omitempty"`
+	Approved bool   `json:"approved"`
+	By       string `json:"by,omitempty"`
+}
+
+// handleApprovals lists approval requests: pending ones by default, all with
+// ?all=1, optionally filtered by ?task=<id>.
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	reqs, err := s.approvals.List(r.URL.Query().Get("all") == "")
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if taskID := r.URL.Query().Get("task"); taskID != "" {
+		filtered := []*approval.Request{}
+		for _, req := range reqs {
+			if req.TaskID == taskID {
+				filtered = append(filtered, req)
+			}
+		}
+		reqs = filtered
+	}
+	s.writeJSON(w, reqs)
+}
+
+// handleApproval returns (GET) or decides (POST) one approval request.
+func (s *Server) handleApproval(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/approvals/")
+	switch r.Method {
+	case http.MethodGet:
+		req, err := s.approvals.Get(id)
+		if err != nil {
+			s.writeError(w, err, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, req)
+	case http.MethodPost:
+		var body DecisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		body.ID = id
+		req, err := s.decide(body)
+		switch {
+		case errors.Is(err, approval.ErrNotFound):
+			s.writeError(w, err, http.StatusNotFound)
+		case errors.Is(err, approval.ErrAlreadyDecided):
+			s.writeError(w, err, http.StatusConflict)
+		case err != nil:
+			s.writeError(w, err, http.StatusInternalServerError)
+		default:
+			s.writeJSON(w, req)
+		}
+	default:
+		s.writeError(w, nil, http.StatusMethodNotAllowed)
+	}
+}
+
+// decide records a decision made in the Web UI and tells the other clients.
+func (s *Server) decide(d DecisionRequest) (*approval.Request, error) {
+	by := d.By
+	if by == "" {
+		by = "web"
+	}
+	req, err := s.approvals.Decide(d.ID, ledger.PolicyDecision{
+		Approved: d.Approved,
+		By:       by,
+		Via:      approval.ViaWeb,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Broadcast("approval_decided", req)
+	return req, nil
+}
+
+// handleMessage handles the messages Web UI clients send over the WebSocket.
+func (s *Server) handleMessage(msgType string, data json.RawMessage) {
+	if msgType != "approval_decision" {
+		return
+	}
+	var d DecisionRequest
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+	_, _ = s.decide(d)
+}
+
+// watchApprovals broadcasts an "approval_request" for each new pending
+// request, including those filed by other bar processes.
+func (s *Server) watchApprovals(stop <-chan struct{}) {
+	seen := map[string]bool{}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		reqs, err := s.approvals.List(true)
+		if err == nil {
+			for _, req := range reqs {
+				if !seen[req.ID] {
+					seen[req.ID] = true
+					s.Broadcast("approval_request", req)
+				}
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/user/blade-agent-runtime/internal/core/ledger"
 	"github.com/user/blade-agent-runtime/internal/core/task"
 )
 
@@ -69,11 +71,25 @@ func (s *Server) handleLedger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entries, err := s.ledgerReader.ReadAll(taskID)
+	// Filters: ?kind=run,apply&failed=1&since=2h&until=...&cmd=...&file=...&policy=warn&limit=N
+	query, err := ledger.ParseQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	entries, skipped, err := s.ledgerReader.Query(taskID, query)
 	if err != nil {
 		s.writeError(w, err, http.StatusInternalServerError)
 		return
 	}
+	// Lines that cannot be parsed are left out rather than failing the request
+	if len(skipped) > 0 {
+		lines := make([]string, len(skipped))
+		for i, line := range skipped {
+			lines[i] = strconv.Itoa(line)
+		}
+		w.Header().Set("X-Bar-Skipped-Lines", strings.Join(lines, ","))
+	}
 
 	s.writeJSON(w, entries)
 }
@@ -87,6 +103,17 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 	}
 
 	taskID, stepID := parts[0], parts[1]
+	// ?delta=1 returns only the changes made by the step itself
+	if r.URL.Query().Get("delta") != "" {
+		data, err := s.ledgerReader.ReadFile(filepath.Join(s.barDir, "tasks", taskID, "artifacts", stepID+".delta.patch"))
+		if err != nil {
+			s.writeError(w, err, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+		return
+	}
 	// Try .patch first, then .diff (for backward compatibility if any)
 	diffPath := filepath.Join(s.barDir, "tasks", taskID, "artifacts", stepID+".patch")
 	if _, err := s.ledgerReader.ReadFile(diffPath); err != nil {
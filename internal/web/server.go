@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/user/blade-agent-runtime/internal/core/approval"
 	"github.com/user/blade-agent-runtime/internal/core/diff"
 	"github.com/user/blade-agent-runtime/internal/core/ledger"
 	"github.com/user/blade-agent-runtime/internal/core/task"
@@ -17,17 +18,23 @@ type Server struct {
 	ledgerReader *ledger.Reader
 	barDir       string
 	wsHub        *WebSocketHub
+	approvals    *approval.Store
 	httpServer   *http.Server
+	stop         chan struct{}
 }
 
 func NewServer(addr string, taskManager *task.Manager, barDir string) *Server {
-	return &Server{
+	s := &Server{
 		addr:         addr,
 		taskManager:  taskManager,
 		ledgerReader: ledger.NewReader(filepath.Join(barDir, "tasks")),
 		barDir:       barDir,
 		wsHub:        NewWebSocketHub(),
+		approvals:    approval.NewStore(approval.StoreDir(barDir)),
+		stop:         make(chan struct{}),
 	}
+	s.wsHub.OnMessage = s.handleMessage
+	return s
 }
 
 func (s *Server) Start() error {
@@ -43,6 +50,7 @@ func (s *Server) Start() error {
 	}
 
 	go s.wsHub.Run()
+	go s.watchApprovals(s.stop)
 
 	return s.httpServer.ListenAndServe()
 }
@@ -50,6 +58,7 @@ func (s *Server) Start() error {
 func (s *Server) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	close(s.stop)
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -60,6 +69,8 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/ledger/", s.handleLedger)
 	mux.HandleFunc("/api/diff/", s.handleDiff)
 	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/approvals", s.handleApprovals)
+	mux.HandleFunc("/api/approvals/", s.handleApproval)
 	mux.HandleFunc("/ws", s.wsHub.HandleWebSocket)
 	mux.HandleFunc("/", s.handleStatic)
 }
@@ -90,6 +101,24 @@ func (s *Server) BroadcastLiveDiff(taskID string, result *diff.Result) {
 		"additions": result.Additions,
 		"deletions": result.Deletions,
 		"file_list": result.FileList,
+		"changes":   fileChanges(result.Changes),
 		"patch":     string(result.Patch),
 	})
 }
+
+func fileChanges(changes []diff.FileChange) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(changes))
+	for _, c := range changes {
+		out = append(out, map[string]interface{}{
+			"path":      c.Path,
+			"old_path":  c.OldPath,
+			"status":    c.Status,
+			"additions": c.Additions,
+			"deletions": c.Deletions,
+			"binary":    c.Binary,
+			"old_mode":  c.OldMode,
+			"new_mode":  c.NewMode,
+		})
+	}
+	return out
+}
@@ -80,8 +80,8 @@ func (s *Server) serveFallbackHTML(w http.ResponseWriter) {
   <div class="endpoint"><code>GET /api/health</code> - Health check</div>
   <div class="endpoint"><code>GET /api/tasks</code> - List all tasks</div>
   <div class="endpoint"><code>GET /api/tasks/:id</code> - Get task detail</div>
-  <div class="endpoint"><code>GET /api/ledger/:task_id</code> - Get ledger entries</div>
-  <div class="endpoint"><code>GET /api/diff/:task_id/:step_id</code> - Get diff content</div>
+  <div class="endpoint"><code>GET /api/ledger/:task_id</code> - Get ledger entries (filters: <code>kind</code>, <code>failed</code>, <code>since</code>, <code>until</code>, <code>cmd</code>, <code>file</code>, <code>policy</code>, <code>limit</code>)</div>
+  <div class="endpoint"><code>GET /api/diff/:task_id/:step_id</code> - Get diff content (<code>?delta=1</code> for the step's own changes)</div>
   <div class="endpoint"><code>GET /api/status</code> - Get current status</div>
   <div class="endpoint"><code>WS /ws</code> - WebSocket for real-time updates</div>
 </body>
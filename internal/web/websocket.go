@@ -20,6 +20,8 @@ type WebSocketHub struct {
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+	// OnMessage, when set, receives the messages clients send.
+	OnMessage func(msgType string, data json.RawMessage)
 }
 
 type Client struct {
@@ -109,12 +111,19 @@ func (c *Client) readPump() {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(4096)
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if c.hub.OnMessage != nil && json.Unmarshal(data, &msg) == nil {
+			c.hub.OnMessage(msg.Type, msg.Data)
+		}
 	}
 }
 
@@ -2,17 +2,19 @@ import { useState, useEffect } from 'react';
 import { useParams } from 'react-router-dom';
 import { 
   Terminal, RotateCcw, FileDiff, 
-  GitBranch, PanelLeftClose, PanelLeft, Radio
+  GitBranch, PanelLeftClose, PanelLeft, Radio, ShieldAlert, ShieldQuestion, ShieldCheck
 } from 'lucide-react';
 import { motion, AnimatePresence } from 'framer-motion';
 import { api } from '@/services/api';
 import { useWebSocket } from '@/hooks/useWebSocket';
-import type { Task, LedgerStep, LiveDiffData } from '@/types';
+import type { Task, LedgerStep, LiveDiffData, PolicyWarningData, ApprovalRequest } from '@/types';
 import DiffViewer from '@/components/DiffViewer';
 
 const StepIcon = ({ kind }: { kind: string }) => {
   if (kind === 'rollback') return <RotateCcw className="w-4 h-4 text-rose-400" />;
   if (kind === 'apply') return <FileDiff className="w-4 h-4 text-purple-400" />;
+  if (kind === 'gate') return <ShieldCheck className="w-4 h-4 text-amber-400" />;
+  if (kind === 'sync') return <GitBranch className="w-4 h-4 text-emerald-400" />;
   return <Terminal className="w-4 h-4 text-blue-400" />;
 };
 
@@ -37,6 +39,8 @@ const TaskDetailPage = () => {
     patch: string;
   } | null>(null);
   const [showLive, setShowLive] = useState(true);
+  const [policyWarnings, setPolicyWarnings] = useState<PolicyWarningData[]>([]);
+  const [approvals, setApprovals] = useState<ApprovalRequest[]>([]);
 
   useEffect(() => {
     if (id) {
@@ -64,6 +68,39 @@ const TaskDetailPage = () => {
     }
   }, [lastMessage, id, showLive]);
 
+  // Listen for path and limit rules tripped by the running step
+  useEffect(() => {
+    if (lastMessage?.type === 'policy_warning') {
+      const data = lastMessage.data as PolicyWarningData;
+      if (data.task_id === id) {
+        setPolicyWarnings(prev => [...prev.filter(w => w.rule !== data.rule), data]);
+      }
+    }
+  }, [lastMessage, id]);
+
+  // Commands paused by "confirm" policy rules until approved here
+  useEffect(() => {
+    const forTask = (r: ApprovalRequest) => !r.task_id || r.task_id === id;
+    if (lastMessage?.type === 'approval_request') {
+      const data = lastMessage.data as ApprovalRequest;
+      if (forTask(data)) {
+        setApprovals(prev => [...prev.filter(a => a.id !== data.id), data]);
+      }
+    } else if (lastMessage?.type === 'approval_decided') {
+      const data = lastMessage.data as ApprovalRequest;
+      setApprovals(prev => prev.filter(a => a.id !== data.id));
+    }
+  }, [lastMessage, id]);
+
+  const handleDecide = async (request: ApprovalRequest, approved: boolean) => {
+    try {
+      await api.decideApproval(request.id, approved);
+    } catch (err) {
+      console.error('Failed to decide approval:', err);
+    }
+    setApprovals(prev => prev.filter(a => a.id !== request.id));
+  };
+
   useEffect(() => {
     if (ledger.length > 0 && !selectedStepId) {
       const lastStepWithPatch = [...ledger].reverse().find(s => s.artifacts?.patch);
@@ -76,12 +113,14 @@ const TaskDetailPage = () => {
   const loadTaskData = async () => {
     try {
       setLoading(true);
-      const [taskData, ledgerData] = await Promise.all([
+      const [taskData, ledgerData, approvalData] = await Promise.all([
         api.getTask(id!),
         api.getLedger(id!).catch(() => []),
+        api.getApprovals(id!).catch(() => []),
       ]);
       setTask(taskData);
       setLedger(ledgerData || []);
+      setApprovals(approvalData || []);
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to load task');
     } finally {
@@ -219,6 +258,25 @@ const TaskDetailPage = () => {
                                 <span className={`text-sm font-medium ${isSelected ? 'text-white' : 'text-zinc-300'}`}>
                                   {step.kind}
                                 </span>
+                                {step.gate && (
+                                  <span className={`text-xs font-mono ${step.exit_code === 0 ? 'text-emerald-400' : step.gate_optional ? 'text-amber-400' : 'text-rose-400'}`}>
+                                    {step.gate}{step.gate_optional ? ' (optional)' : ''} {step.exit_code === 0 ? 'passed' : 'failed'}
+                                  </span>
+                                )}
+                                {step.kind === 'apply' && step.mode && (
+                                  <span className="text-xs font-mono text-zinc-500">
+                                    {step.mode}{step.target_branch ? ` → ${step.target_branch}` : ''}
+                                  </span>
+                                )}
+                                {step.kind === 'sync' && step.new_base && (
+                                  <span className="text-xs font-mono text-zinc-500">
+                                    {step.mode} {step.old_base?.slice(0, 8)} → {step.new_base.slice(0, 8)}
+                                    {step.conflicts && step.conflicts.length > 0 ? ` (${step.conflicts.length} resolved)` : ''}
+                                  </span>
+                                )}
+                                {step.gates_skipped && (
+                                  <span className="text-xs text-amber-400">gates skipped</span>
+                                )}
                               </div>
                               <span className="text-xs font-mono text-zinc-500">{formatDate(step.started_at)}</span>
                             </div>
@@ -298,6 +356,51 @@ const TaskDetailPage = () => {
           )}
         </div>
 
+        {/* Pending confirmations */}
+        {approvals.length > 0 && (
+          <div className="px-4 py-2 border-b border-zinc-800 bg-sky-950/30 text-xs text-sky-300 space-y-2">
+            {approvals.map(a => (
+              <div key={a.id} className="flex items-center gap-2">
+                <ShieldQuestion className="w-3.5 h-3.5 shrink-0" />
+                <span className="font-medium">{a.rules.join(', ')}</span>
+                <code className="truncate text-sky-200/80">{a.command.join(' ')}</code>
+                {a.reasons && a.reasons.length > 0 && (
+                  <span className="truncate text-sky-400/70">{a.reasons.join('; ')}</span>
+                )}
+                <div className="ml-auto flex gap-1.5 shrink-0">
+                  <button
+                    onClick={() => handleDecide(a, true)}
+                    className="px-2 py-0.5 rounded bg-emerald-900/50 text-emerald-300 border border-emerald-800/50 hover:bg-emerald-900"
+                  >
+                    Approve
+                  </button>
+                  <button
+                    onClick={() => handleDecide(a, false)}
+                    className="px-2 py-0.5 rounded bg-rose-950/50 text-rose-300 border border-rose-900/50 hover:bg-rose-950"
+                  >
+                    Deny
+                  </button>
+                </div>
+              </div>
+            ))}
+          </div>
+        )}
+
+        {/* Policy warnings from the live diff */}
+        {policyWarnings.length > 0 && (
+          <div className="px-4 py-2 border-b border-zinc-800 bg-amber-950/30 text-xs text-amber-300 space-y-1">
+            {policyWarnings.map(w => (
+              <div key={w.rule} className="flex items-center gap-2">
+                <ShieldAlert className="w-3.5 h-3.5 shrink-0" />
+                <span className="font-medium">{w.rule}</span>
+                {w.source && <span className="text-amber-500/70">({w.source})</span>}
+                <span className="text-amber-400/80">{w.matched}</span>
+                {w.action === 'block' && <span className="text-rose-400">apply will be blocked</span>}
+              </div>
+            ))}
+          </div>
+        )}
+
         {/* Diff Content */}
         <div className="flex-1 relative overflow-hidden">
           {(selectedStepId || (showLive && liveDiff)) ? (
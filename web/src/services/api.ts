@@ -1,4 +1,4 @@
-import type { Task, LedgerStep, Status } from '@/types';
+import type { Task, LedgerStep, LedgerQuery, Status, ApprovalRequest } from '@/types';
 
 const API_BASE = '/api';
 
@@ -17,10 +17,20 @@ export const api = {
   
   getTask: (id: string) => fetchJSON<Task>(`/tasks/${id}`),
   
-  getLedger: (taskId: string) => fetchJSON<LedgerStep[]>(`/ledger/${taskId}`),
+  getLedger: (taskId: string, query: LedgerQuery = {}) => {
+    const params = new URLSearchParams();
+    Object.entries(query).forEach(([key, value]) => {
+      if (value !== undefined && value !== '' && value !== false) {
+        params.set(key, Array.isArray(value) ? value.join(',') : String(value));
+      }
+    });
+    const qs = params.toString();
+    return fetchJSON<LedgerStep[]>(`/ledger/${taskId}${qs ? `?${qs}` : ''}`);
+  },
   
-  getDiff: async (taskId: string, stepId: string): Promise<string> => {
-    const response = await fetch(`${API_BASE}/diff/${taskId}/${stepId}`);
+  getDiff: async (taskId: string, stepId: string, delta = false): Promise<string> => {
+    const query = delta ? '?delta=1' : '';
+    const response = await fetch(`${API_BASE}/diff/${taskId}/${stepId}${query}`);
     if (!response.ok) {
       throw new Error(`HTTP ${response.status}: ${response.statusText}`);
     }
@@ -28,4 +38,19 @@ export const api = {
   },
   
   getStatus: () => fetchJSON<Status>('/status'),
+
+  getApprovals: (taskId?: string) =>
+    fetchJSON<ApprovalRequest[]>(`/approvals${taskId ? `?task=${taskId}` : ''}`),
+
+  decideApproval: async (id: string, approved: boolean, by?: string): Promise<ApprovalRequest> => {
+    const response = await fetch(`${API_BASE}/approvals/${id}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ approved, by }),
+    });
+    if (!response.ok) {
+      throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+    }
+    return response.json();
+  },
 };
@@ -3,6 +3,7 @@ export interface Task {
   name: string;
   repo_root: string;
   base_ref: string;
+  base_sha?: string;
   branch: string;
   workspace_path: string;
   status: 'active' | 'closed';
@@ -12,36 +13,105 @@ export interface Task {
   is_active?: boolean;
 }
 
+export interface FileChange {
+  path: string;
+  old_path?: string;
+  status: 'A' | 'M' | 'D' | 'R' | 'C' | 'T';
+  additions: number;
+  deletions: number;
+  binary?: boolean;
+  old_mode?: string;
+  new_mode?: string;
+}
+
+export interface DiffStat {
+  files: number;
+  additions: number;
+  deletions: number;
+  file_list?: string[];
+  changes?: FileChange[];
+}
+
+export interface LedgerQuery {
+  kind?: Array<LedgerStep['kind']>;
+  failed?: boolean;
+  since?: string;
+  until?: string;
+  cmd?: string;
+  file?: string;
+  policy?: string;
+  limit?: number;
+}
+
+export interface SubStep {
+  cmd: string[];
+  cwd?: string;
+  shell?: boolean;
+  started_at: string;
+  duration_ms?: number;
+  exit_code?: number;
+  blocked?: boolean;
+}
+
+export interface HookResult {
+  phase: 'pre_run' | 'post_run';
+  cmd: string;
+  exit_code: number;
+  duration_ms?: number;
+  output?: string;
+}
+
 export interface LedgerStep {
   step_id: string;
-  kind: 'run' | 'apply' | 'rollback';
+  kind: 'run' | 'apply' | 'rollback' | 'gate' | 'sync';
+  phase?: 'started' | 'finished';
   started_at: string;
   ended_at: string;
   duration_ms: number;
   cmd?: string[];
   cwd?: string;
+  pid?: number;
+  launcher?: string;
+  recovered?: boolean;
   exit_code?: number;
-  diff_stat?: {
-    files: number;
-    additions: number;
-    deletions: number;
-    file_list?: string[];
-  };
+  diff_stat?: DiffStat;
+  delta_stat?: DiffStat;
   artifacts?: {
     patch?: string;
+    delta_patch?: string;
     output?: string;
+    commands?: string;
+    hooks?: string[];
+    patches?: string[];
+    description?: string;
+    sha256?: Record<string, string>;
   };
   policy_events?: Array<{
     rule: string;
+    source?: string;
     action: string;
     matched: string;
+    command?: string[];
+    files?: string[];
+    decision?: PolicyDecision;
   }>;
+  sub_steps?: SubStep[];
+  hooks?: HookResult[];
   mode?: string;
   commit_sha?: string;
   commit_message?: string;
   target_branch?: string;
+  gates_skipped?: boolean;
+  commits?: string[];
+  gate?: string;
+  gate_optional?: boolean;
+  old_base?: string;
+  new_base?: string;
+  conflicts?: string[];
   target?: string;
   target_step?: string;
+  prev_hash?: string;
+  hash?: string;
   hard?: boolean;
 }
 
@@ -55,11 +125,40 @@ export interface WebSocketMessage {
   data: unknown;
 }
 
+export interface PolicyDecision {
+  approved: boolean;
+  by?: string;
+  via: 'terminal' | 'web' | 'timeout';
+  at: string;
+}
+
+export interface ApprovalRequest {
+  id: string;
+  task_id?: string;
+  rules: string[];
+  reasons?: string[];
+  command: string[];
+  cwd?: string;
+  created_at: string;
+  decision?: PolicyDecision;
+}
+
+export interface PolicyWarningData {
+  task_id: string;
+  rule: string;
+  source?: string;
+  action: string;
+  matched: string;
+  reason?: string;
+  files?: string[];
+}
+
 export interface LiveDiffData {
   task_id: string;
   files: number;
   additions: number;
   deletions: number;
   file_list: string[];
+  changes: FileChange[];
   patch: string;
 }